@@ -2,13 +2,19 @@ module github.com/ian-antking/king-family-photos/integration
 
 go 1.17
 
-require github.com/stretchr/testify v1.7.0
+require (
+	github.com/aws/aws-sdk-go v1.42.35
+	github.com/google/uuid v1.3.0
+	github.com/ian-antking/king-family-photos/objectkey v0.0.0
+	github.com/stretchr/testify v1.7.0
+)
 
 require (
-	github.com/aws/aws-sdk-go v1.42.35 // indirect
-	github.com/davecgh/go-spew v1.1.0 // indirect
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/aws/aws-lambda-go v1.29.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
+
+replace github.com/ian-antking/king-family-photos/objectkey => ../objectkey
@@ -5,9 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"log"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -15,10 +19,23 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/ian-antking/king-family-photos/objectkey"
 )
 
 var testSuite *integrationTestSuite
 
+var fixtures = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+var renditions = []string{"frame-480", "thumb-200", "hd-1080"}
+
+// displayKeys matches the OUTPUT_FORMAT and DISPLAY_FOLDERS deployed by serverless.yml.
+var displayKeys = objectkey.NewKeyMapper(".jpg", false)
+
+func renditionKey(name, key string) string {
+	return displayKeys.DisplayKey(name, key)
+}
+
 type integrationTestSuite struct {
 	suite.Suite
 	Environment       string
@@ -29,15 +46,35 @@ type integrationTestSuite struct {
 	displayBucketName string
 }
 
+// testPhoto returns a camera-sized grid of random grey blocks. The edges and
+// spread of tones pass the default quality gate, and each upload hashes
+// differently so none is skipped as a duplicate of another.
+func testPhoto() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 3648, 2736))
+	const block = 228
+	for y := 0; y < img.Bounds().Dy(); y += block {
+		for x := 0; x < img.Bounds().Dx(); x += block {
+			grey := color.Gray{Y: uint8(fixtures.Intn(256))}
+			draw.Draw(img, image.Rect(x, y, x+block, y+block), image.NewUniform(grey), image.Point{}, draw.Src)
+		}
+	}
+
+	return img
+}
+
 func (s *integrationTestSuite) putImageInIngestBucket(img image.Image) string {
 	buf := new(bytes.Buffer)
 	_ = jpeg.Encode(buf, img, nil)
 
+	return s.putObjectInIngestBucket(buf.Bytes())
+}
+
+func (s *integrationTestSuite) putObjectInIngestBucket(data []byte) string {
 	u, _ := uuid.NewUUID()
 	key := u.String()
 
 	putObjectInput := s3manager.UploadInput{
-		Body:   bytes.NewReader(buf.Bytes()),
+		Body:   bytes.NewReader(data),
 		Bucket: aws.String(s.ingestBucketName),
 		Key:    aws.String(key),
 	}
@@ -111,6 +148,12 @@ func (s *integrationTestSuite) deleteObjectFromBucket(bucket, key string) {
 }
 
 func (s *integrationTestSuite) getImageFromBucket(bucket, key string) image.Image {
+	img, _, _ := image.Decode(bytes.NewReader(s.getObjectFromBucket(bucket, key)))
+
+	return img
+}
+
+func (s *integrationTestSuite) getObjectFromBucket(bucket, key string) []byte {
 	input := s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -124,9 +167,7 @@ func (s *integrationTestSuite) getImageFromBucket(bucket, key string) image.Imag
 		log.Fatalln(err.Error())
 	}
 
-	img, _, _ := image.Decode(bytes.NewReader(buffer.Bytes()))
-
-	return img
+	return buffer.Bytes()
 }
 
 func (s *integrationTestSuite) TearDownTest() {
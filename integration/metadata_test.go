@@ -0,0 +1,97 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const tagGPSIFD = 0x8825
+
+func (s *integrationTestSuite) TestStripsGPSMetadata() {
+	source := jpegWithGPSExif(testPhoto())
+
+	assert.True(s.T(), hasGPSIFD(source))
+
+	objectKey := s.putObjectInIngestBucket(source)
+
+	time.Sleep(time.Second * 5)
+
+	displayImage := s.getObjectFromBucket(s.displayBucketName, renditionKey("frame-480", objectKey))
+
+	assert.NotEmpty(s.T(), displayImage)
+	assert.False(s.T(), hasGPSIFD(displayImage))
+}
+
+func jpegWithGPSExif(img image.Image) []byte {
+	buf := new(bytes.Buffer)
+	_ = jpeg.Encode(buf, img, nil)
+	encoded := buf.Bytes()
+
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM")
+	_ = binary.Write(tiff, binary.BigEndian, uint16(42))
+	_ = binary.Write(tiff, binary.BigEndian, uint32(8))
+
+	// IFD0 holds only the GPS pointer, the GPS IFD holds GPSLatitudeRef
+	_ = binary.Write(tiff, binary.BigEndian, uint16(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{tagGPSIFD, 4})
+	_ = binary.Write(tiff, binary.BigEndian, []uint32{1, 26})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(0))
+	_ = binary.Write(tiff, binary.BigEndian, uint16(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{0x0001, 2})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(2))
+	tiff.Write([]byte{'N', 0, 0, 0})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(segment)+2))
+
+	output := append([]byte{}, encoded[:2]...)
+	output = append(output, 0xFF, 0xE1)
+	output = append(output, length...)
+	output = append(output, segment...)
+
+	return append(output, encoded[2:]...)
+}
+
+func hasGPSIFD(data []byte) bool {
+	offset := 2
+	for offset+4 <= len(data) && 0xFF == data[offset] && 0xDA != data[offset+1] {
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) {
+			return false
+		}
+
+		segment := data[offset+4 : end]
+		if 0xE1 == data[offset+1] && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) && 14 <= len(segment) {
+			tiff := segment[6:]
+
+			var byteOrder binary.ByteOrder = binary.BigEndian
+			if "II" == string(tiff[:2]) {
+				byteOrder = binary.LittleEndian
+			}
+
+			ifdOffset := int(byteOrder.Uint32(tiff[4:]))
+			if ifdOffset+2 > len(tiff) {
+				return false
+			}
+
+			count := int(byteOrder.Uint16(tiff[ifdOffset:]))
+			for i := 0; i < count && ifdOffset+2+(i+1)*12 <= len(tiff); i++ {
+				if tagGPSIFD == byteOrder.Uint16(tiff[ifdOffset+2+i*12:]) {
+					return true
+				}
+			}
+		}
+
+		offset = end
+	}
+
+	return false
+}
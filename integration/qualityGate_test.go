@@ -0,0 +1,20 @@
+package integration
+
+import (
+	"image"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *integrationTestSuite) TestRejectsUniformImages() {
+	objectKey := s.putImageInIngestBucket(image.NewRGBA(image.Rect(0, 0, 3648, 2736)))
+
+	time.Sleep(time.Second * 5)
+
+	objects := s.listItemsInBucket(s.displayBucketName)
+
+	for _, rendition := range renditions {
+		assert.NotContains(s.T(), objects, renditionKey(rendition, objectKey))
+	}
+}
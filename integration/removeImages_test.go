@@ -1,22 +1,21 @@
 package integration
 
 import (
-	"image"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func (s *integrationTestSuite) TestRemoveImages() {
-	img := image.NewRGBA(image.Rect(0, 0, 3648, 2736))
-
-	objectKey := s.putImageInIngestBucket(img)
+	objectKey := s.putImageInIngestBucket(testPhoto())
 
 	time.Sleep(time.Second * 5)
 
 	objects := s.listItemsInBucket(s.displayBucketName)
 
-	assert.Contains(s.T(), objects, objectKey)
+	for _, rendition := range renditions {
+		assert.Contains(s.T(), objects, renditionKey(rendition, objectKey))
+	}
 
 	s.deleteObjectFromBucket(s.ingestBucketName, objectKey)
 
@@ -24,6 +23,7 @@ func (s *integrationTestSuite) TestRemoveImages() {
 
 	objects = s.listItemsInBucket(s.displayBucketName)
 
-	assert.NotContains(s.T(), objects, objectKey)
-
+	for _, rendition := range renditions {
+		assert.NotContains(s.T(), objects, renditionKey(rendition, objectKey))
+	}
 }
@@ -8,13 +8,15 @@ import (
 )
 
 func (s *integrationTestSuite) TestResizeImages() {
-	img := image.NewRGBA(image.Rect(0, 0, 3648, 2736))
-
-	objectKey := s.putImageInIngestBucket(img)
+	objectKey := s.putImageInIngestBucket(testPhoto())
 
 	time.Sleep(time.Second * 5)
 
-	resizedImage := s.getImageFromBucket(s.displayBucketName, objectKey)
+	frameImage := s.getImageFromBucket(s.displayBucketName, renditionKey("frame-480", objectKey))
+	thumbnailImage := s.getImageFromBucket(s.displayBucketName, renditionKey("thumb-200", objectKey))
+	hdImage := s.getImageFromBucket(s.displayBucketName, renditionKey("hd-1080", objectKey))
 
-	assert.Equal(s.T(), 480, resizedImage.Bounds().Max.Y)
+	assert.Equal(s.T(), 480, frameImage.Bounds().Max.Y)
+	assert.Equal(s.T(), image.Rect(0, 0, 200, 200), thumbnailImage.Bounds())
+	assert.Equal(s.T(), 1080, hdImage.Bounds().Max.Y)
 }
@@ -0,0 +1,130 @@
+// Package batch reports the outcome of each record in an event, so one
+// failing photo neither stops nor retries the others.
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/ian-antking/king-family-photos/objectkey"
+)
+
+const (
+	SourceS3  = "s3"
+	SourceSQS = "sqs"
+)
+
+// Failure is a record that could not be processed, identified by its
+// decoded source key, or its raw key when that cannot be decoded.
+type Failure struct {
+	Key string
+	Err error
+}
+
+// NewError returns a BatchError for the failures, or nil when there are none.
+func NewError(failures []Failure) error {
+	if 0 == len(failures) {
+		return nil
+	}
+
+	return BatchError{Failures: failures}
+}
+
+// LoadSource reads EVENT_SOURCE, which says whether S3 events are delivered
+// directly or in the bodies of SQS messages.
+func LoadSource(getenv func(string) string) (string, error) {
+	switch source := strings.ToLower(strings.TrimSpace(getenv("EVENT_SOURCE"))); source {
+	case "", SourceS3:
+		return SourceS3, nil
+	case SourceSQS:
+		return SourceSQS, nil
+	default:
+		return "", SourceConfigError{Err: fmt.Errorf("unsupported EVENT_SOURCE %s", source)}
+	}
+}
+
+type message struct {
+	id      string
+	records []events.S3EventRecord
+}
+
+func (m message) failed(keys map[string]bool) bool {
+	for _, record := range m.records {
+		if key, _ := recordKey(record); keys[key] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func recordKey(record events.S3EventRecord) (string, error) {
+	key, err := objectkey.FromRecord(record)
+	if nil != err {
+		return record.S3.Object.Key, err
+	}
+
+	return key, nil
+}
+
+// KeyFailures returns a failure for every record whose key cannot be
+// decoded. Retrying them cannot help, but reporting them sends them to the
+// dead-letter queue instead of dropping them unseen.
+func KeyFailures(s3Event events.S3Event) []Failure {
+	var failures []Failure
+	for _, record := range s3Event.Records {
+		if key, err := recordKey(record); nil != err {
+			failures = append(failures, Failure{Key: key, Err: err})
+		}
+	}
+
+	return failures
+}
+
+// RunSQS runs the S3 events carried by SQS messages together and reports
+// the messages holding a failed record, so only those are retried. Any
+// other error fails every message. Message bodies that are not S3 events
+// are logged and dropped, as retrying them cannot help.
+func RunSQS(sqsEvent events.SQSEvent, run func(events.S3Event) error) events.SQSEventResponse {
+	var s3Event events.S3Event
+	var messages []message
+	for _, record := range sqsEvent.Records {
+		var body events.S3Event
+		if err := json.Unmarshal([]byte(record.Body), &body); nil != err {
+			log.Printf("skipping message %s: %s", record.MessageId, err.Error())
+			continue
+		}
+
+		s3Event.Records = append(s3Event.Records, body.Records...)
+		messages = append(messages, message{id: record.MessageId, records: body.Records})
+	}
+
+	response := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+
+	err := run(s3Event)
+	if nil == err {
+		return response
+	}
+
+	log.Println(err.Error())
+
+	var batchErr BatchError
+	partial := errors.As(err, &batchErr)
+	keys := make(map[string]bool)
+	for _, failure := range batchErr.Failures {
+		keys[failure.Key] = true
+	}
+
+	for _, message := range messages {
+		if !partial || message.failed(keys) {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.id})
+		}
+	}
+
+	return response
+}
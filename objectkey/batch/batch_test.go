@@ -0,0 +1,169 @@
+package batch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type batchTestSuite struct {
+	suite.Suite
+}
+
+func environment(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func sqsMessage(id string, keys ...string) events.SQSMessage {
+	body := `{"Records":[`
+	for i, key := range keys {
+		if 0 != i {
+			body += ","
+		}
+		body += `{"s3":{"bucket":{"name":"ingest"},"object":{"key":"` + key + `"}}}`
+	}
+
+	return events.SQSMessage{MessageId: id, Body: body + "]}"}
+}
+
+func keys(s3Event events.S3Event) []string {
+	var keys []string
+	for _, record := range s3Event.Records {
+		keys = append(keys, record.S3.Object.Key)
+	}
+
+	return keys
+}
+
+func (s *batchTestSuite) TestNewError() {
+	s.T().Run("returns nil without failures", func(t *testing.T) {
+		assert.Nil(t, NewError(nil))
+	})
+
+	s.T().Run("lists every failed key", func(t *testing.T) {
+		cause := errors.New("access denied")
+
+		err := NewError([]Failure{
+			{Key: "IMG_1234.jpg", Err: cause},
+			{Key: "2021/IMG_1300.jpg", Err: errors.New("slow down")},
+		})
+
+		assert.True(t, errors.Is(err, BatchError{}))
+		assert.True(t, errors.Is(err, cause))
+		assert.Equal(t, "failed records: IMG_1234.jpg: access denied; 2021/IMG_1300.jpg: slow down", err.Error())
+	})
+}
+
+func (s *batchTestSuite) TestKeyFailures() {
+	s.T().Run("reports records whose key cannot be decoded by their raw key", func(t *testing.T) {
+		failures := KeyFailures(events.S3Event{Records: []events.S3EventRecord{
+			{S3: events.S3Entity{Object: events.S3Object{Key: "IMG_1234.jpg"}}},
+			{S3: events.S3Entity{Object: events.S3Object{Key: "IMG_%zz.jpg"}}},
+			{S3: events.S3Entity{Object: events.S3Object{Key: ""}}},
+		}})
+
+		assert.Equal(t, 2, len(failures))
+		assert.Equal(t, "IMG_%zz.jpg", failures[0].Key)
+		assert.Equal(t, "", failures[1].Key)
+		assert.True(t, errors.Is(failures[0].Err, objectkey.InvalidKeyError{}))
+	})
+}
+
+func (s *batchTestSuite) TestLoadSource() {
+	s.T().Run("defaults to s3", func(t *testing.T) {
+		source, err := LoadSource(environment(map[string]string{}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, SourceS3, source)
+	})
+
+	s.T().Run("reads sqs", func(t *testing.T) {
+		source, err := LoadSource(environment(map[string]string{"EVENT_SOURCE": " SQS "}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, SourceSQS, source)
+	})
+
+	s.T().Run("returns SourceConfigError for other sources", func(t *testing.T) {
+		_, err := LoadSource(environment(map[string]string{"EVENT_SOURCE": "sns"}))
+
+		assert.True(t, errors.Is(err, SourceConfigError{}))
+		assert.Equal(t, "unsupported EVENT_SOURCE sns", err.Error())
+	})
+}
+
+func (s *batchTestSuite) TestRunSQS() {
+	s.T().Run("runs the records of every message together", func(t *testing.T) {
+		var ran []string
+
+		response := RunSQS(events.SQSEvent{Records: []events.SQSMessage{
+			sqsMessage("1", "IMG_1234.jpg"),
+			sqsMessage("2", "IMG_1300.jpg", "IMG_1301.jpg"),
+		}}, func(s3Event events.S3Event) error {
+			ran = keys(s3Event)
+			return nil
+		})
+
+		assert.Equal(t, []string{"IMG_1234.jpg", "IMG_1300.jpg", "IMG_1301.jpg"}, ran)
+		assert.Equal(t, events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}, response)
+	})
+
+	s.T().Run("reports only the messages holding failed records", func(t *testing.T) {
+		response := RunSQS(events.SQSEvent{Records: []events.SQSMessage{
+			sqsMessage("1", "IMG_1234.jpg"),
+			sqsMessage("2", "summer+2021/IMG_1300.jpg"),
+			sqsMessage("3", "IMG_1400.jpg"),
+		}}, func(s3Event events.S3Event) error {
+			return NewError([]Failure{{Key: "summer 2021/IMG_1300.jpg", Err: errors.New("slow down")}})
+		})
+
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+	})
+
+	s.T().Run("reports the messages holding records whose key cannot be decoded", func(t *testing.T) {
+		response := RunSQS(events.SQSEvent{Records: []events.SQSMessage{
+			sqsMessage("1", "IMG_1234.jpg"),
+			sqsMessage("2", ""),
+		}}, func(s3Event events.S3Event) error {
+			return NewError(KeyFailures(s3Event))
+		})
+
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+	})
+
+	s.T().Run("reports every message when the whole event fails", func(t *testing.T) {
+		response := RunSQS(events.SQSEvent{Records: []events.SQSMessage{
+			sqsMessage("1", "IMG_1234.jpg"),
+			sqsMessage("2", "IMG_1300.jpg"),
+		}}, func(s3Event events.S3Event) error {
+			return errors.New("access denied")
+		})
+
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "1"}, {ItemIdentifier: "2"}}, response.BatchItemFailures)
+	})
+
+	s.T().Run("drops messages that are not S3 events", func(t *testing.T) {
+		var ran []string
+
+		response := RunSQS(events.SQSEvent{Records: []events.SQSMessage{
+			{MessageId: "1", Body: "not json"},
+			sqsMessage("2", "IMG_1300.jpg"),
+		}}, func(s3Event events.S3Event) error {
+			ran = keys(s3Event)
+			return errors.New("access denied")
+		})
+
+		assert.Equal(t, []string{"IMG_1300.jpg"}, ran)
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+	})
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(batchTestSuite))
+}
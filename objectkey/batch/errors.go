@@ -0,0 +1,57 @@
+package batch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BatchError lists the records of an event that failed. It unwraps to the
+// first failure.
+type BatchError struct {
+	Failures []Failure
+}
+
+func (err BatchError) Unwrap() error {
+	if 0 == len(err.Failures) {
+		return nil
+	}
+
+	return err.Failures[0].Err
+}
+
+func (err BatchError) Error() string {
+	var messages []string
+	for _, failure := range err.Failures {
+		messages = append(messages, fmt.Sprintf("%s: %s", failure.Key, failure.Err.Error()))
+	}
+
+	return fmt.Sprintf("failed records: %s", strings.Join(messages, "; "))
+}
+
+func (err BatchError) Is(target error) bool {
+	_, ok := target.(BatchError)
+	if !ok {
+		_, ok = target.(*BatchError)
+	}
+	return ok
+}
+
+type SourceConfigError struct {
+	Err error
+}
+
+func (err SourceConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err SourceConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err SourceConfigError) Is(target error) bool {
+	_, ok := target.(SourceConfigError)
+	if !ok {
+		_, ok = target.(*SourceConfigError)
+	}
+	return ok
+}
@@ -0,0 +1,61 @@
+package objectkey
+
+type InvalidKeyError struct {
+	Err error
+}
+
+func (err InvalidKeyError) Unwrap() error {
+	return err.Err
+}
+
+func (err InvalidKeyError) Error() string {
+	return err.Err.Error()
+}
+
+func (err InvalidKeyError) Is(target error) bool {
+	_, ok := target.(InvalidKeyError)
+	if !ok {
+		_, ok = target.(*InvalidKeyError)
+	}
+	return ok
+}
+
+type KeyMapperConfigError struct {
+	Err error
+}
+
+func (err KeyMapperConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err KeyMapperConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err KeyMapperConfigError) Is(target error) bool {
+	_, ok := target.(KeyMapperConfigError)
+	if !ok {
+		_, ok = target.(*KeyMapperConfigError)
+	}
+	return ok
+}
+
+type RenditionsConfigError struct {
+	Err error
+}
+
+func (err RenditionsConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err RenditionsConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err RenditionsConfigError) Is(target error) bool {
+	_, ok := target.(RenditionsConfigError)
+	if !ok {
+		_, ok = target.(*RenditionsConfigError)
+	}
+	return ok
+}
@@ -0,0 +1,44 @@
+package filter
+
+type FilterConfigError struct {
+	Err error
+}
+
+func (err FilterConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err FilterConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err FilterConfigError) Is(target error) bool {
+	_, ok := target.(FilterConfigError)
+	if !ok {
+		_, ok = target.(*FilterConfigError)
+	}
+	return ok
+}
+
+// SkippedObjectError is returned for objects the filter does not let through,
+// along with the object as it was checked.
+type SkippedObjectError struct {
+	Object Object
+	Err    error
+}
+
+func (err SkippedObjectError) Unwrap() error {
+	return err.Err
+}
+
+func (err SkippedObjectError) Error() string {
+	return err.Err.Error()
+}
+
+func (err SkippedObjectError) Is(target error) bool {
+	_, ok := target.(SkippedObjectError)
+	if !ok {
+		_, ok = target.(*SkippedObjectError)
+	}
+	return ok
+}
@@ -0,0 +1,169 @@
+// Package filter decides which objects synced into the ingest bucket are
+// photos worth processing.
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Object describes an ingested object. An empty ContentType or a nil Size
+// means it is not known yet, and the matching checks are left until it is.
+type Object struct {
+	Key         string
+	ContentType string
+	Size        *int64
+}
+
+// Filter lets through objects matching an Include glob, or any object when
+// there are none, unless they match an Exclude glob, have a content type
+// outside ContentTypes or a size outside MinSize and MaxSize. Globs without a
+// / match the file name in any folder, and all matching ignores case.
+type Filter struct {
+	Include      []string
+	Exclude      []string
+	ContentTypes []string
+	MinSize      int64
+	MaxSize      int64
+}
+
+func (f Filter) Check(object Object) error {
+	if 0 != len(f.Include) && !matchAny(f.Include, object.Key) {
+		return SkippedObjectError{Object: object, Err: fmt.Errorf("key %s matches no include pattern", object.Key)}
+	}
+
+	for _, pattern := range f.Exclude {
+		if matchKey(pattern, object.Key) {
+			return SkippedObjectError{Object: object, Err: fmt.Errorf("key %s matches exclude pattern %s", object.Key, pattern)}
+		}
+	}
+
+	if contentType := mediaType(object.ContentType); "" != contentType && 0 != len(f.ContentTypes) && !matchContentType(f.ContentTypes, contentType) {
+		return SkippedObjectError{Object: object, Err: fmt.Errorf("content type %s is not allowed", contentType)}
+	}
+
+	if nil != object.Size && *object.Size < f.MinSize {
+		return SkippedObjectError{Object: object, Err: fmt.Errorf("size %d is below %d bytes", *object.Size, f.MinSize)}
+	}
+
+	if nil != object.Size && 0 != f.MaxSize && *object.Size > f.MaxSize {
+		return SkippedObjectError{Object: object, Err: fmt.Errorf("size %d is above %d bytes", *object.Size, f.MaxSize)}
+	}
+
+	return nil
+}
+
+func (f Filter) Validate() error {
+	for _, pattern := range append(append(append([]string{}, f.Include...), f.Exclude...), f.ContentTypes...) {
+		if _, err := path.Match(pattern, ""); nil != err {
+			return FilterConfigError{Err: fmt.Errorf("invalid pattern %s", pattern)}
+		}
+	}
+
+	if 0 > f.MinSize || 0 > f.MaxSize || (0 != f.MaxSize && f.MinSize > f.MaxSize) {
+		return FilterConfigError{Err: fmt.Errorf("size range %d-%d is invalid", f.MinSize, f.MaxSize)}
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matchKey(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchKey(pattern, key string) bool {
+	pattern, key = strings.ToLower(pattern), strings.ToLower(key)
+	if !strings.Contains(pattern, "/") {
+		key = path.Base(key)
+	}
+
+	matched, _ := path.Match(pattern, key)
+	return matched
+}
+
+func matchContentType(patterns []string, contentType string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), contentType); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mediaType drops parameters such as charset from a Content-Type.
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+}
+
+// LoadFilter reads INGEST_INCLUDE, INGEST_EXCLUDE and INGEST_CONTENT_TYPES as
+// comma-separated lists, and INGEST_MIN_SIZE and INGEST_MAX_SIZE in bytes.
+func LoadFilter(getenv func(string) string) (Filter, error) {
+	filter := Filter{
+		Include:      list(getenv("INGEST_INCLUDE")),
+		Exclude:      list(getenv("INGEST_EXCLUDE")),
+		ContentTypes: list(getenv("INGEST_CONTENT_TYPES")),
+	}
+
+	var err error
+	if filter.MinSize, err = size("INGEST_MIN_SIZE", getenv("INGEST_MIN_SIZE")); nil != err {
+		return Filter{}, err
+	}
+	if filter.MaxSize, err = size("INGEST_MAX_SIZE", getenv("INGEST_MAX_SIZE")); nil != err {
+		return Filter{}, err
+	}
+
+	if err := filter.Validate(); nil != err {
+		return Filter{}, err
+	}
+
+	return filter, nil
+}
+
+func list(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); "" != item {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+func size(name, value string) (int64, error) {
+	if "" == strings.TrimSpace(value) {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if nil != err || 0 > parsed {
+		return 0, FilterConfigError{Err: fmt.Errorf("invalid %s %s", name, value)}
+	}
+
+	return parsed, nil
+}
+
+// LogSkipped writes a structured log entry for an object the filter skipped.
+func LogSkipped(bucket string, object Object, err error) {
+	entry, _ := json.Marshal(struct {
+		Message     string `json:"message"`
+		Bucket      string `json:"bucket"`
+		Key         string `json:"key"`
+		ContentType string `json:"contentType,omitempty"`
+		Size        *int64 `json:"size,omitempty"`
+		Reason      string `json:"reason"`
+	}{"skipping filtered object", bucket, object.Key, object.ContentType, object.Size, err.Error()})
+
+	log.Print(string(entry))
+}
@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type filterTestSuite struct {
+	suite.Suite
+}
+
+func knownSize(size int64) *int64 {
+	return &size
+}
+
+func environment(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func (s *filterTestSuite) TestCheck() {
+	s.T().Run("lets everything through by default", func(t *testing.T) {
+		assert.Nil(t, Filter{}.Check(Object{Key: "2021/clip.mp4", ContentType: "video/mp4", Size: knownSize(1 << 30)}))
+	})
+
+	s.T().Run("skips excluded file names in any folder", func(t *testing.T) {
+		filter := Filter{Exclude: []string{"*.mp4", "*.xmp", "thumbs.db", ".DS_Store", "._*"}}
+
+		for _, key := range []string{"clip.MP4", "2021/IMG_1234.jpg.xmp", "2021/summer/Thumbs.db", ".DS_Store", "2021/._IMG_1234.jpg"} {
+			err := filter.Check(Object{Key: key})
+
+			assert.True(t, errors.Is(err, SkippedObjectError{}), key)
+		}
+		assert.Nil(t, filter.Check(Object{Key: "2021/IMG_1234.jpg"}))
+	})
+
+	s.T().Run("only lets through included keys", func(t *testing.T) {
+		filter := Filter{Include: []string{"*.jpg", "*.heic", "scans/*"}}
+
+		assert.Nil(t, filter.Check(Object{Key: "2021/IMG_1234.HEIC"}))
+		assert.Nil(t, filter.Check(Object{Key: "scans/page-1.tiff"}))
+		assert.Equal(t, "key notes.txt matches no include pattern", filter.Check(Object{Key: "notes.txt"}).Error())
+	})
+
+	s.T().Run("checks known content types", func(t *testing.T) {
+		filter := Filter{ContentTypes: []string{"image/*", "binary/octet-stream"}}
+
+		assert.Nil(t, filter.Check(Object{Key: "photo.jpg", ContentType: "image/jpeg"}))
+		assert.Nil(t, filter.Check(Object{Key: "photo.jpg", ContentType: "binary/octet-stream"}))
+		assert.Nil(t, filter.Check(Object{Key: "photo.jpg"}))
+		assert.Equal(t, "content type video/mp4 is not allowed", filter.Check(Object{Key: "clip", ContentType: "Video/MP4; codecs=avc1"}).Error())
+	})
+
+	s.T().Run("checks known sizes", func(t *testing.T) {
+		filter := Filter{MinSize: 1024, MaxSize: 1 << 20}
+
+		assert.Nil(t, filter.Check(Object{Key: "photo.jpg", Size: knownSize(2048)}))
+		assert.Nil(t, filter.Check(Object{Key: "photo.jpg"}))
+		assert.Equal(t, "size 12 is below 1024 bytes", filter.Check(Object{Key: "photo.jpg", Size: knownSize(12)}).Error())
+		assert.Equal(t, "size 2097152 is above 1048576 bytes", filter.Check(Object{Key: "photo.jpg", Size: knownSize(2 << 20)}).Error())
+	})
+
+	s.T().Run("skips known zero byte objects below the minimum size", func(t *testing.T) {
+		filter := Filter{MinSize: 1}
+
+		assert.Equal(t, "size 0 is below 1 bytes", filter.Check(Object{Key: "photo.jpg", Size: knownSize(0)}).Error())
+		assert.Nil(t, Filter{}.Check(Object{Key: "photo.jpg", Size: knownSize(0)}))
+	})
+
+	s.T().Run("returns the checked object with the error", func(t *testing.T) {
+		object := Object{Key: "clip", ContentType: "video/mp4", Size: knownSize(512)}
+
+		var skipped SkippedObjectError
+		assert.True(t, errors.As(Filter{ContentTypes: []string{"image/*"}}.Check(object), &skipped))
+		assert.Equal(t, object, skipped.Object)
+	})
+}
+
+func (s *filterTestSuite) TestLoadFilter() {
+	s.T().Run("reads lists and sizes", func(t *testing.T) {
+		filter, err := LoadFilter(environment(map[string]string{
+			"INGEST_INCLUDE":       "",
+			"INGEST_EXCLUDE":       "*.mp4, Thumbs.db,",
+			"INGEST_CONTENT_TYPES": "image/*",
+			"INGEST_MIN_SIZE":      "1024",
+			"INGEST_MAX_SIZE":      "104857600",
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, Filter{
+			Exclude:      []string{"*.mp4", "Thumbs.db"},
+			ContentTypes: []string{"image/*"},
+			MinSize:      1024,
+			MaxSize:      104857600,
+		}, filter)
+	})
+
+	s.T().Run("returns FilterConfigError for invalid settings", func(t *testing.T) {
+		for _, values := range []map[string]string{
+			{"INGEST_EXCLUDE": "[.mp4"},
+			{"INGEST_MIN_SIZE": "small"},
+			{"INGEST_MAX_SIZE": "-1"},
+			{"INGEST_MIN_SIZE": "2048", "INGEST_MAX_SIZE": "1024"},
+		} {
+			_, err := LoadFilter(environment(values))
+
+			assert.True(t, errors.Is(err, FilterConfigError{}), values)
+		}
+	})
+}
+
+func (s *filterTestSuite) TestLogSkipped() {
+	s.T().Run("writes a JSON log entry", func(t *testing.T) {
+		buffer := new(bytes.Buffer)
+		log.SetFlags(0)
+		log.SetOutput(buffer)
+		defer log.SetOutput(os.Stderr)
+		defer log.SetFlags(log.LstdFlags)
+
+		LogSkipped("ingest", Object{Key: "clip.mp4", Size: knownSize(42)}, errors.New("key clip.mp4 matches exclude pattern *.mp4"))
+
+		var entry map[string]interface{}
+		assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry))
+		assert.Equal(t, map[string]interface{}{
+			"message": "skipping filtered object",
+			"bucket":  "ingest",
+			"key":     "clip.mp4",
+			"size":    float64(42),
+			"reason":  "key clip.mp4 matches exclude pattern *.mp4",
+		}, entry)
+	})
+}
+
+func TestFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(filterTestSuite))
+}
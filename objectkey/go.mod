@@ -0,0 +1,10 @@
+// Code shared by resizePhoto and removePhoto: object keys, ingest filtering,
+// batch failure reporting and the hash index layout.
+module github.com/ian-antking/king-family-photos/objectkey
+
+go 1.16
+
+require (
+	github.com/aws/aws-lambda-go v1.29.0
+	github.com/stretchr/testify v1.6.1
+)
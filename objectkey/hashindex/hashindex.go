@@ -0,0 +1,79 @@
+// Package hashindex describes how the perceptual-hash index is laid out in
+// the display bucket, so removePhoto deletes exactly the entries resizePhoto
+// writes.
+package hashindex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const DefaultPrefix = ".hash-index/"
+
+// Layout keeps one empty object per source key under Prefix, named after the
+// source key and its hash as sixteen hex digits, so a single listing of the
+// prefix returns every hash without reading any object.
+type Layout struct {
+	Prefix string
+}
+
+func (l Layout) ObjectKey(sourceKey string, hash uint64) string {
+	return l.EntryPrefix(sourceKey) + string(EncodeHash(hash))
+}
+
+// EntryPrefix is the prefix the entries for sourceKey are written under. It
+// can also match entries for longer keys, so callers check SourceKey too.
+func (l Layout) EntryPrefix(sourceKey string) string {
+	return l.Prefix + sourceKey + "/"
+}
+
+// SourceKey returns the source key and hash an index object was written for.
+func (l Layout) SourceKey(objectKey string) (string, uint64, bool) {
+	separator := strings.LastIndex(objectKey, "/")
+	if !strings.HasPrefix(objectKey, l.Prefix) || len(l.Prefix) >= separator {
+		return "", 0, false
+	}
+
+	hash, ok := DecodeHash([]byte(objectKey[separator+1:]))
+	if !ok {
+		return "", 0, false
+	}
+
+	return objectKey[len(l.Prefix):separator], hash, true
+}
+
+func EncodeHash(hash uint64) []byte {
+	return []byte(fmt.Sprintf("%016x", hash))
+}
+
+func DecodeHash(body []byte) (uint64, bool) {
+	value := strings.TrimSpace(string(body))
+	if 16 != len(value) {
+		return 0, false
+	}
+
+	hash, err := strconv.ParseUint(value, 16, 64)
+	if nil != err {
+		return 0, false
+	}
+
+	return hash, true
+}
+
+// NewLayout trims slashes and spaces from prefix, falling back to
+// DefaultPrefix when nothing is left.
+func NewLayout(prefix string) Layout {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if "" == prefix {
+		return Layout{Prefix: DefaultPrefix}
+	}
+
+	return Layout{Prefix: prefix + "/"}
+}
+
+// LoadLayout reads HASH_INDEX_PREFIX, which must be set the same for both
+// lambdas.
+func LoadLayout(getenv func(string) string) Layout {
+	return NewLayout(getenv("HASH_INDEX_PREFIX"))
+}
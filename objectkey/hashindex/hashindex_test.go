@@ -0,0 +1,81 @@
+package hashindex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type hashIndexTestSuite struct {
+	suite.Suite
+}
+
+func (s *hashIndexTestSuite) TestLayout() {
+	s.T().Run("names entries after the source key and hash under the prefix", func(t *testing.T) {
+		layout := NewLayout(".hash-index/")
+
+		sourceKey, hash, ok := layout.SourceKey(layout.ObjectKey("2021/IMG_1234.jpg", 0xFF))
+
+		assert.Equal(t, ".hash-index/2021/IMG_1234.jpg/00000000000000ff", layout.ObjectKey("2021/IMG_1234.jpg", 0xFF))
+		assert.Equal(t, ".hash-index/2021/IMG_1234.jpg/", layout.EntryPrefix("2021/IMG_1234.jpg"))
+		assert.True(t, ok)
+		assert.Equal(t, "2021/IMG_1234.jpg", sourceKey)
+		assert.Equal(t, uint64(0xFF), hash)
+	})
+
+	s.T().Run("ignores objects outside the prefix or without a hash", func(t *testing.T) {
+		layout := NewLayout(".hash-index/")
+
+		for _, objectKey := range []string{
+			"frame-480/photo.jpg/00000000000000ff",
+			".hash-index/",
+			".hash-index/00000000000000ff",
+			".hash-index//00000000000000ff",
+			".hash-index/photo.jpg",
+			".hash-index/photo.jpg/not-a-hash",
+		} {
+			_, _, ok := layout.SourceKey(objectKey)
+
+			assert.False(t, ok, objectKey)
+		}
+	})
+}
+
+func (s *hashIndexTestSuite) TestHash() {
+	s.T().Run("round trips hashes as sixteen hex digits", func(t *testing.T) {
+		hash, ok := DecodeHash(EncodeHash(0xFF00000000000001))
+
+		assert.Equal(t, []byte("00000000000000ff"), EncodeHash(0xFF))
+		assert.True(t, ok)
+		assert.Equal(t, uint64(0xFF00000000000001), hash)
+	})
+
+	s.T().Run("rejects bodies that are not a hash", func(t *testing.T) {
+		for _, body := range []string{"", "ff", "not-a-hash-value", "00000000000000ff00"} {
+			_, ok := DecodeHash([]byte(body))
+
+			assert.False(t, ok, body)
+		}
+	})
+}
+
+func (s *hashIndexTestSuite) TestLoadLayout() {
+	s.T().Run("defaults the prefix", func(t *testing.T) {
+		assert.Equal(t, Layout{Prefix: DefaultPrefix}, LoadLayout(func(string) string { return "" }))
+		assert.Equal(t, Layout{Prefix: DefaultPrefix}, NewLayout(" / "))
+	})
+
+	s.T().Run("normalises HASH_INDEX_PREFIX to end in a single slash", func(t *testing.T) {
+		layout := LoadLayout(func(name string) string {
+			return map[string]string{"HASH_INDEX_PREFIX": "/hashes"}[name]
+		})
+
+		assert.Equal(t, Layout{Prefix: "hashes/"}, layout)
+		assert.Equal(t, Layout{Prefix: "index/hashes/"}, NewLayout("index/hashes/"))
+	})
+}
+
+func TestHashIndexTestSuite(t *testing.T) {
+	suite.Run(t, new(hashIndexTestSuite))
+}
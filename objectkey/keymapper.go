@@ -0,0 +1,83 @@
+package objectkey
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FoldersPreserve = "preserve"
+	FoldersFlatten  = "flatten"
+
+	// flattenSeparator joins the folders of a flattened key onto its name.
+	flattenSeparator = "_"
+)
+
+// flattenEscaper percent-encodes the separator, and the escape character
+// itself, so flattened keys never collide.
+var flattenEscaper = strings.NewReplacer("%", "%25", flattenSeparator, "%5F")
+
+// KeyMapper maps source keys to the display keys resizePhoto writes to, so
+// removePhoto deletes exactly what was created. Both lambdas build it with
+// LoadKeyMapper from the same environment. No two source keys map to the
+// same display key.
+type KeyMapper struct {
+	// Extension is appended after the source extension, empty adds nothing.
+	Extension string
+	// Flatten joins folders onto the file name instead of keeping them.
+	Flatten bool
+}
+
+func (m KeyMapper) DisplayKey(rendition, sourceKey string) string {
+	key := sourceKey + m.Extension
+	if m.Flatten {
+		key = strings.ReplaceAll(flattenEscaper.Replace(key), "/", flattenSeparator)
+	}
+
+	if "" == rendition {
+		return key
+	}
+
+	return rendition + "/" + key
+}
+
+// Extension returns the file extension written for an OUTPUT_FORMAT.
+func Extension(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "jpeg", "jpg":
+		return ".jpg", nil
+	case "png":
+		return ".png", nil
+	case "webp":
+		return ".webp", nil
+	}
+
+	return "", KeyMapperConfigError{Err: fmt.Errorf("unsupported output format %s", format)}
+}
+
+// LoadKeyMapper reads OUTPUT_FORMAT and DISPLAY_FOLDERS, which must be set
+// the same for both lambdas.
+func LoadKeyMapper(getenv func(string) string) (KeyMapper, error) {
+	extension, err := Extension(getenv("OUTPUT_FORMAT"))
+	if nil != err {
+		return KeyMapper{}, err
+	}
+
+	mapper := NewKeyMapper(extension, false)
+	switch folders := strings.ToLower(strings.TrimSpace(getenv("DISPLAY_FOLDERS"))); folders {
+	case "", FoldersPreserve:
+	case FoldersFlatten:
+		mapper.Flatten = true
+	default:
+		return KeyMapper{}, KeyMapperConfigError{Err: fmt.Errorf("unsupported DISPLAY_FOLDERS %s", folders)}
+	}
+
+	return mapper, nil
+}
+
+func NewKeyMapper(extension string, flatten bool) KeyMapper {
+	return KeyMapper{
+		Extension: extension,
+		Flatten:   flatten,
+	}
+}
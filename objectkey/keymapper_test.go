@@ -0,0 +1,102 @@
+package objectkey
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type keyMapperTestSuite struct {
+	suite.Suite
+}
+
+func environment(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func (s *keyMapperTestSuite) TestDisplayKey() {
+	s.T().Run("appends the output format extension to the source key", func(t *testing.T) {
+		mapper := NewKeyMapper(".jpg", false)
+
+		for source, expected := range map[string]string{
+			"photo.png":              "photo.png.jpg",
+			"2021/IMG_1234.HEIC":     "2021/IMG_1234.HEIC.jpg",
+			"photo.jpg":              "photo.jpg.jpg",
+			"scans/photo":            "scans/photo.jpg",
+			"v1.2/Beach Day (2).dng": "v1.2/Beach Day (2).dng.jpg",
+		} {
+			assert.Equal(t, expected, mapper.DisplayKey("", source))
+		}
+	})
+
+	s.T().Run("prefixes keys with the rendition name", func(t *testing.T) {
+		assert.Equal(t, "thumb-200/2021/photo.png.webp", NewKeyMapper(".webp", false).DisplayKey("thumb-200", "2021/photo.png"))
+	})
+
+	s.T().Run("flattens folders onto the file name", func(t *testing.T) {
+		assert.Equal(t, "frame-480/2021_summer_photo.heic.jpg", NewKeyMapper(".jpg", true).DisplayKey("frame-480", "2021/summer/photo.heic"))
+	})
+
+	s.T().Run("escapes the separator in flattened keys", func(t *testing.T) {
+		mapper := NewKeyMapper(".jpg", true)
+
+		assert.Equal(t, "2021_IMG%5F1234.jpg.jpg", mapper.DisplayKey("", "2021/IMG_1234.jpg"))
+		assert.Equal(t, "100%25_photo.jpg.jpg", mapper.DisplayKey("", "100%/photo.jpg"))
+	})
+
+	s.T().Run("never maps two source keys to the same display key", func(t *testing.T) {
+		sources := []string{
+			"photo.png", "photo.heic", "photo.jpg", "photo", "photo.jpg.jpg",
+			"a/b_c.jpg", "a_b/c.jpg", "a_/b.jpg", "a/_b.jpg", "a%5Fb/c.jpg", "a%/b.jpg",
+		}
+
+		for _, mapper := range []KeyMapper{NewKeyMapper(".jpg", false), NewKeyMapper(".jpg", true)} {
+			seen := map[string]string{}
+			for _, source := range sources {
+				key := mapper.DisplayKey("frame-480", source)
+
+				assert.NotContains(t, seen, key, "%s and %s collide", seen[key], source)
+				seen[key] = source
+			}
+		}
+	})
+
+	s.T().Run("keeps keys unchanged by default", func(t *testing.T) {
+		assert.Equal(t, "2021/photo.png", KeyMapper{}.DisplayKey("", "2021/photo.png"))
+	})
+}
+
+func (s *keyMapperTestSuite) TestLoadKeyMapper() {
+	s.T().Run("defaults to JPEG keys with folders preserved", func(t *testing.T) {
+		mapper, err := LoadKeyMapper(environment(map[string]string{}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, KeyMapper{Extension: ".jpg"}, mapper)
+	})
+
+	s.T().Run("reads the output format and folder handling", func(t *testing.T) {
+		mapper, err := LoadKeyMapper(environment(map[string]string{"OUTPUT_FORMAT": "WebP", "DISPLAY_FOLDERS": "flatten"}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, KeyMapper{Extension: ".webp", Flatten: true}, mapper)
+	})
+
+	s.T().Run("returns KeyMapperConfigError for invalid settings", func(t *testing.T) {
+		for _, values := range []map[string]string{
+			{"OUTPUT_FORMAT": "avif"},
+			{"DISPLAY_FOLDERS": "nested"},
+		} {
+			_, err := LoadKeyMapper(environment(values))
+
+			assert.True(t, errors.Is(err, KeyMapperConfigError{}), values)
+		}
+	})
+}
+
+func TestKeyMapperTestSuite(t *testing.T) {
+	suite.Run(t, new(keyMapperTestSuite))
+}
@@ -0,0 +1,59 @@
+// Package objectkey turns the URL-encoded object keys delivered in S3 event
+// notifications into the keys used to get and delete objects.
+package objectkey
+
+import (
+	"fmt"
+	"net/url"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const maxKeyBytes = 1024
+
+// FromRecord returns the decoded key of the object in record. The
+// URLDecodedKey filled in when the event is unmarshalled is preferred, and
+// Key is decoded for records that were built without it.
+func FromRecord(record events.S3EventRecord) (string, error) {
+	if key := record.S3.Object.URLDecodedKey; "" != key {
+		return key, Validate(key)
+	}
+
+	return Decode(record.S3.Object.Key)
+}
+
+// Decode reverses the form encoding S3 applies to event keys, where spaces
+// are sent as + and reserved characters percent-encoded.
+func Decode(encoded string) (string, error) {
+	key, err := url.QueryUnescape(encoded)
+	if nil != err {
+		return "", InvalidKeyError{Err: fmt.Errorf("error decoding key %s: %s", encoded, err.Error())}
+	}
+
+	return key, Validate(key)
+}
+
+// Validate rejects keys S3 would never have stored.
+func Validate(key string) error {
+	if "" == key {
+		return InvalidKeyError{Err: fmt.Errorf("key must not be empty")}
+	}
+
+	if maxKeyBytes < len(key) {
+		return InvalidKeyError{Err: fmt.Errorf("key %.32s... is longer than %d bytes", key, maxKeyBytes)}
+	}
+
+	if !utf8.ValidString(key) {
+		return InvalidKeyError{Err: fmt.Errorf("key %q is not valid UTF-8", key)}
+	}
+
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return InvalidKeyError{Err: fmt.Errorf("key %q contains control characters", key)}
+		}
+	}
+
+	return nil
+}
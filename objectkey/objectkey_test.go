@@ -0,0 +1,88 @@
+package objectkey
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type objectKeyTestSuite struct {
+	suite.Suite
+}
+
+func (s *objectKeyTestSuite) TestDecode() {
+	s.T().Run("decodes spaces, reserved characters and unicode", func(t *testing.T) {
+		for encoded, expected := range map[string]string{
+			"photo.jpg":                            "photo.jpg",
+			"2021/Beach+Day+%282%29.jpg":           "2021/Beach Day (2).jpg",
+			"Caf%C3%A9+%C3%A0+Paris.heic":          "Café à Paris.heic",
+			"%E5%AE%B6%E6%97%8F/%F0%9F%8E%89.png":  "家族/🎉.png",
+			"50%25+off%2C+%26+more%3F%2B%23.jpg":   "50% off, & more?+#.jpg",
+			"albums/Mum%27s+%5Bbest%5D/photo.jpeg": "albums/Mum's [best]/photo.jpeg",
+		} {
+			key, err := Decode(encoded)
+
+			assert.Nil(t, err, encoded)
+			assert.Equal(t, expected, key)
+		}
+	})
+
+	s.T().Run("returns InvalidKeyError for malformed encoding", func(t *testing.T) {
+		_, err := Decode("photo%2.jpg")
+
+		assert.True(t, errors.Is(err, InvalidKeyError{}))
+		assert.Contains(t, err.Error(), "error decoding key photo%2.jpg")
+	})
+}
+
+func (s *objectKeyTestSuite) TestValidate() {
+	s.T().Run("returns InvalidKeyError for keys S3 cannot store", func(t *testing.T) {
+		for _, key := range []string{
+			"",
+			strings.Repeat("a", 1025),
+			"photo\xff.jpg",
+			"photo\n.jpg",
+		} {
+			assert.True(t, errors.Is(Validate(key), InvalidKeyError{}), key)
+		}
+	})
+
+	s.T().Run("accepts keys up to 1024 bytes", func(t *testing.T) {
+		assert.Nil(t, Validate(strings.Repeat("a", 1024)))
+	})
+}
+
+func (s *objectKeyTestSuite) TestFromRecord() {
+	s.T().Run("prefers the key decoded when the event was unmarshalled", func(t *testing.T) {
+		var event events.S3Event
+		err := json.Unmarshal([]byte(`{"Records":[{"s3":{"object":{"key":"Beach+Day+%282%29.jpg"}}}]}`), &event)
+		assert.Nil(t, err)
+
+		key, err := FromRecord(event.Records[0])
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Beach Day (2).jpg", key)
+	})
+
+	s.T().Run("decodes the key of records built without a decoded key", func(t *testing.T) {
+		key, err := FromRecord(events.S3EventRecord{S3: events.S3Entity{Object: events.S3Object{Key: "Beach+Day+%282%29.jpg"}}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Beach Day (2).jpg", key)
+	})
+
+	s.T().Run("returns InvalidKeyError for records without a key", func(t *testing.T) {
+		_, err := FromRecord(events.S3EventRecord{})
+
+		assert.True(t, errors.Is(err, InvalidKeyError{}))
+	})
+}
+
+func TestObjectKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(objectKeyTestSuite))
+}
@@ -0,0 +1,69 @@
+package objectkey
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var renditionName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// RenditionProfile is one name:WIDTHxHEIGHT[:fit] entry of RENDITIONS. The
+// name prefixes display keys, so both lambdas must read it the same way.
+// Size and FitMode are left as written for resizePhoto to interpret.
+type RenditionProfile struct {
+	Name    string
+	Size    string
+	FitMode string
+}
+
+// ParseRenditions splits comma-separated RENDITIONS profiles and checks
+// their names.
+func ParseRenditions(value string) ([]RenditionProfile, error) {
+	var profiles []RenditionProfile
+	names := map[string]bool{}
+
+	for _, entry := range strings.Split(value, ",") {
+		if "" == strings.TrimSpace(entry) {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if 2 != len(parts) && 3 != len(parts) {
+			return nil, RenditionsConfigError{Err: fmt.Errorf("invalid RENDITIONS profile %s, expected name:WIDTHxHEIGHT[:fit]", entry)}
+		}
+
+		profile := RenditionProfile{Name: strings.TrimSpace(parts[0]), Size: strings.TrimSpace(parts[1])}
+		if 3 == len(parts) {
+			profile.FitMode = strings.TrimSpace(parts[2])
+		}
+
+		if !renditionName.MatchString(profile.Name) {
+			return nil, RenditionsConfigError{Err: fmt.Errorf("invalid RENDITIONS name %s, expected lowercase letters, digits and dashes", profile.Name)}
+		}
+		if names[profile.Name] {
+			return nil, RenditionsConfigError{Err: fmt.Errorf("duplicate RENDITIONS name %s", profile.Name)}
+		}
+		names[profile.Name] = true
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// RenditionNames returns the names of the RENDITIONS profiles, or nil when
+// photos are written without a rendition prefix.
+func RenditionNames(value string) ([]string, error) {
+	profiles, err := ParseRenditions(value)
+	if nil != err {
+		return nil, err
+	}
+
+	var names []string
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,59 @@
+package objectkey
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type renditionsTestSuite struct {
+	suite.Suite
+}
+
+func (s *renditionsTestSuite) TestParseRenditions() {
+	s.T().Run("splits profiles into names, sizes and fit modes", func(t *testing.T) {
+		profiles, err := ParseRenditions("frame-480:0x480, thumb-200:200x200:fill,")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []RenditionProfile{
+			{Name: "frame-480", Size: "0x480"},
+			{Name: "thumb-200", Size: "200x200", FitMode: "fill"},
+		}, profiles)
+	})
+
+	s.T().Run("returns RenditionsConfigError for invalid profiles", func(t *testing.T) {
+		for _, value := range []string{
+			"frame-480",
+			"Frame:0x480",
+			"frame/480:0x480",
+			"frame:0x480:fit:extra",
+			"frame:0x480,frame:0x1080",
+		} {
+			_, err := ParseRenditions(value)
+
+			assert.True(t, errors.Is(err, RenditionsConfigError{}), value)
+		}
+	})
+}
+
+func (s *renditionsTestSuite) TestRenditionNames() {
+	s.T().Run("reads rendition names from profiles", func(t *testing.T) {
+		names, err := RenditionNames("frame-480:0x480, thumb-200:200x200:fill,")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"frame-480", "thumb-200"}, names)
+	})
+
+	s.T().Run("returns nil without profiles", func(t *testing.T) {
+		names, err := RenditionNames("")
+
+		assert.Nil(t, err)
+		assert.Nil(t, names)
+	})
+}
+
+func TestRenditionsTestSuite(t *testing.T) {
+	suite.Run(t, new(renditionsTestSuite))
+}
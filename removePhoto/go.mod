@@ -3,8 +3,9 @@ module github.com/ian-antking/king-family-photos/removePhoto
 go 1.17
 
 require (
-	github.com/aws/aws-lambda-go v1.27.1
+	github.com/aws/aws-lambda-go v1.29.0
 	github.com/aws/aws-sdk-go v1.42.27
+	github.com/ian-antking/king-family-photos/objectkey v0.0.0
 	github.com/stretchr/testify v1.6.1
 )
 
@@ -15,3 +16,5 @@ require (
 	github.com/stretchr/objx v0.1.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
+
+replace github.com/ian-antking/king-family-photos/objectkey => ../objectkey
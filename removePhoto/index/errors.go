@@ -0,0 +1,21 @@
+package index
+
+type RemoveIndexError struct {
+	Err error
+}
+
+func (err RemoveIndexError) Unwrap() error {
+	return err.Err
+}
+
+func (err RemoveIndexError) Error() string {
+	return err.Err.Error()
+}
+
+func (err RemoveIndexError) Is(target error) bool {
+	_, ok := target.(RemoveIndexError)
+	if !ok {
+		_, ok = target.(*RemoveIndexError)
+	}
+	return ok
+}
@@ -0,0 +1,5 @@
+package index
+
+type Repository interface {
+	Remove(key string) error
+}
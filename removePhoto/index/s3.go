@@ -0,0 +1,66 @@
+package index
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+)
+
+type s3Client interface {
+	ListObjectsV2Pages(*s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool) error
+	DeleteObject(*s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+}
+
+// S3 removes entries written by resizePhoto, which are named after the
+// source key and hash under the index prefix.
+type S3 struct {
+	client s3Client
+	bucket string
+	layout hashindex.Layout
+}
+
+// Remove lists the entries written for key, which only matches the objects
+// under that key's own prefix, and deletes each of them.
+func (s *S3) Remove(key string) error {
+	var objectKeys []string
+	listObjectsInput := s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.layout.EntryPrefix(key)),
+	}
+
+	err := s.client.ListObjectsV2Pages(&listObjectsInput, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			if sourceKey, _, ok := s.layout.SourceKey(aws.StringValue(object.Key)); ok && key == sourceKey {
+				objectKeys = append(objectKeys, aws.StringValue(object.Key))
+			}
+		}
+		return true
+	})
+
+	if nil != err {
+		return RemoveIndexError{Err: fmt.Errorf("error listing index entries for %s: %s", key, err.Error())}
+	}
+
+	for _, objectKey := range objectKeys {
+		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(objectKey),
+		})
+
+		if nil != err {
+			return RemoveIndexError{Err: fmt.Errorf("error removing index entry for %s: %s", key, err.Error())}
+		}
+	}
+
+	return nil
+}
+
+func NewS3(client s3Client, bucket string, layout hashindex.Layout) S3 {
+	return S3{
+		client: client,
+		bucket: bucket,
+		layout: layout,
+	}
+}
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type s3TestSuite struct {
+	suite.Suite
+	client *mockS3Client
+}
+
+func (s *s3TestSuite) setUpMocks() {
+	s.client = new(mockS3Client)
+}
+
+func listing(keys ...string) *s3.ListObjectsV2Output {
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+
+	return output
+}
+
+func (s *s3TestSuite) TestRemove() {
+	s.T().Run("deletes the entries held for the key", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("ListObjectsV2Pages", &s3.ListObjectsV2Input{
+			Bucket: aws.String("displayBucket"),
+			Prefix: aws.String(".hash-index/2021/"),
+		}).Return([]*s3.ListObjectsV2Output{listing(
+			".hash-index/2021/00000000000000aa",
+			".hash-index/2021/photo.jpg/00000000000000bb",
+		)}, nil)
+		s.client.On("DeleteObject", &s3.DeleteObjectInput{
+			Bucket: aws.String("displayBucket"),
+			Key:    aws.String(".hash-index/2021/00000000000000aa"),
+		}).Return(&s3.DeleteObjectOutput{}, nil)
+
+		err := hashIndex.Remove("2021")
+
+		assert.Nil(t, err)
+		s.client.AssertNumberOfCalls(t, "DeleteObject", 1)
+	})
+
+	s.T().Run("returns RemoveIndexError when listing fails", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{}, errors.New("access denied"))
+
+		err := hashIndex.Remove("photo.jpg")
+
+		assert.True(t, errors.Is(err, RemoveIndexError{}))
+		assert.Equal(t, "error listing index entries for photo.jpg: access denied", err.Error())
+	})
+
+	s.T().Run("returns RemoveIndexError when deleting fails", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{listing(".hash-index/photo.jpg/00000000000000aa")}, nil)
+		s.client.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, errors.New("slow down"))
+
+		err := hashIndex.Remove("photo.jpg")
+
+		assert.True(t, errors.Is(err, RemoveIndexError{}))
+		assert.Equal(t, "error removing index entry for photo.jpg: slow down", err.Error())
+	})
+}
+
+type mockS3Client struct {
+	mock.Mock
+}
+
+func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, page func(*s3.ListObjectsV2Output, bool) bool) error {
+	args := m.Called(input)
+	pages := args.Get(0).([]*s3.ListObjectsV2Output)
+	for i, output := range pages {
+		if !page(output, i == len(pages)-1) {
+			break
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
+func TestS3TestSuite(t *testing.T) {
+	suite.Run(t, new(s3TestSuite))
+}
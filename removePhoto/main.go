@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -9,51 +10,132 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+	"github.com/ian-antking/king-family-photos/removePhoto/index"
 	"github.com/ian-antking/king-family-photos/removePhoto/photo"
 )
 
 type Handler struct {
 	displayBucketName string
 	photoRepository   photo.Repository
+	renditions        []string
+	keys              objectkey.KeyMapper
+	filter            filter.Filter
+	hashIndex         index.Repository
 }
 
 func (h *Handler) Run(_ context.Context, s3Event events.S3Event) error {
-	params := h.getPhotoParams(s3Event)
+	failures := batch.KeyFailures(s3Event)
+	for _, key := range h.objectKeys(s3Event) {
+		if err := h.removePhoto(key); nil != err {
+			failures = append(failures, batch.Failure{Key: key, Err: err})
+		}
+	}
 
-	for _, param := range params {
-		err := h.photoRepository.Delete(param)
+	return batch.NewError(failures)
+}
 
-		if nil != err {
+// RunSQS handles S3 events queued through SQS, reporting the messages whose
+// photos failed so only those are retried.
+func (h *Handler) RunSQS(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	return batch.RunSQS(sqsEvent, func(s3Event events.S3Event) error {
+		return h.Run(ctx, s3Event)
+	}), nil
+}
+
+// removePhoto deletes every rendition of a photo before its hash index
+// entry, so a failed removal is retried in full.
+func (h *Handler) removePhoto(key string) error {
+	for _, param := range h.getPhotoParams([]string{key}) {
+		if err := h.photoRepository.Delete(param); nil != err {
 			return err
 		}
 	}
 
-	return nil
+	return h.hashIndex.Remove(key)
 }
 
-func (h *Handler) getPhotoParams(s3Event events.S3Event) []photo.DeletePhotoParams {
+// objectKeys decodes the keys of the removed photos, skipping records whose
+// key cannot be decoded or that resizePhoto would have filtered out. Removal
+// events carry no size or content type, so only the key is checked.
+func (h *Handler) objectKeys(s3Event events.S3Event) []string {
+	var keys []string
+	for _, record := range s3Event.Records {
+		key, err := objectkey.FromRecord(record)
+		if nil != err {
+			log.Printf("skipping record from %s: %s", record.S3.Bucket.Name, err.Error())
+			continue
+		}
+
+		object := filter.Object{Key: key}
+		if err := h.filter.Check(object); nil != err {
+			filter.LogSkipped(record.S3.Bucket.Name, object, err)
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (h *Handler) getPhotoParams(keys []string) []photo.DeletePhotoParams {
 	var params []photo.DeletePhotoParams
 
-	for _, record := range s3Event.Records {
-		params = append(params, photo.DeletePhotoParams{
-			Bucket: h.displayBucketName,
-			Key:    record.S3.Object.Key,
-		})
+	renditions := h.renditions
+	if 0 == len(renditions) {
+		renditions = []string{""}
+	}
+
+	for _, key := range keys {
+		for _, rendition := range renditions {
+			params = append(params, photo.DeletePhotoParams{
+				Bucket: h.displayBucketName,
+				Key:    h.keys.DisplayKey(rendition, key),
+			})
+		}
 	}
 
 	return params
 }
 
-func NewHandler(bucketName string, repository photo.Repository) Handler {
+func NewHandler(bucketName string, repository photo.Repository, renditions []string, keys objectkey.KeyMapper, ingestFilter filter.Filter, hashIndex index.Repository) Handler {
 	return Handler{
 		displayBucketName: bucketName,
 		photoRepository:   repository,
+		renditions:        renditions,
+		keys:              keys,
+		filter:            ingestFilter,
+		hashIndex:         hashIndex,
 	}
 }
 
 func main() {
 	displayBucketName := os.Getenv("DISPLAY_BUCKET")
 
+	keys, err := objectkey.LoadKeyMapper(os.Getenv)
+	if nil != err {
+		log.Fatalln(err.Error())
+	}
+
+	ingestFilter, err := filter.LoadFilter(os.Getenv)
+	if nil != err {
+		log.Fatalln(err.Error())
+	}
+
+	source, err := batch.LoadSource(os.Getenv)
+	if nil != err {
+		log.Fatalln(err.Error())
+	}
+
+	renditions, err := objectkey.RenditionNames(os.Getenv("RENDITIONS"))
+	if nil != err {
+		log.Fatalln(err.Error())
+	}
+
 	awsSession := session.Must(session.NewSessionWithOptions(
 		session.Options{
 			SharedConfigState: session.SharedConfigEnable,
@@ -62,8 +144,13 @@ func main() {
 
 	s3Client := s3.New(awsSession)
 	photoRepository := photo.NewS3(s3Client)
+	hashIndex := index.NewS3(s3Client, displayBucketName, hashindex.LoadLayout(os.Getenv))
 
-	handler := NewHandler(displayBucketName, &photoRepository)
+	handler := NewHandler(displayBucketName, &photoRepository, renditions, keys, ingestFilter, &hashIndex)
 
-	lambda.Start(handler.Run)
+	if batch.SourceSQS == source {
+		lambda.Start(handler.RunSQS)
+	} else {
+		lambda.Start(handler.Run)
+	}
 }
@@ -10,18 +10,22 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
 	"github.com/ian-antking/king-family-photos/removePhoto/photo"
 )
 
 type handlerTestSuite struct {
 	suite.Suite
 	photoRepository *mockPhotoRepository
+	hashIndex       *mockHashIndex
 }
 
 func (s *handlerTestSuite) TestGetPhotoParams() {
 	s.T().Run("converts records on an S3Event to DeletePhotoParams", func(t *testing.T) {
 		s.setupMocks()
-		handler := NewHandler("displayBucket", s.photoRepository)
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
 		event := events.S3Event{
 			Records: []events.S3EventRecord{
 				{
@@ -43,16 +47,110 @@ func (s *handlerTestSuite) TestGetPhotoParams() {
 			},
 		}
 
-		result := handler.getPhotoParams(event)
+		result := handler.getPhotoParams(handler.objectKeys(event))
 
 		assert.Equal(t, expected, result)
 	})
 }
 
+func (s *handlerTestSuite) TestGetPhotoParamsRenditions() {
+	s.T().Run("deletes every rendition of a photo", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, []string{"frame-480", "thumb-200"}, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{
+							Name: "ingestBucket",
+						},
+						Object: events.S3Object{
+							Key: "2021/photoKey",
+						},
+					},
+				},
+			},
+		}
+		expected := []photo.DeletePhotoParams{
+			{
+				Bucket: "displayBucket",
+				Key:    "frame-480/2021/photoKey",
+			},
+			{
+				Bucket: "displayBucket",
+				Key:    "thumb-200/2021/photoKey",
+			},
+		}
+
+		result := handler.getPhotoParams(handler.objectKeys(event))
+
+		assert.Equal(t, expected, result)
+	})
+}
+
+func (s *handlerTestSuite) TestGetPhotoParamsDisplayKeys() {
+	s.T().Run("deletes the display keys resizePhoto wrote", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, []string{"frame-480"}, objectkey.NewKeyMapper(".jpg", true), filter.Filter{}, s.hashIndex)
+
+		result := handler.getPhotoParams([]string{"2021/Beach Day (2).HEIC"})
+
+		assert.Equal(t, []photo.DeletePhotoParams{{Bucket: "displayBucket", Key: "frame-480/2021_Beach Day (2).HEIC.jpg"}}, result)
+	})
+}
+
+func (s *handlerTestSuite) TestObjectKeys() {
+	s.T().Run("decodes keys and skips records with invalid keys", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Object: events.S3Object{
+							Key: "2021/Beach+Day+%282%29.jpg",
+						},
+					},
+				},
+				{
+					S3: events.S3Entity{
+						Object: events.S3Object{
+							Key: "photo%2.jpg",
+						},
+					},
+				},
+				{
+					S3: events.S3Entity{
+						Object: events.S3Object{
+							Key: "%E5%AE%B6%E6%97%8F/Caf%C3%A9.jpg",
+						},
+					},
+				},
+			},
+		}
+
+		assert.Equal(t, []string{"2021/Beach Day (2).jpg", "家族/Café.jpg"}, handler.objectKeys(event))
+	})
+
+	s.T().Run("skips keys the ingest filter excludes", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{Exclude: []string{"*.xmp", ".DS_Store"}}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Object: events.S3Object{Key: "2021/IMG_1234.jpg.xmp"}}},
+				{S3: events.S3Entity{Object: events.S3Object{Key: "2021/.DS_Store"}}},
+				{S3: events.S3Entity{Object: events.S3Object{Key: "2021/IMG_1234.jpg"}}},
+			},
+		}
+
+		assert.Equal(t, []string{"2021/IMG_1234.jpg"}, handler.objectKeys(event))
+	})
+}
+
 func (s *handlerTestSuite) TestRun() {
 	s.T().Run("processes s3 event and deletes photos from display bucket", func(t *testing.T) {
 		s.setupMocks()
-		handler := NewHandler("displayBucket", s.photoRepository)
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
 		event := events.S3Event{
 			Records: []events.S3EventRecord{
 				{
@@ -81,14 +179,16 @@ func (s *handlerTestSuite) TestRun() {
 			Bucket: "displayBucket",
 			Key:    "photoKey",
 		}).Twice().Return(nil)
+		s.hashIndex.On("Remove", "photoKey").Twice().Return(nil)
 		err := handler.Run(context.Background(), event)
 
 		assert.Nil(t, err)
+		s.hashIndex.AssertExpectations(t)
 	})
 
 	s.T().Run("processes s3 event and deletes photos from display bucket", func(t *testing.T) {
 		s.setupMocks()
-		handler := NewHandler("displayBucket", s.photoRepository)
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
 		event := events.S3Event{
 			Records: []events.S3EventRecord{
 				{
@@ -109,12 +209,130 @@ func (s *handlerTestSuite) TestRun() {
 		}).Once().Return(errors.New("something went wrong"))
 		err := handler.Run(context.Background(), event)
 
-		assert.Equal(t, "something went wrong", err.Error())
+		assert.Equal(t, "failed records: photoKey: something went wrong", err.Error())
+		s.hashIndex.AssertNotCalled(t, "Remove", mock.Anything)
+	})
+
+	s.T().Run("deletes photos by their decoded key", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, []string{"frame-480"}, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Object: events.S3Object{
+							Key: "Beach+Day+%282%29.jpg",
+						},
+					},
+				},
+			},
+		}
+		s.photoRepository.On("Delete", photo.DeletePhotoParams{
+			Bucket: "displayBucket",
+			Key:    "frame-480/Beach Day (2).jpg",
+		}).Once().Return(nil)
+		s.hashIndex.On("Remove", "Beach Day (2).jpg").Once().Return(nil)
+		err := handler.Run(context.Background(), event)
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertExpectations(t)
+		s.hashIndex.AssertExpectations(t)
+	})
+
+	s.T().Run("returns errors from removing the hash index entry", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Object: events.S3Object{
+							Key: "photoKey",
+						},
+					},
+				},
+			},
+		}
+		s.photoRepository.On("Delete", mock.Anything).Return(nil)
+		s.hashIndex.On("Remove", "photoKey").Return(errors.New("access denied"))
+		err := handler.Run(context.Background(), event)
+
+		assert.Equal(t, "failed records: photoKey: access denied", err.Error())
+	})
+
+	s.T().Run("removes the other photos when one fails", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, []string{"frame-480", "thumb-200"}, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Object: events.S3Object{Key: "IMG_1234.jpg"}}},
+				{S3: events.S3Entity{Object: events.S3Object{Key: "IMG_1300.jpg"}}},
+				{S3: events.S3Entity{Object: events.S3Object{Key: "IMG_1400.jpg"}}},
+			},
+		}
+		s.photoRepository.On("Delete", photo.DeletePhotoParams{
+			Bucket: "displayBucket",
+			Key:    "frame-480/IMG_1234.jpg",
+		}).Return(errors.New("something went wrong"))
+		s.photoRepository.On("Delete", mock.Anything).Return(nil)
+		s.hashIndex.On("Remove", "IMG_1300.jpg").Return(errors.New("access denied"))
+		s.hashIndex.On("Remove", "IMG_1400.jpg").Return(nil)
+		err := handler.Run(context.Background(), event)
+
+		var batchErr batch.BatchError
+		assert.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, "failed records: IMG_1234.jpg: something went wrong; IMG_1300.jpg: access denied", err.Error())
+		s.photoRepository.AssertNumberOfCalls(t, "Delete", 5)
+		s.hashIndex.AssertCalled(t, "Remove", "IMG_1400.jpg")
+		s.hashIndex.AssertNotCalled(t, "Remove", "IMG_1234.jpg")
+	})
+}
+
+func (s *handlerTestSuite) TestRunSQS() {
+	s.T().Run("reports the messages whose photos failed", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		body := func(key string) string {
+			return `{"Records":[{"s3":{"bucket":{"name":"ingestBucket"},"object":{"key":"` + key + `"}}}]}`
+		}
+		s.photoRepository.On("Delete", mock.Anything).Return(nil)
+		s.hashIndex.On("Remove", "Beach Day.jpg").Return(errors.New("access denied"))
+		s.hashIndex.On("Remove", "photoKey").Return(nil)
+		response, err := handler.RunSQS(context.Background(), events.SQSEvent{
+			Records: []events.SQSMessage{
+				{MessageId: "1", Body: body("photoKey")},
+				{MessageId: "2", Body: body("Beach+Day.jpg")},
+			},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+	})
+
+	s.T().Run("reports the messages whose key cannot be decoded", func(t *testing.T) {
+		s.setupMocks()
+		handler := NewHandler("displayBucket", s.photoRepository, nil, objectkey.KeyMapper{}, filter.Filter{}, s.hashIndex)
+		body := func(key string) string {
+			return `{"Records":[{"s3":{"bucket":{"name":"ingestBucket"},"object":{"key":"` + key + `"}}}]}`
+		}
+		s.photoRepository.On("Delete", mock.Anything).Return(nil)
+		s.hashIndex.On("Remove", "photoKey").Return(nil)
+		response, err := handler.RunSQS(context.Background(), events.SQSEvent{
+			Records: []events.SQSMessage{
+				{MessageId: "1", Body: body("photoKey")},
+				{MessageId: "2", Body: body("")},
+			},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+		s.hashIndex.AssertNumberOfCalls(t, "Remove", 1)
 	})
 }
 
 func (s *handlerTestSuite) setupMocks() {
 	s.photoRepository = new(mockPhotoRepository)
+	s.hashIndex = new(mockHashIndex)
 }
 
 type mockPhotoRepository struct {
@@ -126,6 +344,15 @@ func (m *mockPhotoRepository) Delete(params photo.DeletePhotoParams) error {
 	return args.Error(0)
 }
 
+type mockHashIndex struct {
+	mock.Mock
+}
+
+func (m *mockHashIndex) Remove(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
 func TestHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(handlerTestSuite))
 }
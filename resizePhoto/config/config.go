@@ -0,0 +1,516 @@
+package config
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
+)
+
+const (
+	DefaultWidth        uint = 0
+	DefaultHeight       uint = 480
+	MaxDimension        uint = 8192
+	DefaultFitMode           = processor.FitModeFit
+	DefaultQuality           = processor.DefaultQuality
+	DefaultFormat            = processor.FormatJPEG
+	DefaultFilter            = processor.FilterLanczos3
+	DefaultMaxDistance       = 6
+	DefaultWorkers           = 4
+	DefaultMemoryBudget      = 64 << 20
+)
+
+var DefaultPadColour = color.NRGBA{A: 0xFF}
+
+// Duplicates configures perceptual-hash duplicate detection. The index is
+// kept in the display bucket as laid out by Index.
+type Duplicates struct {
+	Enabled     bool
+	MaxDistance int
+	Index       hashindex.Layout
+}
+
+// Concurrency bounds how many records are processed at once, and the total
+// size in bytes of the source photos they hold.
+type Concurrency struct {
+	Workers      int
+	MemoryBudget int
+}
+
+type Config struct {
+	DisplayBucket  string
+	Width          uint
+	Height         uint
+	FitMode        processor.FitMode
+	PadColour      color.NRGBA
+	Encoder        processor.EncoderConfig
+	Keys           objectkey.KeyMapper
+	Ingest         filter.Filter
+	MetadataPolicy processor.MetadataPolicy
+	Renditions     []Rendition
+	Stages         []string
+	Limits         processor.Limits
+	QualityGate    processor.QualityGate
+	Enhancement    processor.Enhancement
+	Filter         processor.Filter
+	Sharpening     processor.Sharpening
+	Overlay        processor.Overlay
+	Duplicates     Duplicates
+	Concurrency    Concurrency
+	Source         string
+}
+
+func (c Config) ResizerOptions(rendition Rendition) ([]processor.ResizerOption, error) {
+	encoder, err := processor.NewEncoder(c.Encoder)
+	if nil != err {
+		return nil, err
+	}
+
+	return []processor.ResizerOption{
+		processor.WithFitMode(rendition.FitMode),
+		processor.WithPadColour(c.PadColour),
+		processor.WithEncoder(encoder),
+		processor.WithMetadataPolicy(c.MetadataPolicy),
+		processor.WithStages(c.Stages...),
+		processor.WithLimits(c.Limits),
+		processor.WithQualityGate(c.QualityGate),
+		processor.WithEnhancement(c.Enhancement),
+		processor.WithFilter(c.Filter),
+		processor.WithSharpening(c.Sharpening),
+		processor.WithOverlay(c.Overlay),
+	}, nil
+}
+
+func Load(getenv func(string) string) (Config, error) {
+	config := Config{
+		DisplayBucket: strings.TrimSpace(getenv("DISPLAY_BUCKET")),
+		Width:         DefaultWidth,
+		Height:        DefaultHeight,
+		FitMode:       DefaultFitMode,
+		PadColour:     DefaultPadColour,
+		Encoder:       processor.EncoderConfig{Format: DefaultFormat, Quality: DefaultQuality},
+		Limits:        processor.DefaultLimits(),
+		QualityGate:   processor.DefaultQualityGate(),
+		Enhancement:   processor.DefaultEnhancement(),
+		Filter:        DefaultFilter,
+		Sharpening:    processor.DefaultSharpening(),
+		Overlay:       processor.DefaultOverlay(),
+		Duplicates:    Duplicates{Enabled: true, MaxDistance: DefaultMaxDistance, Index: hashindex.NewLayout(hashindex.DefaultPrefix)},
+		Concurrency:   Concurrency{Workers: DefaultWorkers, MemoryBudget: DefaultMemoryBudget},
+	}
+
+	if "" == config.DisplayBucket {
+		return Config{}, ConfigError{Err: fmt.Errorf("DISPLAY_BUCKET must be set")}
+	}
+
+	var err error
+	if config.Width, err = dimension("RESIZE_WIDTH", getenv("RESIZE_WIDTH"), config.Width); nil != err {
+		return Config{}, err
+	}
+	if config.Height, err = dimension("RESIZE_HEIGHT", getenv("RESIZE_HEIGHT"), config.Height); nil != err {
+		return Config{}, err
+	}
+	if 0 == config.Width && 0 == config.Height {
+		return Config{}, ConfigError{Err: fmt.Errorf("RESIZE_WIDTH and RESIZE_HEIGHT cannot both be 0")}
+	}
+
+	if mode := getenv("FIT_MODE"); "" != strings.TrimSpace(mode) {
+		if config.FitMode, err = processor.ParseFitMode(mode); nil != err {
+			return Config{}, ConfigError{Err: fmt.Errorf("invalid FIT_MODE: %s", err.Error())}
+		}
+	}
+
+	if config.Renditions, err = renditions(getenv("RENDITIONS"), Rendition{Width: config.Width, Height: config.Height, FitMode: config.FitMode}); nil != err {
+		return Config{}, err
+	}
+
+	if filter := getenv("RESAMPLING_FILTER"); "" != strings.TrimSpace(filter) {
+		if config.Filter, err = processor.ParseFilter(filter); nil != err {
+			return Config{}, ConfigError{Err: fmt.Errorf("invalid RESAMPLING_FILTER: %s", err.Error())}
+		}
+	}
+
+	if colour := getenv("PAD_COLOUR"); "" != strings.TrimSpace(colour) {
+		if config.PadColour, err = processor.ParseColour(colour); nil != err {
+			return Config{}, ConfigError{Err: fmt.Errorf("invalid PAD_COLOUR: %s", err.Error())}
+		}
+	}
+
+	if config.Encoder, err = encoderConfig(getenv("OUTPUT_FORMAT"), getenv("OUTPUT_QUALITY"), getenv("OUTPUT_PROGRESSIVE")); nil != err {
+		return Config{}, err
+	}
+
+	if config.Keys, err = objectkey.LoadKeyMapper(getenv); nil != err {
+		return Config{}, ConfigError{Err: fmt.Errorf("invalid display keys: %s", err.Error())}
+	}
+
+	if config.Ingest, err = filter.LoadFilter(getenv); nil != err {
+		return Config{}, ConfigError{Err: fmt.Errorf("invalid ingest filter: %s", err.Error())}
+	}
+
+	if config.Source, err = batch.LoadSource(getenv); nil != err {
+		return Config{}, ConfigError{Err: fmt.Errorf("invalid event source: %s", err.Error())}
+	}
+
+	if config.MetadataPolicy, err = metadataPolicy(getenv("METADATA_ALLOW"), getenv("METADATA_REWRITE")); nil != err {
+		return Config{}, ConfigError{Err: fmt.Errorf("invalid metadata policy: %s", err.Error())}
+	}
+
+	if config.Limits.MaxPixels, err = limit("MAX_PIXELS", getenv("MAX_PIXELS"), config.Limits.MaxPixels); nil != err {
+		return Config{}, err
+	}
+	if config.Limits.MaxBytes, err = limit("MAX_BYTES", getenv("MAX_BYTES"), config.Limits.MaxBytes); nil != err {
+		return Config{}, err
+	}
+
+	if config.Stages, err = stages(getenv("PIPELINE_STAGES")); nil != err {
+		return Config{}, err
+	}
+
+	if config.QualityGate, err = qualityGate(getenv, config.QualityGate); nil != err {
+		return Config{}, err
+	}
+
+	if config.Enhancement, err = enhancement(getenv, config.Enhancement); nil != err {
+		return Config{}, err
+	}
+
+	if config.Sharpening, err = sharpening(getenv, config.Sharpening); nil != err {
+		return Config{}, err
+	}
+
+	if config.Overlay, err = overlay(getenv, config.Overlay); nil != err {
+		return Config{}, err
+	}
+
+	if config.Duplicates, err = duplicates(getenv, config.Duplicates); nil != err {
+		return Config{}, err
+	}
+
+	if config.Concurrency.Workers, err = limit("WORKERS", getenv("WORKERS"), config.Concurrency.Workers); nil != err {
+		return Config{}, err
+	}
+	if config.Concurrency.MemoryBudget, err = limit("MEMORY_BUDGET", getenv("MEMORY_BUDGET"), config.Concurrency.MemoryBudget); nil != err {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+func dimension(name, value string, fallback uint) (uint, error) {
+	if "" == strings.TrimSpace(value) {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if nil != err || uint(parsed) > MaxDimension {
+		return 0, ConfigError{Err: fmt.Errorf("%s must be a whole number between 0 and %d, got %s", name, MaxDimension, value)}
+	}
+
+	return uint(parsed), nil
+}
+
+func limit(name, value string, fallback int) (int, error) {
+	if "" == strings.TrimSpace(value) {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if nil != err || 0 >= parsed {
+		return 0, ConfigError{Err: fmt.Errorf("%s must be a positive whole number, got %s", name, value)}
+	}
+
+	return parsed, nil
+}
+
+func stages(value string) ([]string, error) {
+	if "" == strings.TrimSpace(value) {
+		return processor.DefaultStages, nil
+	}
+
+	var parsed []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if "" == strings.TrimSpace(name) {
+			continue
+		}
+
+		stage, err := processor.ParseStage(name)
+		if nil != err {
+			return nil, ConfigError{Err: fmt.Errorf("invalid PIPELINE_STAGES: %s", err.Error())}
+		}
+		if seen[stage] {
+			return nil, ConfigError{Err: fmt.Errorf("invalid PIPELINE_STAGES: duplicate stage %s", stage)}
+		}
+		seen[stage] = true
+
+		parsed = append(parsed, stage)
+	}
+
+	return parsed, nil
+}
+
+func enhancement(getenv func(string) string, fallback processor.Enhancement) (processor.Enhancement, error) {
+	enhancement := fallback
+	strengths := []struct {
+		name  string
+		value *float64
+	}{
+		{"ENHANCE_LEVELS", &enhancement.Levels},
+		{"ENHANCE_WHITE_BALANCE", &enhancement.WhiteBalance},
+		{"ENHANCE_CONTRAST", &enhancement.Contrast},
+		{"ENHANCE_SATURATION", &enhancement.Saturation},
+	}
+
+	for _, strength := range strengths {
+		value := strings.TrimSpace(getenv(strength.name))
+		if "" == value {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return processor.Enhancement{}, ConfigError{Err: fmt.Errorf("invalid %s %s", strength.name, value)}
+		}
+		*strength.value = parsed
+	}
+
+	for _, prefix := range strings.Split(getenv("ENHANCE_SKIP_PREFIXES"), ",") {
+		if "" != strings.TrimSpace(prefix) {
+			enhancement.SkipPrefixes = append(enhancement.SkipPrefixes, strings.TrimSpace(prefix))
+		}
+	}
+
+	if err := enhancement.Validate(); nil != err {
+		return processor.Enhancement{}, ConfigError{Err: fmt.Errorf("invalid enhancement: %s", err.Error())}
+	}
+
+	return enhancement, nil
+}
+
+func qualityGate(getenv func(string) string, fallback processor.QualityGate) (processor.QualityGate, error) {
+	gate := fallback
+	settings := []struct {
+		name  string
+		value *float64
+	}{
+		{"QUALITY_MIN_SHARPNESS", &gate.MinSharpness},
+		{"QUALITY_MIN_BRIGHTNESS", &gate.MinBrightness},
+		{"QUALITY_MAX_BRIGHTNESS", &gate.MaxBrightness},
+		{"QUALITY_MIN_DEVIATION", &gate.MinDeviation},
+	}
+
+	for _, setting := range settings {
+		value := strings.TrimSpace(getenv(setting.name))
+		if "" == value {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return processor.QualityGate{}, ConfigError{Err: fmt.Errorf("invalid %s %s", setting.name, value)}
+		}
+		*setting.value = parsed
+	}
+
+	if err := gate.Validate(); nil != err {
+		return processor.QualityGate{}, ConfigError{Err: fmt.Errorf("invalid quality gate: %s", err.Error())}
+	}
+
+	return gate, nil
+}
+
+func sharpening(getenv func(string) string, fallback processor.Sharpening) (processor.Sharpening, error) {
+	sharpening := fallback
+	settings := []struct {
+		name  string
+		value *float64
+	}{
+		{"SHARPEN_RADIUS", &sharpening.Radius},
+		{"SHARPEN_AMOUNT", &sharpening.Amount},
+	}
+
+	for _, setting := range settings {
+		value := strings.TrimSpace(getenv(setting.name))
+		if "" == value {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return processor.Sharpening{}, ConfigError{Err: fmt.Errorf("invalid %s %s", setting.name, value)}
+		}
+		*setting.value = parsed
+	}
+
+	if threshold := strings.TrimSpace(getenv("SHARPEN_THRESHOLD")); "" != threshold {
+		parsed, err := strconv.Atoi(threshold)
+		if nil != err {
+			return processor.Sharpening{}, ConfigError{Err: fmt.Errorf("invalid SHARPEN_THRESHOLD %s", threshold)}
+		}
+		sharpening.Threshold = parsed
+	}
+
+	if err := sharpening.Validate(); nil != err {
+		return processor.Sharpening{}, ConfigError{Err: fmt.Errorf("invalid sharpening: %s", err.Error())}
+	}
+
+	return sharpening, nil
+}
+
+func overlay(getenv func(string) string, fallback processor.Overlay) (processor.Overlay, error) {
+	overlay := fallback
+
+	if fields := getenv("OVERLAY_FIELDS"); "" != strings.TrimSpace(fields) {
+		overlay.Fields = nil
+		for _, name := range strings.Split(fields, ",") {
+			if "" == strings.TrimSpace(name) {
+				continue
+			}
+
+			field, err := processor.ParseOverlayField(name)
+			if nil != err {
+				return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid OVERLAY_FIELDS: %s", err.Error())}
+			}
+			overlay.Fields = append(overlay.Fields, field)
+		}
+	}
+
+	if font := strings.TrimSpace(getenv("OVERLAY_FONT")); "" != font {
+		overlay.Font = strings.ToLower(font)
+	}
+
+	if size := strings.TrimSpace(getenv("OVERLAY_SIZE")); "" != size {
+		parsed, err := strconv.ParseFloat(size, 64)
+		if nil != err {
+			return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid OVERLAY_SIZE %s", size)}
+		}
+		overlay.Size = parsed
+	}
+
+	var err error
+	if position := getenv("OVERLAY_POSITION"); "" != strings.TrimSpace(position) {
+		if overlay.Position, err = processor.ParseOverlayPosition(position); nil != err {
+			return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid OVERLAY_POSITION: %s", err.Error())}
+		}
+	}
+
+	if colour := getenv("OVERLAY_COLOUR"); "" != strings.TrimSpace(colour) {
+		if overlay.Colour, err = processor.ParseColour(colour); nil != err {
+			return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid OVERLAY_COLOUR: %s", err.Error())}
+		}
+	}
+
+	if background := getenv("OVERLAY_BACKGROUND"); "" != strings.TrimSpace(background) {
+		if overlay.Background, err = processor.ParseColour(background); nil != err {
+			return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid OVERLAY_BACKGROUND: %s", err.Error())}
+		}
+	}
+
+	if err := overlay.Validate(); nil != err {
+		return processor.Overlay{}, ConfigError{Err: fmt.Errorf("invalid overlay: %s", err.Error())}
+	}
+
+	return overlay, nil
+}
+
+func duplicates(getenv func(string) string, fallback Duplicates) (Duplicates, error) {
+	duplicates := fallback
+
+	if enabled := strings.TrimSpace(getenv("DUPLICATE_DETECTION")); "" != enabled {
+		parsed, err := strconv.ParseBool(enabled)
+		if nil != err {
+			return Duplicates{}, ConfigError{Err: fmt.Errorf("invalid DUPLICATE_DETECTION %s", enabled)}
+		}
+		duplicates.Enabled = parsed
+	}
+
+	if distance := strings.TrimSpace(getenv("DUPLICATE_DISTANCE")); "" != distance {
+		parsed, err := strconv.Atoi(distance)
+		if nil != err || 0 > parsed || 64 < parsed {
+			return Duplicates{}, ConfigError{Err: fmt.Errorf("DUPLICATE_DISTANCE must be a whole number between 0 and 64, got %s", distance)}
+		}
+		duplicates.MaxDistance = parsed
+	}
+
+	if "" != strings.TrimSpace(getenv("HASH_INDEX_PREFIX")) {
+		duplicates.Index = hashindex.LoadLayout(getenv)
+	}
+
+	return duplicates, nil
+}
+
+func encoderConfig(format, quality, progressive string) (processor.EncoderConfig, error) {
+	config := processor.EncoderConfig{Format: DefaultFormat, Quality: DefaultQuality}
+
+	if "" != strings.TrimSpace(format) {
+		parsed, err := processor.ParseFormat(strings.ToLower(strings.TrimSpace(format)))
+		if nil != err {
+			return processor.EncoderConfig{}, ConfigError{Err: fmt.Errorf("invalid OUTPUT_FORMAT: %s", err.Error())}
+		}
+		config.Format = parsed
+	}
+
+	if "" != strings.TrimSpace(quality) {
+		parsed, err := strconv.Atoi(strings.TrimSpace(quality))
+		if nil != err {
+			return processor.EncoderConfig{}, ConfigError{Err: fmt.Errorf("invalid OUTPUT_QUALITY %s", quality)}
+		}
+		config.Quality = parsed
+	}
+
+	if "" != strings.TrimSpace(progressive) {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(progressive))
+		if nil != err {
+			return processor.EncoderConfig{}, ConfigError{Err: fmt.Errorf("invalid OUTPUT_PROGRESSIVE %s", progressive)}
+		}
+		config.Progressive = parsed
+	}
+
+	if _, err := processor.NewEncoder(config); nil != err {
+		return processor.EncoderConfig{}, ConfigError{Err: fmt.Errorf("invalid output encoder: %s", err.Error())}
+	}
+
+	return config, nil
+}
+
+func metadataPolicy(allow, rewrite string) (processor.MetadataPolicy, error) {
+	var allowedTags []processor.ExifTag
+	for _, name := range strings.Split(allow, ",") {
+		if "" == strings.TrimSpace(name) {
+			continue
+		}
+
+		tag, err := processor.ParseExifTag(name)
+		if nil != err {
+			return processor.MetadataPolicy{}, err
+		}
+		allowedTags = append(allowedTags, tag)
+	}
+
+	rewrites := map[processor.ExifTag]string{}
+	for _, pair := range strings.Split(rewrite, ";") {
+		if "" == strings.TrimSpace(pair) {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if 2 != len(parts) {
+			return processor.MetadataPolicy{}, processor.MetadataPolicyError{Err: fmt.Errorf("invalid metadata rewrite %s", pair)}
+		}
+
+		tag, err := processor.ParseExifTag(parts[0])
+		if nil != err {
+			return processor.MetadataPolicy{}, err
+		}
+		rewrites[tag] = strings.TrimSpace(parts[1])
+	}
+
+	return processor.NewMetadataPolicy(allowedTags, rewrites)
+}
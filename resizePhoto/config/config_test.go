@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
+)
+
+type configTestSuite struct {
+	suite.Suite
+}
+
+func environment(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func (s *configTestSuite) TestLoad() {
+	s.T().Run("applies defaults when only the display bucket is set", func(t *testing.T) {
+		policy, _ := processor.NewMetadataPolicy(nil, map[processor.ExifTag]string{})
+
+		config, err := Load(environment(map[string]string{"DISPLAY_BUCKET": "display"}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, Config{
+			DisplayBucket:  "display",
+			Width:          0,
+			Height:         480,
+			FitMode:        processor.FitModeFit,
+			PadColour:      color.NRGBA{A: 0xFF},
+			Encoder:        processor.EncoderConfig{Format: processor.FormatJPEG, Quality: processor.DefaultQuality},
+			Keys:           objectkey.KeyMapper{Extension: ".jpg"},
+			MetadataPolicy: policy,
+			Renditions:     []Rendition{{Width: 0, Height: 480, FitMode: processor.FitModeFit}},
+			Stages:         processor.DefaultStages,
+			Limits:         processor.DefaultLimits(),
+			QualityGate:    processor.DefaultQualityGate(),
+			Enhancement:    processor.DefaultEnhancement(),
+			Filter:         processor.FilterLanczos3,
+			Sharpening:     processor.DefaultSharpening(),
+			Overlay:        processor.DefaultOverlay(),
+			Duplicates:     Duplicates{Enabled: true, MaxDistance: 6, Index: hashindex.Layout{Prefix: ".hash-index/"}},
+			Concurrency:    Concurrency{Workers: 4, MemoryBudget: 64 << 20},
+			Source:         batch.SourceS3,
+		}, config)
+	})
+
+	s.T().Run("reads dimensions, fit mode and encoder settings", func(t *testing.T) {
+		config, err := Load(environment(map[string]string{
+			"DISPLAY_BUCKET":        "display",
+			"RESIZE_WIDTH":          "1920",
+			"RESIZE_HEIGHT":         "1080",
+			"FIT_MODE":              "Pad",
+			"PAD_COLOUR":            "#FFFFFF",
+			"OUTPUT_FORMAT":         "webp",
+			"OUTPUT_QUALITY":        "60",
+			"OUTPUT_PROGRESSIVE":    "false",
+			"DISPLAY_FOLDERS":       "flatten",
+			"INGEST_EXCLUDE":        "*.mp4,*.xmp",
+			"PIPELINE_STAGES":       "metadata, resize",
+			"MAX_PIXELS":            "24000000",
+			"MAX_BYTES":             "1048576",
+			"QUALITY_MIN_SHARPNESS": "40",
+			"ENHANCE_CONTRAST":      "0.3",
+			"ENHANCE_SKIP_PREFIXES": "stylised/, scans/originals/",
+			"RESAMPLING_FILTER":     "Mitchell",
+			"SHARPEN_AMOUNT":        "1.2",
+			"SHARPEN_THRESHOLD":     "0",
+			"OVERLAY_FIELDS":        "date, caption",
+			"OVERLAY_FONT":          "Bold",
+			"OVERLAY_POSITION":      "top-left",
+			"OVERLAY_BACKGROUND":    "#00000000",
+			"DUPLICATE_DISTANCE":    "10",
+			"HASH_INDEX_PREFIX":     "hashes",
+			"WORKERS":               "8",
+			"MEMORY_BUDGET":         "134217728",
+			"EVENT_SOURCE":          "sqs",
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, uint(1920), config.Width)
+		assert.Equal(t, uint(1080), config.Height)
+		assert.Equal(t, processor.FitModePad, config.FitMode)
+		assert.Equal(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, config.PadColour)
+		assert.Equal(t, processor.EncoderConfig{Format: processor.FormatWebP, Quality: 60}, config.Encoder)
+		assert.Equal(t, objectkey.KeyMapper{Extension: ".webp", Flatten: true}, config.Keys)
+		assert.Equal(t, filter.Filter{Exclude: []string{"*.mp4", "*.xmp"}}, config.Ingest)
+		assert.Equal(t, []string{processor.StageMetadata, processor.StageResize}, config.Stages)
+		assert.Equal(t, processor.Limits{MaxPixels: 24000000, MaxBytes: 1048576}, config.Limits)
+		assert.Equal(t, 40.0, config.QualityGate.MinSharpness)
+		assert.Equal(t, processor.DefaultQualityGate().MaxBrightness, config.QualityGate.MaxBrightness)
+		assert.Equal(t, 0.3, config.Enhancement.Contrast)
+		assert.Equal(t, processor.DefaultEnhancement().Levels, config.Enhancement.Levels)
+		assert.Equal(t, []string{"stylised/", "scans/originals/"}, config.Enhancement.SkipPrefixes)
+		assert.Equal(t, processor.FilterMitchell, config.Filter)
+		assert.Equal(t, processor.Sharpening{Radius: 1, Amount: 1.2, Threshold: 0}, config.Sharpening)
+		assert.Equal(t, []processor.OverlayField{processor.OverlayDate, processor.OverlayCaption}, config.Overlay.Fields)
+		assert.Equal(t, "bold", config.Overlay.Font)
+		assert.Equal(t, processor.OverlayTopLeft, config.Overlay.Position)
+		assert.Equal(t, color.NRGBA{}, config.Overlay.Background)
+		assert.Equal(t, Duplicates{Enabled: true, MaxDistance: 10, Index: hashindex.Layout{Prefix: "hashes/"}}, config.Duplicates)
+		assert.Equal(t, Concurrency{Workers: 8, MemoryBudget: 134217728}, config.Concurrency)
+		assert.Equal(t, batch.SourceSQS, config.Source)
+	})
+
+	s.T().Run("returns ConfigError when display bucket is empty", func(t *testing.T) {
+		_, err := Load(environment(map[string]string{"RESIZE_HEIGHT": "1080"}))
+
+		assert.True(t, errors.Is(err, ConfigError{}))
+		assert.Equal(t, "DISPLAY_BUCKET must be set", err.Error())
+	})
+
+	s.T().Run("returns ConfigError for invalid dimensions", func(t *testing.T) {
+		for _, values := range []map[string]string{
+			{"RESIZE_WIDTH": "-1"},
+			{"RESIZE_HEIGHT": "wide"},
+			{"RESIZE_WIDTH": "10000"},
+			{"RESIZE_WIDTH": "0", "RESIZE_HEIGHT": "0"},
+		} {
+			values["DISPLAY_BUCKET"] = "display"
+
+			_, err := Load(environment(values))
+
+			assert.True(t, errors.Is(err, ConfigError{}), values)
+		}
+	})
+
+	s.T().Run("returns ConfigError for invalid processing settings", func(t *testing.T) {
+		for _, values := range []map[string]string{
+			{"FIT_MODE": "stretch"},
+			{"PAD_COLOUR": "grey"},
+			{"OUTPUT_FORMAT": "avif"},
+			{"OUTPUT_QUALITY": "high"},
+			{"OUTPUT_QUALITY": "0"},
+			{"OUTPUT_FORMAT": "png", "OUTPUT_PROGRESSIVE": "true"},
+			{"DISPLAY_FOLDERS": "nested"},
+			{"INGEST_MIN_SIZE": "tiny"},
+			{"METADATA_ALLOW": "GPSInfo"},
+			{"METADATA_REWRITE": "Artist"},
+			{"PIPELINE_STAGES": "resize,blur"},
+			{"PIPELINE_STAGES": "resize,resize"},
+			{"MAX_PIXELS": "0"},
+			{"MAX_BYTES": "lots"},
+			{"QUALITY_MIN_SHARPNESS": "sharp"},
+			{"QUALITY_MIN_BRIGHTNESS": "250"},
+			{"ENHANCE_LEVELS": "full"},
+			{"ENHANCE_SATURATION": "1.5"},
+			{"RESAMPLING_FILTER": "sinc"},
+			{"SHARPEN_RADIUS": "0"},
+			{"SHARPEN_THRESHOLD": "soft"},
+			{"OVERLAY_FIELDS": "date,camera"},
+			{"OVERLAY_FONT": "comic-sans"},
+			{"OVERLAY_SIZE": "0"},
+			{"OVERLAY_POSITION": "centre"},
+			{"DUPLICATE_DETECTION": "sometimes"},
+			{"DUPLICATE_DISTANCE": "65"},
+			{"WORKERS": "0"},
+			{"MEMORY_BUDGET": "lots"},
+			{"EVENT_SOURCE": "sns"},
+		} {
+			values["DISPLAY_BUCKET"] = "display"
+
+			_, err := Load(environment(values))
+
+			assert.True(t, errors.Is(err, ConfigError{}), values)
+		}
+	})
+}
+
+func (s *configTestSuite) TestRenditions() {
+	s.T().Run("parses named rendition profiles", func(t *testing.T) {
+		config, err := Load(environment(map[string]string{
+			"DISPLAY_BUCKET": "display",
+			"FIT_MODE":       "pad",
+			"RENDITIONS":     "frame-480:0x480, thumb-200:200x200:fill,hd-1080:1920x1080",
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Rendition{
+			{Name: "frame-480", Width: 0, Height: 480, FitMode: processor.FitModePad},
+			{Name: "thumb-200", Width: 200, Height: 200, FitMode: processor.FitModeFill},
+			{Name: "hd-1080", Width: 1920, Height: 1080, FitMode: processor.FitModePad},
+		}, config.Renditions)
+	})
+
+	s.T().Run("returns ConfigError for invalid profiles", func(t *testing.T) {
+		for _, value := range []string{
+			"frame-480",
+			"Frame:0x480",
+			"frame/480:0x480",
+			"frame:480",
+			"frame:0x0",
+			"frame:0x480:stretch",
+			"frame:0x480,frame:0x1080",
+		} {
+			_, err := Load(environment(map[string]string{"DISPLAY_BUCKET": "display", "RENDITIONS": value}))
+
+			assert.True(t, errors.Is(err, ConfigError{}), value)
+		}
+	})
+}
+
+func (s *configTestSuite) TestMetadataPolicy() {
+	s.T().Run("builds policy from allow list and rewrites", func(t *testing.T) {
+		expected, _ := processor.NewMetadataPolicy(
+			[]processor.ExifTag{processor.TagModel, processor.TagDateTimeOriginal},
+			map[processor.ExifTag]string{processor.TagArtist: "King Family"},
+		)
+
+		actual, err := metadataPolicy("Model, DateTimeOriginal", "Artist=King Family")
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	s.T().Run("returns error for unsafe tags", func(t *testing.T) {
+		_, err := metadataPolicy("GPSInfo", "")
+
+		assert.True(t, errors.Is(err, processor.MetadataPolicyError{}))
+	})
+
+	s.T().Run("returns error for malformed rewrite", func(t *testing.T) {
+		_, err := metadataPolicy("", "Artist")
+
+		assert.Equal(t, "invalid metadata rewrite Artist", err.Error())
+	})
+}
+
+func (s *configTestSuite) TestResizerOptions() {
+	s.T().Run("builds resizer options from the loaded config", func(t *testing.T) {
+		config, _ := Load(environment(map[string]string{"DISPLAY_BUCKET": "display"}))
+
+		options, err := config.ResizerOptions(config.Renditions[0])
+
+		assert.Nil(t, err)
+		assert.Len(t, options, 11)
+	})
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(configTestSuite))
+}
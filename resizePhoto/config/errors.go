@@ -0,0 +1,21 @@
+package config
+
+type ConfigError struct {
+	Err error
+}
+
+func (err ConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err ConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ConfigError) Is(target error) bool {
+	_, ok := target.(ConfigError)
+	if !ok {
+		_, ok = target.(*ConfigError)
+	}
+	return ok
+}
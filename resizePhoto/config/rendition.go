@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
+)
+
+type Rendition struct {
+	Name    string
+	Width   uint
+	Height  uint
+	FitMode processor.FitMode
+}
+
+// renditions reads the sizes and fit modes of the RENDITIONS profiles. When
+// none are configured a single unnamed rendition is written at the original key.
+func renditions(value string, fallback Rendition) ([]Rendition, error) {
+	profiles, err := objectkey.ParseRenditions(value)
+	if nil != err {
+		return nil, ConfigError{Err: err}
+	}
+
+	var parsed []Rendition
+	for _, profile := range profiles {
+		rendition := Rendition{Name: profile.Name, FitMode: fallback.FitMode}
+
+		size := strings.SplitN(profile.Size, "x", 2)
+		if 2 != len(size) {
+			return nil, ConfigError{Err: fmt.Errorf("invalid RENDITIONS size %s, expected WIDTHxHEIGHT", profile.Size)}
+		}
+
+		if rendition.Width, err = dimension(rendition.Name+" width", size[0], 0); nil != err {
+			return nil, err
+		}
+		if rendition.Height, err = dimension(rendition.Name+" height", size[1], 0); nil != err {
+			return nil, err
+		}
+		if 0 == rendition.Width && 0 == rendition.Height {
+			return nil, ConfigError{Err: fmt.Errorf("%s width and height cannot both be 0", rendition.Name)}
+		}
+
+		if "" != profile.FitMode {
+			if rendition.FitMode, err = processor.ParseFitMode(profile.FitMode); nil != err {
+				return nil, ConfigError{Err: fmt.Errorf("invalid RENDITIONS fit mode: %s", err.Error())}
+			}
+		}
+
+		parsed = append(parsed, rendition)
+	}
+
+	if 0 == len(parsed) {
+		return []Rendition{fallback}, nil
+	}
+
+	return parsed, nil
+}
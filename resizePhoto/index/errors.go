@@ -0,0 +1,41 @@
+package index
+
+type ListIndexError struct {
+	Err error
+}
+
+func (err ListIndexError) Unwrap() error {
+	return err.Err
+}
+
+func (err ListIndexError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ListIndexError) Is(target error) bool {
+	_, ok := target.(ListIndexError)
+	if !ok {
+		_, ok = target.(*ListIndexError)
+	}
+	return ok
+}
+
+type PutIndexError struct {
+	Err error
+}
+
+func (err PutIndexError) Unwrap() error {
+	return err.Err
+}
+
+func (err PutIndexError) Error() string {
+	return err.Err.Error()
+}
+
+func (err PutIndexError) Is(target error) bool {
+	_, ok := target.(PutIndexError)
+	if !ok {
+		_, ok = target.(*PutIndexError)
+	}
+	return ok
+}
@@ -0,0 +1,12 @@
+package index
+
+// Entry records the perceptual hash of an ingested photo against its key.
+type Entry struct {
+	Hash uint64
+	Key  string
+}
+
+type Repository interface {
+	List() ([]Entry, error)
+	Put(Entry) error
+}
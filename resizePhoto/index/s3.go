@@ -0,0 +1,97 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+)
+
+type s3Client interface {
+	ListObjectsV2Pages(*s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool) error
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	DeleteObject(*s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+}
+
+// S3 stores each entry as an empty object named after its source key and
+// hash, so listing the index is a single listing of the prefix.
+type S3 struct {
+	client s3Client
+	bucket string
+	layout hashindex.Layout
+}
+
+func (s *S3) List() ([]Entry, error) {
+	entries, err := s.list(s.layout.Prefix)
+
+	if nil != err {
+		return nil, ListIndexError{Err: fmt.Errorf("error listing %s in %s: %s", s.layout.Prefix, s.bucket, err.Error())}
+	}
+
+	return entries, nil
+}
+
+func (s *S3) list(prefix string) ([]Entry, error) {
+	var entries []Entry
+	listObjectsInput := s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	err := s.client.ListObjectsV2Pages(&listObjectsInput, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			if key, hash, ok := s.layout.SourceKey(aws.StringValue(object.Key)); ok {
+				entries = append(entries, Entry{Hash: hash, Key: key})
+			}
+		}
+		return true
+	})
+
+	return entries, err
+}
+
+// Put records entry, then removes any entry held for the same key under an
+// older hash. Only the entries for that key are listed to find them.
+func (s *S3) Put(entry Entry) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Body:   bytes.NewReader(nil),
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.layout.ObjectKey(entry.Key, entry.Hash)),
+	})
+
+	if nil != err {
+		return PutIndexError{Err: fmt.Errorf("error putting index entry for %s: %s", entry.Key, err.Error())}
+	}
+
+	held, err := s.list(s.layout.EntryPrefix(entry.Key))
+	if nil != err {
+		return PutIndexError{Err: fmt.Errorf("error listing index entries for %s: %s", entry.Key, err.Error())}
+	}
+
+	for _, stale := range held {
+		if entry.Key != stale.Key || entry.Hash == stale.Hash {
+			continue
+		}
+
+		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.layout.ObjectKey(stale.Key, stale.Hash)),
+		})
+
+		if nil != err {
+			return PutIndexError{Err: fmt.Errorf("error removing stale index entry for %s: %s", entry.Key, err.Error())}
+		}
+	}
+
+	return nil
+}
+
+func NewS3(client s3Client, bucket string, layout hashindex.Layout) S3 {
+	return S3{
+		client: client,
+		bucket: bucket,
+		layout: layout,
+	}
+}
@@ -0,0 +1,167 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ian-antking/king-family-photos/objectkey/hashindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type s3TestSuite struct {
+	suite.Suite
+	client *mockS3Client
+}
+
+func (s *s3TestSuite) setUpMocks() {
+	s.client = new(mockS3Client)
+}
+
+func listing(keys ...string) *s3.ListObjectsV2Output {
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+
+	return output
+}
+
+func (s *s3TestSuite) TestList() {
+	s.T().Run("reads every hash from a single listing of the prefix", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("ListObjectsV2Pages", &s3.ListObjectsV2Input{
+			Bucket: aws.String("displayBucket"),
+			Prefix: aws.String(".hash-index/"),
+		}).Return([]*s3.ListObjectsV2Output{
+			listing(".hash-index/2021/IMG_1234.jpg/00000000000000ff"),
+			listing(".hash-index/not-a-hash.jpg", ".hash-index/photo.jpg/ff00000000000000"),
+		}, nil)
+
+		entries, err := hashIndex.List()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Entry{
+			{Hash: 0xFF, Key: "2021/IMG_1234.jpg"},
+			{Hash: 0xFF00000000000000, Key: "photo.jpg"},
+		}, entries)
+		s.client.AssertNumberOfCalls(t, "ListObjectsV2Pages", 1)
+	})
+
+	s.T().Run("returns ListIndexError when listing fails", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{}, errors.New("access denied"))
+
+		_, err := hashIndex.List()
+
+		assert.True(t, errors.Is(err, ListIndexError{}))
+		assert.Equal(t, "error listing .hash-index/ in displayBucket: access denied", err.Error())
+	})
+}
+
+func (s *s3TestSuite) TestPut() {
+	s.T().Run("writes an entry named after the key and hash", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("PutObject", &s3.PutObjectInput{
+			Body:   bytes.NewReader(nil),
+			Bucket: aws.String("displayBucket"),
+			Key:    aws.String(".hash-index/2021/photo.jpg/00000000000000aa"),
+		}).Return(&s3.PutObjectOutput{}, nil)
+		s.client.On("ListObjectsV2Pages", &s3.ListObjectsV2Input{
+			Bucket: aws.String("displayBucket"),
+			Prefix: aws.String(".hash-index/2021/photo.jpg/"),
+		}).Return([]*s3.ListObjectsV2Output{listing(".hash-index/2021/photo.jpg/00000000000000aa")}, nil)
+
+		err := hashIndex.Put(Entry{Hash: 0xAA, Key: "2021/photo.jpg"})
+
+		assert.Nil(t, err)
+		s.client.AssertNumberOfCalls(t, "PutObject", 1)
+		s.client.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
+	s.T().Run("removes entries held for the key under other hashes", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		s.client.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{listing(
+			".hash-index/2021/00000000000000bb",
+			".hash-index/2021/00000000000000aa",
+			".hash-index/2021/photo.jpg/00000000000000cc",
+		)}, nil)
+		s.client.On("DeleteObject", &s3.DeleteObjectInput{
+			Bucket: aws.String("displayBucket"),
+			Key:    aws.String(".hash-index/2021/00000000000000bb"),
+		}).Return(&s3.DeleteObjectOutput{}, nil)
+
+		err := hashIndex.Put(Entry{Hash: 0xAA, Key: "2021"})
+
+		assert.Nil(t, err)
+		s.client.AssertNumberOfCalls(t, "DeleteObject", 1)
+	})
+
+	s.T().Run("returns PutIndexError when writing fails", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, errors.New("slow down"))
+
+		err := hashIndex.Put(Entry{Hash: 0xAA, Key: "photo.jpg"})
+
+		assert.True(t, errors.Is(err, PutIndexError{}))
+		assert.Equal(t, "error putting index entry for photo.jpg: slow down", err.Error())
+	})
+
+	s.T().Run("returns PutIndexError when removing a stale entry fails", func(t *testing.T) {
+		s.setUpMocks()
+		hashIndex := NewS3(s.client, "displayBucket", hashindex.NewLayout(".hash-index/"))
+
+		s.client.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		s.client.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{listing(".hash-index/photo.jpg/00000000000000bb")}, nil)
+		s.client.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, errors.New("slow down"))
+
+		err := hashIndex.Put(Entry{Hash: 0xAA, Key: "photo.jpg"})
+
+		assert.True(t, errors.Is(err, PutIndexError{}))
+		assert.Equal(t, "error removing stale index entry for photo.jpg: slow down", err.Error())
+	})
+}
+
+type mockS3Client struct {
+	mock.Mock
+}
+
+func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, page func(*s3.ListObjectsV2Output, bool) bool) error {
+	args := m.Called(input)
+	pages := args.Get(0).([]*s3.ListObjectsV2Output)
+	for i, output := range pages {
+		if !page(output, i == len(pages)-1) {
+			break
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*s3.PutObjectOutput), args.Error(1)
+}
+
+func TestS3TestSuite(t *testing.T) {
+	suite.Run(t, new(s3TestSuite))
+}
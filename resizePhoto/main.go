@@ -2,30 +2,96 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"os"
+	"sync"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/resizePhoto/config"
+	"github.com/ian-antking/king-family-photos/resizePhoto/index"
 	"github.com/ian-antking/king-family-photos/resizePhoto/photo"
 	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
 )
 
+type Rendition struct {
+	Name           string
+	ImageProcessor processor.DecodedProcessor
+}
+
+// Duplicates skips photos whose hash is within MaxDistance bits of one
+// already in the index.
+type Duplicates struct {
+	Hasher      processor.Hasher
+	Index       index.Repository
+	MaxDistance int
+}
+
+func (d *Duplicates) match(hash uint64, key string, entries []index.Entry) (index.Entry, int, bool) {
+	var closest index.Entry
+	closestDistance := d.MaxDistance + 1
+	for _, entry := range entries {
+		if distance := processor.HammingDistance(hash, entry.Hash); key != entry.Key && distance < closestDistance {
+			closest, closestDistance = entry, distance
+		}
+	}
+
+	return closest, closestDistance, closestDistance <= d.MaxDistance
+}
+
+// Rejection records a photo the quality gate kept off the frame.
+type Rejection struct {
+	Bucket string                  `json:"bucket"`
+	Key    string                  `json:"key"`
+	Reason string                  `json:"reason"`
+	Scores processor.QualityScores `json:"scores"`
+}
+
 type Handler struct {
 	photo             photo.Repository
 	displayBucketName string
-	imageProcessor    processor.Processor
+	decoder           processor.Decoder
+	renditions        []Rendition
+	keys              objectkey.KeyMapper
+	filter            filter.Filter
+	concurrency       config.Concurrency
+	duplicates        *Duplicates
 }
 
-func getPhotoParams(s3Event events.S3Event) []photo.GetPhotoParams {
+func (h *Handler) getPhotoParams(s3Event events.S3Event) []photo.GetPhotoParams {
 	var params []photo.GetPhotoParams
 
 	for _, message := range s3Event.Records {
+		key, err := objectkey.FromRecord(message)
+		if nil != err {
+			log.Printf("skipping record from %s: %s", message.S3.Bucket.Name, err.Error())
+			continue
+		}
+
+		// Events leave the size at zero when they do not report it, so only a
+		// non-zero size is checked here and the repository checks the rest.
+		object := filter.Object{Key: key}
+		if size := message.S3.Object.Size; 0 != size {
+			object.Size = &size
+		}
+		if err := h.filter.Check(object); nil != err {
+			filter.LogSkipped(message.S3.Bucket.Name, object, err)
+			continue
+		}
+
 		params = append(params, photo.GetPhotoParams{
 			Bucket: message.S3.Bucket.Name,
-			Key:    message.S3.Object.Key,
+			Key:    key,
+			Size:   message.S3.Object.Size,
 		})
 	}
 
@@ -37,35 +103,194 @@ func (h *Handler) getImages(params []photo.GetPhotoParams) ([]photo.GetPhotoOutp
 	for _, param := range params {
 		getPhotoOutput, err := h.photo.Get(param)
 
+		// Content types are only known once the repository has read the object's metadata.
+		var skipped filter.SkippedObjectError
+		if errors.As(err, &skipped) {
+			filter.LogSkipped(param.Bucket, skipped.Object, err)
+			continue
+		}
+		if errors.Is(err, processor.ImageTooLargeError{}) {
+			log.Printf("skipping image %s/%s permanently: %s", param.Bucket, param.Key, err.Error())
+			continue
+		}
 		if nil != err {
 			return []photo.GetPhotoOutput{}, err
 		}
+
 		images = append(images, getPhotoOutput)
 	}
 
 	return images, nil
 }
 
-func (h *Handler) processImages(images []photo.GetPhotoOutput) ([]processor.Image, error) {
-	var processedImages []processor.Image
+// seenHashes holds the hash index for one invocation along with the hashes
+// claimed during it, so records are checked against each other as well.
+type seenHashes struct {
+	mu      sync.Mutex
+	entries []index.Entry
+}
+
+func (h *Handler) loadHashes() (*seenHashes, error) {
+	if nil == h.duplicates {
+		return nil, nil
+	}
+
+	entries, err := h.duplicates.Index.List()
+	if nil != err {
+		return nil, err
+	}
+
+	return &seenHashes{entries: entries}, nil
+}
+
+// release gives up hashes claimed for photos that were rejected or failed, so
+// a later near-duplicate can still be written in their place.
+func (s *seenHashes) release(entries []index.Entry) {
+	if nil == s || 0 == len(entries) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		for i := len(s.entries) - 1; 0 <= i; i-- {
+			if entry == s.entries[i] {
+				s.entries = append(s.entries[:i:i], s.entries[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (h *Handler) claimImages(seen *seenHashes, images []processor.DecodedImage) ([]processor.DecodedImage, []index.Entry) {
+	if nil == seen {
+		return images, nil
+	}
+
+	var unique []processor.DecodedImage
+	var added []index.Entry
+	for _, image := range images {
+		hash := h.duplicates.Hasher.Hash(image)
+
+		seen.mu.Lock()
+		match, distance, duplicate := h.duplicates.match(hash, image.Key, seen.entries)
+		entry := index.Entry{Hash: hash, Key: image.Key}
+		if !duplicate {
+			seen.entries = append(seen.entries, entry)
+		}
+		seen.mu.Unlock()
+
+		if duplicate {
+			log.Printf("skipping image %s/%s as a duplicate of %s, %d bits apart", image.Bucket, image.Key, match.Key, distance)
+			continue
+		}
+
+		added = append(added, entry)
+		unique = append(unique, image)
+	}
+
+	return unique, added
+}
+
+func (h *Handler) indexImages(entries []index.Entry) error {
+	for _, entry := range entries {
+		if err := h.duplicates.Index.Put(entry); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeImages decodes each photo once, for the hash and every rendition to
+// share. Photos over the limits are skipped without being retried.
+func (h *Handler) decodeImages(images []photo.GetPhotoOutput) ([]processor.DecodedImage, error) {
+	var decodedImages []processor.DecodedImage
 	for _, image := range images {
-		processedImage, err := h.imageProcessor.Run(processor.Image(image))
+		log.Printf("processing %s image %s/%s", processor.DetectFormat(image.Image), image.Bucket, image.Key)
+
+		decoded, err := h.decoder.Decode(processor.Image(image))
+		if errors.Is(err, processor.ImageTooLargeError{}) {
+			log.Printf("skipping image %s/%s permanently: %s", image.Bucket, image.Key, err.Error())
+			continue
+		}
 		if nil != err {
-			return []processor.Image{}, err
-		} else {
+			return []processor.DecodedImage{}, err
+		}
+
+		decodedImages = append(decodedImages, decoded)
+	}
+
+	return decodedImages, nil
+}
+
+func (h *Handler) processImages(images []processor.DecodedImage) ([]processor.Image, []Rejection, error) {
+	var processedImages []processor.Image
+	var rejections []Rejection
+	for _, image := range images {
+		first := len(processedImages)
+		for _, rendition := range h.renditions {
+			processedImage, err := rendition.ImageProcessor.RunDecoded(image)
+			var rejected processor.RejectedImageError
+			if errors.As(err, &rejected) {
+				// Renditions already processed for this photo are dropped too.
+				processedImages = processedImages[:first]
+				rejections = append(rejections, Rejection{Bucket: image.Bucket, Key: image.Key, Reason: rejected.Error(), Scores: rejected.Scores})
+				break
+			}
+			if nil != err {
+				return []processor.Image{}, nil, err
+			}
+
+			processedImage.Key = h.keys.DisplayKey(rendition.Name, image.Key)
 			processedImages = append(processedImages, processedImage)
 		}
 	}
 
-	return processedImages, nil
+	return processedImages, rejections, nil
+}
+
+func report(rejections []Rejection) {
+	if 0 == len(rejections) {
+		return
+	}
+
+	body, err := json.Marshal(struct {
+		Rejected []Rejection `json:"rejected"`
+	}{rejections})
+	if nil != err {
+		log.Printf("error writing quality report: %s", err.Error())
+		return
+	}
+
+	log.Printf("quality report: %s", body)
+}
+
+func splitRejected(entries []index.Entry, rejections []Rejection) ([]index.Entry, []index.Entry) {
+	var kept, rejected []index.Entry
+	for _, entry := range entries {
+		isRejected := false
+		for _, rejection := range rejections {
+			isRejected = isRejected || rejection.Key == entry.Key
+		}
+		if isRejected {
+			rejected = append(rejected, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept, rejected
 }
 
 func (h *Handler) putImages(images []processor.Image) error {
 	for _, image := range images {
 		err := h.photo.Put(photo.PutPhotoParams{
-			Image:  image.Image,
-			Key:    image.Key,
-			Bucket: h.displayBucketName,
+			Image:       image.Image,
+			Key:         image.Key,
+			Bucket:      h.displayBucketName,
+			ContentType: image.ContentType,
 		})
 		if nil != err {
 			return err
@@ -74,36 +299,199 @@ func (h *Handler) putImages(images []processor.Image) error {
 	return nil
 }
 
-func (h *Handler) Run(_ context.Context, s3Event events.S3Event) error {
-	params := getPhotoParams(s3Event)
+// budget limits the total size of the photos being processed at once.
+// Photos larger than the whole budget wait until it is free and run alone.
+type budget struct {
+	mu        sync.Mutex
+	freed     *sync.Cond
+	capacity  int64
+	available int64
+}
+
+func newBudget(capacity int64) *budget {
+	b := &budget{capacity: capacity, available: capacity}
+	b.freed = sync.NewCond(&b.mu)
+
+	return b
+}
+
+func (b *budget) acquire(size int64) int64 {
+	if 0 >= b.capacity {
+		return 0
+	}
+
+	if 1 > size {
+		size = 1
+	}
+	if size > b.capacity {
+		size = b.capacity
+	}
+
+	b.mu.Lock()
+	for b.available < size {
+		b.freed.Wait()
+	}
+	b.available -= size
+	b.mu.Unlock()
+
+	return size
+}
+
+func (b *budget) release(size int64) {
+	b.mu.Lock()
+	b.available += size
+	b.mu.Unlock()
+	b.freed.Broadcast()
+}
+
+// recordResult is the outcome of processing one S3 event record.
+type recordResult struct {
+	Key        string
+	Err        error
+	Rejections []Rejection
+}
 
-	images, err := h.getImages(params)
+// processRecord gets, processes and puts a single photo, so only the photos
+// being worked on are held in memory.
+func (h *Handler) processRecord(param photo.GetPhotoParams, seen *seenHashes) recordResult {
+	result := recordResult{Key: param.Key}
 
+	images, err := h.getImages([]photo.GetPhotoParams{param})
 	if nil != err {
-		return err
+		result.Err = err
+		return result
+	}
+
+	decoded, err := h.decodeImages(images)
+	if nil != err {
+		result.Err = err
+		return result
+	}
+
+	decoded, entries := h.claimImages(seen, decoded)
+
+	processedImages, rejections, err := h.processImages(decoded)
+	result.Rejections = rejections
+	if nil != err {
+		seen.release(entries)
+		result.Err = err
+		return result
+	}
+
+	if err := h.putImages(processedImages); nil != err {
+		seen.release(entries)
+		result.Err = err
+		return result
+	}
+
+	kept, rejected := splitRejected(entries, rejections)
+	seen.release(rejected)
+
+	if nil != h.duplicates {
+		result.Err = h.indexImages(kept)
+	}
+
+	return result
+}
+
+// processRecords runs processRecord on a bounded pool of workers and returns
+// the results in record order.
+func (h *Handler) processRecords(params []photo.GetPhotoParams, seen *seenHashes) []recordResult {
+	results := make([]recordResult, len(params))
+	memory := newBudget(int64(h.concurrency.MemoryBudget))
+
+	workers := h.concurrency.Workers
+	if 1 > workers {
+		workers = 1
 	}
 
-	processedImages, err := h.processImages(images)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reserved := memory.acquire(params[i].Size)
+				results[i] = h.processRecord(params[i], seen)
+				memory.release(reserved)
+			}
+		}()
+	}
+
+	for i := range params {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func (h *Handler) Run(_ context.Context, s3Event events.S3Event) error {
+	params := h.getPhotoParams(s3Event)
+
+	seen, err := h.loadHashes()
 
 	if nil != err {
 		return err
 	}
 
-	err = h.putImages(processedImages)
+	results := h.processRecords(params, seen)
+
+	var rejections []Rejection
+	for _, result := range results {
+		rejections = append(rejections, result.Rejections...)
+	}
+	report(rejections)
+
+	failures := batch.KeyFailures(s3Event)
+	for _, result := range results {
+		if nil != result.Err {
+			failures = append(failures, batch.Failure{Key: result.Key, Err: result.Err})
+		}
+	}
 
-	return err
+	return batch.NewError(failures)
 }
 
-func NewHandler(repository photo.Repository, bucketName string, imageProcessor processor.Processor) Handler {
+// RunSQS handles S3 events queued through SQS, reporting the messages whose
+// photos failed so only those are retried.
+func (h *Handler) RunSQS(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	return batch.RunSQS(sqsEvent, func(s3Event events.S3Event) error {
+		return h.Run(ctx, s3Event)
+	}), nil
+}
+
+func NewHandler(repository photo.Repository, bucketName string, decoder processor.Decoder, renditions []Rendition, keys objectkey.KeyMapper, ingestFilter filter.Filter, concurrency config.Concurrency, duplicates *Duplicates) Handler {
 	return Handler{
 		photo:             repository,
 		displayBucketName: bucketName,
-		imageProcessor:    imageProcessor,
+		decoder:           decoder,
+		renditions:        renditions,
+		keys:              keys,
+		filter:            ingestFilter,
+		concurrency:       concurrency,
+		duplicates:        duplicates,
 	}
 }
 
 func main() {
-	displayBucketName := os.Getenv("DISPLAY_BUCKET")
+	resizeConfig, err := config.Load(os.Getenv)
+	if nil != err {
+		log.Fatalln(err.Error())
+	}
+
+	var renditions []Rendition
+	for _, rendition := range resizeConfig.Renditions {
+		resizerOptions, err := resizeConfig.ResizerOptions(rendition)
+		if nil != err {
+			log.Fatalln(err.Error())
+		}
+
+		resizer := processor.NewResizer(rendition.Width, rendition.Height, resizerOptions...)
+		renditions = append(renditions, Rendition{Name: rendition.Name, ImageProcessor: &resizer})
+	}
 
 	awsSession := session.Must(session.NewSessionWithOptions(
 		session.Options{
@@ -111,11 +499,26 @@ func main() {
 		},
 	))
 
+	s3Client := s3.New(awsSession)
 	s3Downloader := s3manager.NewDownloader(awsSession)
 	s3Uploader := s3manager.NewUploader(awsSession)
-	photoRepository := photo.NewS3(s3Downloader, s3Uploader)
-	imageProcessor := processor.NewResizer(0, 480)
-	handler := NewHandler(&photoRepository, displayBucketName, &imageProcessor)
+	photoRepository := photo.NewS3(s3Downloader, s3Uploader, s3Client, resizeConfig.Ingest, resizeConfig.Limits)
 
-	lambda.Start(handler.Run)
+	var duplicates *Duplicates
+	if resizeConfig.Duplicates.Enabled {
+		hashIndex := index.NewS3(s3Client, resizeConfig.DisplayBucket, resizeConfig.Duplicates.Index)
+		duplicates = &Duplicates{
+			Hasher:      processor.NewDifferenceHasher(),
+			Index:       &hashIndex,
+			MaxDistance: resizeConfig.Duplicates.MaxDistance,
+		}
+	}
+
+	handler := NewHandler(&photoRepository, resizeConfig.DisplayBucket, processor.NewDecoder(resizeConfig.Limits), renditions, resizeConfig.Keys, resizeConfig.Ingest, resizeConfig.Concurrency, duplicates)
+
+	if batch.SourceSQS == resizeConfig.Source {
+		lambda.Start(handler.RunSQS)
+	} else {
+		lambda.Start(handler.Run)
+	}
 }
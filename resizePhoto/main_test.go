@@ -1,30 +1,47 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/ian-antking/king-family-photos/objectkey"
+	"github.com/ian-antking/king-family-photos/objectkey/batch"
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/resizePhoto/config"
+	"github.com/ian-antking/king-family-photos/resizePhoto/index"
 	"github.com/ian-antking/king-family-photos/resizePhoto/photo"
 	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"image"
+	"image/png"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type handlerTestSuite struct {
 	suite.Suite
 	photoRepository *mockPhotoRepository
 	imageProcessor  *mockImageProcessor
+	hasher          *mockHasher
+	hashIndex       *mockHashIndex
 }
 
 func (s *handlerTestSuite) setUpMocks() {
 	s.photoRepository = new(mockPhotoRepository)
 	s.imageProcessor = new(mockImageProcessor)
+	s.hasher = new(mockHasher)
+	s.hashIndex = new(mockHashIndex)
 }
 
 func (s *handlerTestSuite) TestGetPhotoParams() {
 	s.T().Run("extracts photo bucket names and keys from s3 event records", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, nil, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 		event := events.S3Event{
 			Records: []events.S3EventRecord{
 				{
@@ -60,16 +77,98 @@ func (s *handlerTestSuite) TestGetPhotoParams() {
 			},
 		}
 
-		actual := getPhotoParams(event)
+		actual := handler.getPhotoParams(event)
 
 		assert.Equal(t, expected, actual)
 	})
+
+	s.T().Run("decodes keys and skips records with invalid keys", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, nil, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{
+							Name: "bucketName",
+						},
+						Object: events.S3Object{
+							Key: "2021/Beach+Day+%282%29.jpg",
+						},
+					},
+				},
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{
+							Name: "bucketName",
+						},
+						Object: events.S3Object{
+							Key: "photo%2.jpg",
+						},
+					},
+				},
+			},
+		}
+
+		actual := handler.getPhotoParams(event)
+
+		assert.Equal(t, []photo.GetPhotoParams{{Bucket: "bucketName", Key: "2021/Beach Day (2).jpg"}}, actual)
+	})
+}
+
+func (s *handlerTestSuite) TestGetPhotoParamsFiltered() {
+	s.T().Run("skips excluded and oversized objects", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, nil, objectkey.KeyMapper{}, filter.Filter{Exclude: []string{"*.mp4", "Thumbs.db"}, MaxSize: 1024}, config.Concurrency{}, nil)
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucketName"}, Object: events.S3Object{Key: "2021/clip.mp4", Size: 10}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucketName"}, Object: events.S3Object{Key: "2021/Thumbs.db", Size: 10}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucketName"}, Object: events.S3Object{Key: "2021/huge.jpg", Size: 2048}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucketName"}, Object: events.S3Object{Key: "2021/photo.jpg", Size: 512}}},
+			},
+		}
+
+		actual := handler.getPhotoParams(event)
+
+		assert.Equal(t, []photo.GetPhotoParams{{Bucket: "bucketName", Key: "2021/photo.jpg", Size: 512}}, actual)
+	})
+}
+
+func (s *handlerTestSuite) TestGetImagesFiltered() {
+	s.T().Run("skips objects the repository filtered out before downloading", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, nil, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		photoOutput := photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg", ContentType: "image/jpeg"}
+
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "photo.jpg"}).Return(photoOutput, nil)
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "clip"}).Return(photo.GetPhotoOutput{}, filter.SkippedObjectError{Object: filter.Object{Key: "clip", ContentType: "video/mp4"}, Err: errors.New("content type video/mp4 is not allowed")})
+
+		actual, err := handler.getImages([]photo.GetPhotoParams{{Bucket: "bucket", Key: "clip"}, {Bucket: "bucket", Key: "photo.jpg"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []photo.GetPhotoOutput{photoOutput}, actual)
+	})
+
+	s.T().Run("skips objects over the byte limit permanently", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, nil, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		photoOutput := photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg", ContentType: "image/jpeg"}
+
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "photo.jpg"}).Return(photoOutput, nil)
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "panorama.jpg"}).Return(photo.GetPhotoOutput{}, processor.ImageTooLargeError{Err: errors.New("too large")})
+
+		actual, err := handler.getImages([]photo.GetPhotoParams{{Bucket: "bucket", Key: "panorama.jpg"}, {Bucket: "bucket", Key: "photo.jpg"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []photo.GetPhotoOutput{photoOutput}, actual)
+	})
 }
 
 func (s *handlerTestSuite) TestGetImages() {
 	s.T().Run("returns slice of images from s3", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 		s.photoRepository.On("Get", photo.GetPhotoParams{
 			Bucket: "bucket",
 			Key:    "photo",
@@ -99,7 +198,7 @@ func (s *handlerTestSuite) TestGetImages() {
 
 	s.T().Run("returns error if failed to get image from s3", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
 		s.photoRepository.On("Get", photo.GetPhotoParams{
 			Bucket: "bucket",
@@ -132,7 +231,7 @@ func (s *handlerTestSuite) TestGetImages() {
 func (s *handlerTestSuite) TestProcessImages() {
 	s.T().Run("returns slice of processed images", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 		expected := []processor.Image{
 			{
 				Image:  []byte{},
@@ -146,26 +245,27 @@ func (s *handlerTestSuite) TestProcessImages() {
 			},
 		}
 
-		s.imageProcessor.On("Run", processor.Image{
+		s.imageProcessor.On("RunDecoded", decoded(photo.GetPhotoOutput{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo",
-		}).Return(processor.Image{
+		})).Return(processor.Image{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo",
 		}, nil)
 
-		actual, err := handler.processImages([]photo.GetPhotoOutput{
-			{
+		actual, _, err := handler.processImages([]processor.DecodedImage{
+			decoded(photo.GetPhotoOutput{
 				Image:  []byte{},
 				Bucket: "bucket",
 				Key:    "photo",
-			}, {
+			}),
+			decoded(photo.GetPhotoOutput{
 				Image:  []byte{},
 				Bucket: "bucket",
 				Key:    "photo",
-			},
+			}),
 		})
 
 		assert.Nil(t, err)
@@ -174,44 +274,435 @@ func (s *handlerTestSuite) TestProcessImages() {
 
 	s.T().Run("return error if image failed to process", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
-		s.imageProcessor.On("Run", processor.Image{
+		s.imageProcessor.On("RunDecoded", decoded(photo.GetPhotoOutput{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo1",
-		}).Return(processor.Image{
+		})).Return(processor.Image{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo1",
 		}, nil)
 
-		s.imageProcessor.On("Run", processor.Image{
+		s.imageProcessor.On("RunDecoded", decoded(photo.GetPhotoOutput{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo2",
-		}).Return(processor.Image{}, errors.New("something went wrong"))
+		})).Return(processor.Image{}, errors.New("something went wrong"))
 
-		_, err := handler.processImages([]photo.GetPhotoOutput{
-			{
+		_, _, err := handler.processImages([]processor.DecodedImage{
+			decoded(photo.GetPhotoOutput{
 				Image:  []byte{},
 				Bucket: "bucket",
 				Key:    "photo1",
-			}, {
+			}),
+			decoded(photo.GetPhotoOutput{
 				Image:  []byte{},
 				Bucket: "bucket",
 				Key:    "photo2",
-			},
+			}),
 		})
 
 		assert.Equal(t, "something went wrong", err.Error())
 	})
 }
 
+func (s *handlerTestSuite) TestDecodeImages() {
+	s.T().Run("skips images that are too large without returning an error", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{errs: map[string]error{
+			"bomb.png": processor.StageError{Stage: processor.StageDecode, Err: processor.ImageTooLargeError{Err: errors.New("too large")}},
+		}}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		photoOutput := photo.GetPhotoOutput{Image: []byte{2}, Bucket: "bucket", Key: "photo"}
+
+		actual, err := handler.decodeImages([]photo.GetPhotoOutput{{Image: []byte{1}, Bucket: "bucket", Key: "bomb.png"}, photoOutput})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []processor.DecodedImage{decoded(photoOutput)}, actual)
+	})
+
+	s.T().Run("returns other decode errors", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{errs: map[string]error{
+			"Thumbs.db": processor.StageError{Stage: processor.StageDecode, Err: processor.DecodeImageError{Err: errors.New("unsupported image format")}},
+		}}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+
+		_, err := handler.decodeImages([]photo.GetPhotoOutput{{Image: []byte{1}, Bucket: "bucket", Key: "Thumbs.db"}})
+
+		assert.True(t, errors.Is(err, processor.DecodeImageError{}))
+	})
+}
+
+func (s *handlerTestSuite) TestProcessImagesRejected() {
+	s.T().Run("reports rejected images and drops their renditions", func(t *testing.T) {
+		s.setUpMocks()
+		thumbnailProcessor := new(mockImageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{
+			{Name: "frame-480", ImageProcessor: s.imageProcessor},
+			{Name: "thumb-200", ImageProcessor: thumbnailProcessor},
+		}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		scores := processor.QualityScores{Sharpness: 2, Brightness: 120, Deviation: 40}
+
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "blurred.jpg"}, nil)
+		thumbnailProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{}, processor.StageError{
+			Stage: processor.StageQuality,
+			Err:   processor.RejectedImageError{Err: errors.New("rejected image: sharpness 2.0 is below 10"), Scores: scores},
+		})
+
+		actual, rejections, err := handler.processImages([]processor.DecodedImage{decoded(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "blurred.jpg"})})
+
+		assert.Nil(t, err)
+		assert.Empty(t, actual)
+		assert.Equal(t, []Rejection{
+			{Bucket: "bucket", Key: "blurred.jpg", Reason: "rejected image: sharpness 2.0 is below 10", Scores: scores},
+		}, rejections)
+	})
+}
+
+func (s *handlerTestSuite) TestRunRejected() {
+	s.T().Run("neither writes nor indexes rejected images", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "dark.jpg"}, nil)
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.hasher.On("Hash", mock.Anything).Return(uint64(42))
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{}, processor.StageError{
+			Stage: processor.StageQuality,
+			Err:   processor.RejectedImageError{Err: errors.New("rejected image: brightness 3.0 is below 15")},
+		})
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{Name: "bucket"},
+						Object: events.S3Object{Key: "dark.jpg"},
+					},
+				},
+			},
+		})
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertNotCalled(t, "Put", mock.Anything)
+		s.hashIndex.AssertNotCalled(t, "Put", mock.Anything)
+	})
+
+	s.T().Run("writes a later near-duplicate of a rejected photo", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+
+		for _, key := range []string{"blurred.jpg", "sharp.jpg"} {
+			s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: key}).Return(photo.GetPhotoOutput{Image: []byte(key), Bucket: "bucket", Key: key}, nil)
+		}
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.hasher.On("Hash", mock.Anything).Return(uint64(42))
+		s.imageProcessor.On("RunDecoded", mock.MatchedBy(func(image processor.DecodedImage) bool { return "blurred.jpg" == image.Key })).Return(processor.Image{}, processor.StageError{
+			Stage: processor.StageQuality,
+			Err:   processor.RejectedImageError{Err: errors.New("rejected image: sharpness 2.0 is below 10")},
+		})
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "sharp.jpg"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", index.Entry{Hash: 42, Key: "sharp.jpg"}).Return(nil)
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "blurred.jpg"}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "sharp.jpg"}}},
+			},
+		})
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte{2}, Key: "sharp.jpg", Bucket: "display"})
+		s.hashIndex.AssertExpectations(t)
+		s.hashIndex.AssertNumberOfCalls(t, "Put", 1)
+	})
+
+	s.T().Run("writes a later near-duplicate of a photo that failed to write", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+
+		for _, key := range []string{"first.jpg", "second.jpg"} {
+			s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: key}).Return(photo.GetPhotoOutput{Image: []byte(key), Bucket: "bucket", Key: key}, nil)
+			s.imageProcessor.On("RunDecoded", mock.MatchedBy(func(image processor.DecodedImage) bool { return key == image.Key })).Return(processor.Image{Image: []byte(key), Bucket: "bucket", Key: key}, nil)
+		}
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.hasher.On("Hash", mock.Anything).Return(uint64(42))
+		s.photoRepository.On("Put", photo.PutPhotoParams{Image: []byte("first.jpg"), Key: "first.jpg", Bucket: "display"}).Return(errors.New("slow down"))
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", index.Entry{Hash: 42, Key: "second.jpg"}).Return(nil)
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "first.jpg"}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "second.jpg"}}},
+			},
+		})
+
+		assert.NotNil(t, err)
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte("second.jpg"), Key: "second.jpg", Bucket: "display"})
+		s.hashIndex.AssertExpectations(t)
+	})
+}
+
+func (s *handlerTestSuite) TestProcessImagesRenditions() {
+	s.T().Run("writes every rendition under its name prefix", func(t *testing.T) {
+		s.setUpMocks()
+		thumbnailProcessor := new(mockImageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{
+			{Name: "frame-480", ImageProcessor: s.imageProcessor},
+			{Name: "thumb-200", ImageProcessor: thumbnailProcessor},
+		}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+		input := decoded(photo.GetPhotoOutput{
+			Image:  []byte{1},
+			Bucket: "bucket",
+			Key:    "2021/photo.jpg",
+		})
+
+		s.imageProcessor.On("RunDecoded", input).Return(processor.Image{
+			Image:  []byte{2},
+			Bucket: "bucket",
+			Key:    "2021/photo.jpg",
+		}, nil)
+		thumbnailProcessor.On("RunDecoded", input).Return(processor.Image{
+			Image:  []byte{3},
+			Bucket: "bucket",
+			Key:    "2021/photo.jpg",
+		}, nil)
+
+		actual, _, err := handler.processImages([]processor.DecodedImage{input})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []processor.Image{
+			{
+				Image:  []byte{2},
+				Bucket: "bucket",
+				Key:    "frame-480/2021/photo.jpg",
+			},
+			{
+				Image:  []byte{3},
+				Bucket: "bucket",
+				Key:    "thumb-200/2021/photo.jpg",
+			},
+		}, actual)
+	})
+
+	s.T().Run("writes renditions under display keys with the output extension", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{
+			{Name: "frame-480", ImageProcessor: s.imageProcessor},
+		}, objectkey.NewKeyMapper(".jpg", true), filter.Filter{}, config.Concurrency{}, nil)
+
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "2021/photo.heic"}, nil)
+
+		actual, _, err := handler.processImages([]processor.DecodedImage{decoded(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "2021/photo.heic"})})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []processor.Image{{Image: []byte{2}, Bucket: "bucket", Key: "frame-480/2021_photo.heic.jpg"}}, actual)
+	})
+}
+
+func (s *handlerTestSuite) TestClaimImages() {
+	s.T().Run("skips images within the hamming distance of an indexed image", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+		images := []processor.DecodedImage{
+			decoded(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "IMG_1234 (1).jpg"}),
+			decoded(photo.GetPhotoOutput{Image: []byte{2}, Bucket: "bucket", Key: "IMG_1300.jpg"}),
+			decoded(photo.GetPhotoOutput{Image: []byte{3}, Bucket: "bucket", Key: "IMG_1300 edited.jpg"}),
+		}
+
+		s.hashIndex.On("List").Return([]index.Entry{{Hash: 0b1111, Key: "IMG_1234.jpg"}}, nil)
+		s.hasher.On("Hash", images[0]).Return(uint64(0b0111))
+		s.hasher.On("Hash", images[1]).Return(uint64(0xFF00))
+		s.hasher.On("Hash", images[2]).Return(uint64(0xFF03))
+
+		seen, err := handler.loadHashes()
+		assert.Nil(t, err)
+
+		unique, entries := handler.claimImages(seen, images)
+
+		assert.Equal(t, []processor.DecodedImage{images[1]}, unique)
+		assert.Equal(t, []index.Entry{{Hash: 0xFF00, Key: "IMG_1300.jpg"}}, entries)
+	})
+
+	s.T().Run("does not treat a re-upload of the same key as a duplicate", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+		images := []processor.DecodedImage{decoded(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "IMG_1234.jpg"})}
+
+		s.hashIndex.On("List").Return([]index.Entry{{Hash: 0b1111, Key: "IMG_1234.jpg"}}, nil)
+		s.hasher.On("Hash", mock.Anything).Return(uint64(0b1110))
+
+		seen, err := handler.loadHashes()
+		assert.Nil(t, err)
+
+		unique, entries := handler.claimImages(seen, images)
+
+		assert.Equal(t, images, unique)
+		assert.Equal(t, []index.Entry{{Hash: 0b1110, Key: "IMG_1234.jpg"}}, entries)
+	})
+
+	s.T().Run("returns index errors", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher: s.hasher,
+			Index:  s.hashIndex,
+		})
+
+		s.hashIndex.On("List").Return([]index.Entry{}, errors.New("access denied"))
+
+		_, err := handler.loadHashes()
+
+		assert.Equal(t, "access denied", err.Error())
+	})
+}
+
+func (s *handlerTestSuite) TestRunDuplicates() {
+	s.T().Run("indexes new images once they are written", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo"}, nil)
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.hasher.On("Hash", mock.Anything).Return(uint64(42))
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "photo"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", index.Entry{Hash: 42, Key: "photo"}).Return(nil)
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{Name: "bucket"},
+						Object: events.S3Object{Key: "photo"},
+					},
+				},
+			},
+		})
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte{2}, Key: "photo", Bucket: "display"})
+		s.hashIndex.AssertExpectations(t)
+	})
+
+	s.T().Run("writes two different photos from the same batch", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", processor.NewDecoder(processor.DefaultLimits()), []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      processor.NewDifferenceHasher(),
+			Index:       s.hashIndex,
+			MaxDistance: 6,
+		})
+
+		for key, data := range map[string][]byte{"sunrise.png": gradientPNG(false), "sunset.png": gradientPNG(true)} {
+			s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: key}).Return(photo.GetPhotoOutput{Image: data, Bucket: "bucket", Key: key}, nil)
+			s.imageProcessor.On("RunDecoded", mock.MatchedBy(func(image processor.DecodedImage) bool { return key == image.Key })).Return(processor.Image{Image: []byte{1}, Bucket: "bucket", Key: key}, nil)
+		}
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "sunrise.png"}}},
+				{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "bucket"}, Object: events.S3Object{Key: "sunset.png"}}},
+			},
+		})
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte{1}, Key: "sunrise.png", Bucket: "display"})
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte{1}, Key: "sunset.png", Bucket: "display"})
+		s.hashIndex.AssertNumberOfCalls(t, "Put", 2)
+	})
+
+	s.T().Run("decodes each photo once for the hash and every rendition", func(t *testing.T) {
+		s.setUpMocks()
+		var calls int32
+		thumbnailProcessor := new(mockImageProcessor)
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{calls: &calls}, []Rendition{
+			{ImageProcessor: s.imageProcessor},
+			{Name: "thumb-200", ImageProcessor: thumbnailProcessor},
+		}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+		input := decoded(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo"})
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo"}, nil)
+		s.hashIndex.On("List").Return([]index.Entry{}, nil)
+		s.hasher.On("Hash", input).Return(uint64(42))
+		s.imageProcessor.On("RunDecoded", input).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "photo"}, nil)
+		thumbnailProcessor.On("RunDecoded", input).Return(processor.Image{Image: []byte{3}, Bucket: "bucket", Key: "photo"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), events.S3Event{
+			Records: []events.S3EventRecord{
+				{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{Name: "bucket"},
+						Object: events.S3Object{Key: "photo"},
+					},
+				},
+			},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		s.hasher.AssertExpectations(t)
+		s.imageProcessor.AssertExpectations(t)
+		thumbnailProcessor.AssertExpectations(t)
+	})
+}
+
 func (s *handlerTestSuite) TestPutImages() {
+	s.T().Run("writes renditions with their content type", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
+
+		s.photoRepository.On("Put", photo.PutPhotoParams{
+			Image:       []byte{1},
+			Bucket:      "display",
+			Key:         "frame-480/photo.jpg",
+			ContentType: "image/jpeg",
+		}).Return(nil)
+
+		err := handler.putImages([]processor.Image{{Image: []byte{1}, Bucket: "bucket", Key: "frame-480/photo.jpg", ContentType: "image/jpeg"}})
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertExpectations(t)
+	})
+
 	s.T().Run("returns error if image failed to upload", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
 		s.photoRepository.On("Put", photo.PutPhotoParams{
 			Image:  []byte{},
@@ -244,7 +735,7 @@ func (s *handlerTestSuite) TestPutImages() {
 func (s *handlerTestSuite) TestRun() {
 	s.T().Run("returns s3.Get error", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
 		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{}, errors.New("something went wrong"))
 
@@ -264,12 +755,12 @@ func (s *handlerTestSuite) TestRun() {
 		})
 
 		assert.NotNil(t, err)
-		assert.Equal(t, "something went wrong", err.Error())
+		assert.Equal(t, "failed records: photo: something went wrong", err.Error())
 	})
 
 	s.T().Run("returns processor.Run error", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
 		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{
 			Image:  []byte{},
@@ -277,7 +768,7 @@ func (s *handlerTestSuite) TestRun() {
 			Key:    "photo",
 		}, nil)
 
-		s.imageProcessor.On("Run", mock.Anything).Return(processor.Image{}, errors.New("something went wrong"))
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{}, errors.New("something went wrong"))
 
 		err := handler.Run(context.Background(), events.S3Event{
 			Records: []events.S3EventRecord{
@@ -295,12 +786,12 @@ func (s *handlerTestSuite) TestRun() {
 		})
 
 		assert.NotNil(t, err)
-		assert.Equal(t, "something went wrong", err.Error())
+		assert.Equal(t, "failed records: photo: something went wrong", err.Error())
 	})
 
 	s.T().Run("returns s3.Put error", func(t *testing.T) {
 		s.setUpMocks()
-		handler := NewHandler(s.photoRepository, "bucket", s.imageProcessor)
+		handler := NewHandler(s.photoRepository, "bucket", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{}, nil)
 
 		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{
 			Image:  []byte{},
@@ -308,7 +799,7 @@ func (s *handlerTestSuite) TestRun() {
 			Key:    "photo",
 		}, nil)
 
-		s.imageProcessor.On("Run", mock.Anything).Return(processor.Image{
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{
 			Image:  []byte{},
 			Bucket: "bucket",
 			Key:    "photo",
@@ -332,7 +823,214 @@ func (s *handlerTestSuite) TestRun() {
 		})
 
 		assert.NotNil(t, err)
-		assert.Equal(t, "something went wrong", err.Error())
+		assert.Equal(t, "failed records: photo: something went wrong", err.Error())
+	})
+}
+
+// trackingProcessor records how many photos it is processing at once.
+type trackingProcessor struct {
+	active  int32
+	maximum int32
+}
+
+func (p *trackingProcessor) RunDecoded(image processor.DecodedImage) (processor.Image, error) {
+	active := atomic.AddInt32(&p.active, 1)
+	for {
+		maximum := atomic.LoadInt32(&p.maximum)
+		if active <= maximum || atomic.CompareAndSwapInt32(&p.maximum, maximum, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(&p.active, -1)
+
+	return processor.Image{Image: []byte{1}, Bucket: image.Bucket, Key: image.Key}, nil
+}
+
+func records(count int, size int64) events.S3Event {
+	var event events.S3Event
+	for i := 0; i < count; i++ {
+		event.Records = append(event.Records, events.S3EventRecord{
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: "bucket"},
+				Object: events.S3Object{Key: fmt.Sprintf("photo-%d.jpg", i), Size: size},
+			},
+		})
+	}
+
+	return event
+}
+
+func (s *handlerTestSuite) TestRunConcurrently() {
+	s.T().Run("processes every record on a bounded pool of workers", func(t *testing.T) {
+		s.setUpMocks()
+		tracker := new(trackingProcessor)
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{Name: "frame-480", ImageProcessor: tracker}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 3}, nil)
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), records(12, 0))
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 12)
+		s.photoRepository.AssertCalled(t, "Put", photo.PutPhotoParams{Image: []byte{1}, Key: "frame-480/photo.jpg", Bucket: "display"})
+		assert.LessOrEqual(t, tracker.maximum, int32(3))
+		assert.Greater(t, tracker.maximum, int32(1))
+	})
+
+	s.T().Run("keeps the photos in progress within the memory budget", func(t *testing.T) {
+		s.setUpMocks()
+		tracker := new(trackingProcessor)
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: tracker}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 8, MemoryBudget: 2048}, nil)
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), records(8, 1000))
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 8)
+		assert.LessOrEqual(t, tracker.maximum, int32(2))
+	})
+
+	s.T().Run("finishes the other records when one fails", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 4}, nil)
+
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "photo-2.jpg"}).Return(photo.GetPhotoOutput{}, errors.New("something went wrong"))
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), records(6, 0))
+
+		assert.Equal(t, "failed records: photo-2.jpg: something went wrong", err.Error())
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 5)
+	})
+
+	s.T().Run("skips duplicates across concurrent records", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 4}, &Duplicates{
+			Hasher:      s.hasher,
+			Index:       s.hashIndex,
+			MaxDistance: 2,
+		})
+
+		s.hashIndex.On("List").Return([]index.Entry{}, nil).Once()
+		for i := 0; i < 8; i++ {
+			key := fmt.Sprintf("photo-%d.jpg", i)
+			s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: key}).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: key}, nil)
+		}
+		s.hasher.On("Hash", mock.Anything).Return(uint64(0xFF))
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+		s.hashIndex.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), records(8, 0))
+
+		assert.Nil(t, err)
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 1)
+		s.hashIndex.AssertNumberOfCalls(t, "Put", 1)
+	})
+}
+
+func (s *handlerTestSuite) TestRunPartialFailures() {
+	s.T().Run("lists every failed record", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 4}, nil)
+
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "photo-1.jpg"}).Return(photo.GetPhotoOutput{}, errors.New("access denied"))
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "photo-3.jpg"}).Return(photo.GetPhotoOutput{}, errors.New("slow down"))
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		err := handler.Run(context.Background(), records(4, 0))
+
+		var batchErr batch.BatchError
+		assert.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, []string{"photo-1.jpg", "photo-3.jpg"}, []string{batchErr.Failures[0].Key, batchErr.Failures[1].Key})
+		assert.Equal(t, "failed records: photo-1.jpg: access denied; photo-3.jpg: slow down", err.Error())
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 2)
+	})
+}
+
+func (s *handlerTestSuite) TestRunSQS() {
+	s.T().Run("reports the messages whose photos failed", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 2}, nil)
+		body := func(key string) string {
+			return `{"Records":[{"s3":{"bucket":{"name":"bucket"},"object":{"key":"` + key + `"}}}]}`
+		}
+
+		s.photoRepository.On("Get", photo.GetPhotoParams{Bucket: "bucket", Key: "summer 2021/IMG_1300.jpg"}).Return(photo.GetPhotoOutput{}, errors.New("slow down"))
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		response, err := handler.RunSQS(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+			{MessageId: "1", Body: body("IMG_1234.jpg")},
+			{MessageId: "2", Body: body("summer+2021/IMG_1300.jpg")},
+		}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+		s.photoRepository.AssertNumberOfCalls(t, "Put", 1)
+	})
+
+	s.T().Run("reports the messages whose key cannot be decoded", func(t *testing.T) {
+		s.setUpMocks()
+		handler := NewHandler(s.photoRepository, "display", stubDecoder{}, []Rendition{{ImageProcessor: s.imageProcessor}}, objectkey.KeyMapper{}, filter.Filter{}, config.Concurrency{Workers: 2}, nil)
+		body := func(key string) string {
+			return `{"Records":[{"s3":{"bucket":{"name":"bucket"},"object":{"key":"` + key + `"}}}]}`
+		}
+
+		s.photoRepository.On("Get", mock.Anything).Return(photo.GetPhotoOutput{Image: []byte{1}, Bucket: "bucket", Key: "photo.jpg"}, nil)
+		s.imageProcessor.On("RunDecoded", mock.Anything).Return(processor.Image{Image: []byte{2}}, nil)
+		s.photoRepository.On("Put", mock.Anything).Return(nil)
+
+		response, err := handler.RunSQS(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+			{MessageId: "1", Body: body("IMG_1234.jpg")},
+			{MessageId: "2", Body: body("")},
+		}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}}, response.BatchItemFailures)
+		s.photoRepository.AssertNumberOfCalls(t, "Get", 1)
+	})
+}
+
+func (s *handlerTestSuite) TestBudget() {
+	s.T().Run("waits for memory to be released", func(t *testing.T) {
+		memory := newBudget(10)
+		first := memory.acquire(8)
+		acquired := make(chan int64)
+
+		go func() {
+			acquired <- memory.acquire(5)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("acquired more than the budget")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		memory.release(first)
+		assert.Equal(t, int64(5), <-acquired)
+	})
+
+	s.T().Run("lets photos larger than the budget run alone", func(t *testing.T) {
+		memory := newBudget(10)
+
+		assert.Equal(t, int64(10), memory.acquire(50))
+	})
+
+	s.T().Run("is unlimited without a capacity", func(t *testing.T) {
+		memory := newBudget(0)
+
+		assert.Equal(t, int64(0), memory.acquire(1<<40))
 	})
 }
 
@@ -354,15 +1052,84 @@ func (m *mockPhotoRepository) Put(params photo.PutPhotoParams) error {
 	return args.Error(0)
 }
 
+// stubDecoder stands in for decoding, keeping the source bytes as the pixels
+// of a one row grey image so tests can tell photos apart.
+type stubDecoder struct {
+	errs  map[string]error
+	calls *int32
+}
+
+func (d stubDecoder) Decode(input processor.Image) (processor.DecodedImage, error) {
+	if nil != d.calls {
+		atomic.AddInt32(d.calls, 1)
+	}
+	if err := d.errs[input.Key]; nil != err {
+		return processor.DecodedImage{}, err
+	}
+
+	return decoded(photo.GetPhotoOutput(input)), nil
+}
+
+// gradientPNG encodes a horizontal grey ramp, dark to light or reversed.
+func gradientPNG(reverse bool) []byte {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			value := uint8(x * 4)
+			if reverse {
+				value = 255 - value
+			}
+			img.Pix[y*img.Stride+x] = value
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	_ = png.Encode(buf, img)
+
+	return buf.Bytes()
+}
+
+func decoded(output photo.GetPhotoOutput) processor.DecodedImage {
+	return processor.DecodedImage{
+		Image:    &image.Gray{Pix: output.Image, Stride: len(output.Image), Rect: image.Rect(0, 0, len(output.Image), 1)},
+		Bucket:   output.Bucket,
+		Key:      output.Key,
+		Metadata: output.Metadata,
+	}
+}
+
 type mockImageProcessor struct {
 	mock.Mock
 }
 
-func (m *mockImageProcessor) Run(image processor.Image) (processor.Image, error) {
+func (m *mockImageProcessor) RunDecoded(image processor.DecodedImage) (processor.Image, error) {
 	args := m.Called(image)
 	return args.Get(0).(processor.Image), args.Error(1)
 }
 
+type mockHasher struct {
+	mock.Mock
+}
+
+func (m *mockHasher) Hash(image processor.DecodedImage) uint64 {
+	args := m.Called(image)
+	return args.Get(0).(uint64)
+}
+
+type mockHashIndex struct {
+	mock.Mock
+}
+
+func (m *mockHashIndex) List() ([]index.Entry, error) {
+	args := m.Called()
+	return args.Get(0).([]index.Entry), args.Error(1)
+}
+
+func (m *mockHashIndex) Put(entry index.Entry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
 func TestHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(handlerTestSuite))
 }
@@ -3,17 +3,22 @@ package photo
 type GetPhotoParams struct {
 	Bucket string
 	Key    string
+	// Size is the object size reported by the event, if known.
+	Size int64
 }
 type GetPhotoOutput struct {
-	Image  []byte
-	Bucket string
-	Key    string
+	Image       []byte
+	Bucket      string
+	Key         string
+	ContentType string
+	Metadata    map[string]string
 }
 
 type PutPhotoParams struct {
-	Image  []byte
-	Key    string
-	Bucket string
+	Image       []byte
+	Key         string
+	Bucket      string
+	ContentType string
 }
 
 type Repository interface {
@@ -4,16 +4,24 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
 )
 
 type s3Downloader interface {
 	Download(io.WriterAt, *s3.GetObjectInput, ...func(*s3manager.Downloader)) (int64, error)
 }
 
+type s3Client interface {
+	HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+}
+
 type s3Uploader interface {
 	Upload(*s3manager.UploadInput, ...func(uploader *s3manager.Uploader)) (*s3manager.UploadOutput, error)
 }
@@ -21,9 +29,38 @@ type s3Uploader interface {
 type S3 struct {
 	downloader s3Downloader
 	uploader   s3Uploader
+	client     s3Client
+	filter     filter.Filter
+	limits     processor.Limits
 }
 
+// Get reads the content type and metadata of an object before downloading
+// it, and returns the filter's SkippedObjectError without downloading objects
+// the filter does not let through. Objects over the byte limit are rejected
+// with ImageTooLargeError before they are downloaded too.
 func (s *S3) Get(params GetPhotoParams) (GetPhotoOutput, error) {
+	headObjectOutput, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(params.Bucket),
+		Key:    aws.String(params.Key),
+	})
+
+	if nil != err {
+		return GetPhotoOutput{}, GetPhotoError{Err: fmt.Errorf("error getting metadata for %s from %s: %s", params.Key, params.Bucket, err.Error())}
+	}
+
+	object := filter.Object{
+		Key:         params.Key,
+		ContentType: aws.StringValue(headObjectOutput.ContentType),
+		Size:        headObjectOutput.ContentLength,
+	}
+	if err := s.filter.Check(object); nil != err {
+		return GetPhotoOutput{}, err
+	}
+
+	if size := aws.Int64Value(headObjectOutput.ContentLength); 0 < s.limits.MaxBytes && size > int64(s.limits.MaxBytes) {
+		return GetPhotoOutput{}, processor.ImageTooLargeError{Err: fmt.Errorf("image %s/%s is %d bytes, limit is %d", params.Bucket, params.Key, size, s.limits.MaxBytes)}
+	}
+
 	getObjectInput := s3.GetObjectInput{
 		Bucket: aws.String(params.Bucket),
 		Key:    aws.String(params.Key),
@@ -31,16 +68,23 @@ func (s *S3) Get(params GetPhotoParams) (GetPhotoOutput, error) {
 
 	buffer := &aws.WriteAtBuffer{}
 
-	_, err := s.downloader.Download(buffer, &getObjectInput)
+	_, err = s.downloader.Download(buffer, &getObjectInput)
 
 	if nil != err {
 		return GetPhotoOutput{}, GetPhotoError{Err: fmt.Errorf("error getting %s from %s: %s", params.Key, params.Bucket, err.Error())}
 	}
 
+	metadata := map[string]string{}
+	for name, value := range headObjectOutput.Metadata {
+		metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+
 	output := GetPhotoOutput{
-		Bucket: params.Bucket,
-		Key:    params.Key,
-		Image:  buffer.Bytes(),
+		Bucket:      params.Bucket,
+		Key:         params.Key,
+		Image:       buffer.Bytes(),
+		ContentType: object.ContentType,
+		Metadata:    metadata,
 	}
 
 	return output, nil
@@ -52,6 +96,9 @@ func (s *S3) Put(params PutPhotoParams) error {
 		Bucket: aws.String(params.Bucket),
 		Key:    aws.String(params.Key),
 	}
+	if "" != params.ContentType {
+		putObjectInput.ContentType = aws.String(params.ContentType)
+	}
 
 	_, err := s.uploader.Upload(&putObjectInput)
 
@@ -62,9 +109,12 @@ func (s *S3) Put(params PutPhotoParams) error {
 	return nil
 }
 
-func NewS3(downloader s3Downloader, uploader s3Uploader) S3 {
+func NewS3(downloader s3Downloader, uploader s3Uploader, client s3Client, ingestFilter filter.Filter, limits processor.Limits) S3 {
 	return S3{
 		downloader: downloader,
 		uploader:   uploader,
+		client:     client,
+		filter:     ingestFilter,
+		limits:     limits,
 	}
 }
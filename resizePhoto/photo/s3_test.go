@@ -12,23 +12,28 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/ian-antking/king-family-photos/objectkey/filter"
+	"github.com/ian-antking/king-family-photos/resizePhoto/processor"
 )
 
 type s3TestSuite struct {
 	suite.Suite
 	downloader *mockS3Downloader
 	uploader   *mockS3Uploader
+	client     *mockS3Client
 }
 
 func (s *s3TestSuite) setUpMocks() {
 	s.downloader = new(mockS3Downloader)
 	s.uploader = new(mockS3Uploader)
+	s.client = new(mockS3Client)
 }
 
 func (s *s3TestSuite) TestGet() {
 	s.T().Run("calls Download with correct input", func(t *testing.T) {
 		s.setUpMocks()
-		photoRepo := NewS3(s.downloader, s.uploader)
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{})
 
 		s.downloader.On(
 			"Download",
@@ -39,6 +44,10 @@ func (s *s3TestSuite) TestGet() {
 			},
 			mock.Anything,
 		).Return(nil)
+		s.client.On("HeadObject", &s3.HeadObjectInput{
+			Bucket: aws.String("ingestBucket"),
+			Key:    aws.String("photoKey"),
+		}).Return(&s3.HeadObjectOutput{ContentType: aws.String("image/jpeg"), Metadata: map[string]*string{"Caption": aws.String("Beach day")}}, nil)
 
 		data := []byte("data")
 		idx := int64(len(data))
@@ -46,9 +55,11 @@ func (s *s3TestSuite) TestGet() {
 		_, _ = buffer.WriteAt(data, idx)
 
 		expected := GetPhotoOutput{
-			Image:  buffer.Bytes(),
-			Bucket: "ingestBucket",
-			Key:    "photoKey",
+			Image:       buffer.Bytes(),
+			Bucket:      "ingestBucket",
+			Key:         "photoKey",
+			ContentType: "image/jpeg",
+			Metadata:    map[string]string{"caption": "Beach day"},
 		}
 
 		actual, err := photoRepo.Get(GetPhotoParams{
@@ -62,7 +73,7 @@ func (s *s3TestSuite) TestGet() {
 
 	s.T().Run("forwards errors return from s3", func(t *testing.T) {
 		s.setUpMocks()
-		photoRepo := NewS3(s.downloader, s.uploader)
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{})
 
 		s.downloader.On(
 			"Download",
@@ -73,6 +84,7 @@ func (s *s3TestSuite) TestGet() {
 			},
 			mock.Anything,
 		).Return(errors.New("something went wrong"))
+		s.client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("image/jpeg")}, nil)
 
 		_, err := photoRepo.Get(GetPhotoParams{
 			Bucket: "ingestBucket",
@@ -83,23 +95,90 @@ func (s *s3TestSuite) TestGet() {
 		assert.True(t, errors.Is(err, GetPhotoError{}))
 		assert.Equal(t, "error getting photoKey from ingestBucket: something went wrong", err.Error())
 	})
+
+	s.T().Run("forwards metadata errors returned from s3", func(t *testing.T) {
+		s.setUpMocks()
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{})
+
+		s.client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{}, errors.New("forbidden"))
+
+		_, err := photoRepo.Get(GetPhotoParams{
+			Bucket: "ingestBucket",
+			Key:    "photoKey",
+		})
+
+		assert.True(t, errors.Is(err, GetPhotoError{}))
+		assert.Equal(t, "error getting metadata for photoKey from ingestBucket: forbidden", err.Error())
+		s.downloader.AssertNotCalled(t, "Download", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	s.T().Run("skips objects the filter does not allow without downloading them", func(t *testing.T) {
+		s.setUpMocks()
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{ContentTypes: []string{"image/*"}, MaxSize: 1 << 20}, processor.Limits{})
+
+		s.client.On("HeadObject", &s3.HeadObjectInput{
+			Bucket: aws.String("ingestBucket"),
+			Key:    aws.String("clip"),
+		}).Return(&s3.HeadObjectOutput{ContentType: aws.String("video/mp4"), ContentLength: aws.Int64(512)}, nil)
+		s.client.On("HeadObject", &s3.HeadObjectInput{
+			Bucket: aws.String("ingestBucket"),
+			Key:    aws.String("panorama.jpg"),
+		}).Return(&s3.HeadObjectOutput{ContentType: aws.String("image/jpeg"), ContentLength: aws.Int64(2 << 20)}, nil)
+
+		_, clipErr := photoRepo.Get(GetPhotoParams{Bucket: "ingestBucket", Key: "clip"})
+		_, panoramaErr := photoRepo.Get(GetPhotoParams{Bucket: "ingestBucket", Key: "panorama.jpg"})
+
+		assert.True(t, errors.Is(clipErr, filter.SkippedObjectError{}))
+		assert.Equal(t, "content type video/mp4 is not allowed", clipErr.Error())
+		assert.True(t, errors.Is(panoramaErr, filter.SkippedObjectError{}))
+		s.downloader.AssertNotCalled(t, "Download", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	s.T().Run("skips known zero byte objects and returns them with the error", func(t *testing.T) {
+		s.setUpMocks()
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{MinSize: 1}, processor.Limits{})
+
+		s.client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("image/jpeg"), ContentLength: aws.Int64(0)}, nil)
+
+		_, err := photoRepo.Get(GetPhotoParams{Bucket: "ingestBucket", Key: "empty.jpg"})
+
+		var skipped filter.SkippedObjectError
+		assert.True(t, errors.As(err, &skipped))
+		assert.Equal(t, filter.Object{Key: "empty.jpg", ContentType: "image/jpeg", Size: aws.Int64(0)}, skipped.Object)
+		s.downloader.AssertNotCalled(t, "Download", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	s.T().Run("rejects objects over the byte limit without downloading them", func(t *testing.T) {
+		s.setUpMocks()
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{MaxBytes: 1 << 20})
+
+		s.client.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("image/jpeg"), ContentLength: aws.Int64(2 << 20)}, nil)
+
+		_, err := photoRepo.Get(GetPhotoParams{Bucket: "ingestBucket", Key: "panorama.jpg"})
+
+		assert.True(t, errors.Is(err, processor.ImageTooLargeError{}))
+		assert.Equal(t, "image ingestBucket/panorama.jpg is 2097152 bytes, limit is 1048576", err.Error())
+		s.downloader.AssertNotCalled(t, "Download", mock.Anything, mock.Anything, mock.Anything)
+	})
 }
 
 func (s *s3TestSuite) TestPut() {
 	s.T().Run("calls Upload with correct input", func(t *testing.T) {
 		s.setUpMocks()
-		photoRepo := NewS3(s.downloader, s.uploader)
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{})
 
 		params := PutPhotoParams{
-			Image:  []byte{},
-			Key:    "photoKey",
-			Bucket: "displayBucket",
+			Image:       []byte{},
+			Key:         "photoKey",
+			Bucket:      "displayBucket",
+			ContentType: "image/jpeg",
 		}
 
 		s.uploader.On("Upload", &s3manager.UploadInput{
-			Body:   bytes.NewReader([]byte{}),
-			Bucket: aws.String("displayBucket"),
-			Key:    aws.String("photoKey"),
+			Body:        bytes.NewReader([]byte{}),
+			Bucket:      aws.String("displayBucket"),
+			ContentType: aws.String("image/jpeg"),
+			Key:         aws.String("photoKey"),
 		}, mock.Anything).Return(&s3manager.UploadOutput{}, nil)
 
 		err := photoRepo.Put(params)
@@ -109,7 +188,7 @@ func (s *s3TestSuite) TestPut() {
 
 	s.T().Run("forwards errors from s3", func(t *testing.T) {
 		s.setUpMocks()
-		photoRepo := NewS3(s.downloader, s.uploader)
+		photoRepo := NewS3(s.downloader, s.uploader, s.client, filter.Filter{}, processor.Limits{})
 
 		params := PutPhotoParams{
 			Image:  []byte{},
@@ -156,6 +235,15 @@ func (m *mockS3Uploader) Upload(input *s3manager.UploadInput, f ...func(uploader
 	return args.Get(0).(*s3manager.UploadOutput), args.Error(1)
 }
 
+type mockS3Client struct {
+	mock.Mock
+}
+
+func (m *mockS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*s3.HeadObjectOutput), args.Error(1)
+}
+
 func TestS3TestSuite(t *testing.T) {
 	suite.Run(t, new(s3TestSuite))
 }
@@ -0,0 +1,410 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"unicode/utf16"
+)
+
+const (
+	linearSteps      = 4096
+	profileTolerance = 0.002
+)
+
+var (
+	d50White = [3]float64{0.9642, 1.0, 0.8249}
+
+	// sRGB primaries adapted to the D50 profile connection space, one column per channel.
+	srgbPrimaries = [3][3]float64{
+		{0.4360747, 0.3850649, 0.1430804},
+		{0.2225045, 0.7168786, 0.0606169},
+		{0.0139322, 0.0971045, 0.7141733},
+	}
+
+	bradfordD65ToD50 = [3][3]float64{
+		{1.0478112, 0.0228866, -0.0501270},
+		{0.0295424, 0.9904844, -0.0170491},
+		{-0.0092345, 0.0150436, 0.7521316},
+	}
+
+	srgbCurve   = parametricCurve{kind: 3, params: []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}}
+	srgbFromXYZ = invert(srgbPrimaries)
+	srgbProfile = writeMatrixProfile("sRGB", srgbPrimaries, srgbCurve)
+	srgbEncode  = srgbEncodeTable()
+
+	errUnsupportedProfile = errors.New("unsupported icc profile")
+)
+
+type toneCurve interface {
+	linear(value float64) float64
+}
+
+type gammaCurve float64
+
+func (c gammaCurve) linear(value float64) float64 {
+	return math.Pow(value, float64(c))
+}
+
+type sampledCurve []uint16
+
+func (c sampledCurve) linear(value float64) float64 {
+	position := value * float64(len(c)-1)
+	index := minInt(int(position), len(c)-2)
+	fraction := position - float64(index)
+
+	return (float64(c[index])*(1-fraction) + float64(c[index+1])*fraction) / 65535
+}
+
+// parametricCurve implements the ICC parametricCurveType functions 0 to 4.
+type parametricCurve struct {
+	kind   uint16
+	params []float64
+}
+
+func (c parametricCurve) linear(value float64) float64 {
+	p := c.params
+	switch c.kind {
+	case 1:
+		if value >= -p[2]/p[1] {
+			return math.Pow(p[1]*value+p[2], p[0])
+		}
+		return 0
+	case 2:
+		if value >= -p[2]/p[1] {
+			return math.Pow(p[1]*value+p[2], p[0]) + p[3]
+		}
+		return p[3]
+	case 3:
+		if value >= p[4] {
+			return math.Pow(p[1]*value+p[2], p[0])
+		}
+		return p[3] * value
+	case 4:
+		if value >= p[4] {
+			return math.Pow(p[1]*value+p[2], p[0]) + p[5]
+		}
+		return p[3]*value + p[6]
+	}
+
+	return math.Pow(value, p[0])
+}
+
+// colourProfile is a matrix/TRC profile reduced to lookup tables for
+// 8-bit channels and a single matrix straight to linear sRGB.
+type colourProfile struct {
+	linear [3][256]float64
+	matrix [3][3]float64
+}
+
+func (p colourProfile) isSRGB() bool {
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			expected := 0.0
+			if row == column {
+				expected = 1
+			}
+			if profileTolerance < math.Abs(p.matrix[row][column]-expected) {
+				return false
+			}
+		}
+	}
+
+	for channel := 0; channel < 3; channel++ {
+		for value := 0; value < 256; value++ {
+			if profileTolerance < math.Abs(p.linear[channel][value]-srgbCurve.linear(float64(value)/255)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (p colourProfile) convert(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	converted := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(converted, converted.Bounds(), img, bounds.Min, draw.Src)
+
+	m := p.matrix
+	for i := 0; i < len(converted.Pix); i += 4 {
+		r := p.linear[0][converted.Pix[i]]
+		g := p.linear[1][converted.Pix[i+1]]
+		b := p.linear[2][converted.Pix[i+2]]
+
+		converted.Pix[i] = encodeLinear(m[0][0]*r + m[0][1]*g + m[0][2]*b)
+		converted.Pix[i+1] = encodeLinear(m[1][0]*r + m[1][1]*g + m[1][2]*b)
+		converted.Pix[i+2] = encodeLinear(m[2][0]*r + m[2][1]*g + m[2][2]*b)
+	}
+
+	return converted
+}
+
+func encodeLinear(value float64) uint8 {
+	if 0 >= value {
+		return 0
+	}
+	if 1 <= value {
+		return 255
+	}
+
+	return srgbEncode[int(value*(linearSteps-1)+0.5)]
+}
+
+func srgbEncodeTable() [linearSteps]uint8 {
+	var table [linearSteps]uint8
+	for i := range table {
+		value := float64(i) / (linearSteps - 1)
+		if 0.0031308 >= value {
+			value *= 12.92
+		} else {
+			value = 1.055*math.Pow(value, 1/2.4) - 0.055
+		}
+		table[i] = uint8(math.Round(value * 255))
+	}
+
+	return table
+}
+
+func isRGBProfile(data []byte) bool {
+	return 20 <= len(data) && "RGB " == string(data[16:20])
+}
+
+func parseColourProfile(data []byte) (colourProfile, error) {
+	if 132 > len(data) || "acsp" != string(data[36:40]) || "XYZ " != string(data[20:24]) {
+		return colourProfile{}, errUnsupportedProfile
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count && 132+12*(i+1) <= len(data); i++ {
+		entry := data[132+12*i:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if 0 > offset || 0 > size || offset+size > len(data) {
+			return colourProfile{}, errUnsupportedProfile
+		}
+		tags[string(entry[:4])] = data[offset : offset+size]
+	}
+
+	var profile colourProfile
+	var curves [3]toneCurve
+	var err error
+
+	switch string(data[16:20]) {
+	case "RGB ":
+		var primaries [3][3]float64
+		for channel, prefix := range []string{"r", "g", "b"} {
+			xyz, xyzErr := readXYZ(tags[prefix+"XYZ"])
+			if nil != xyzErr {
+				return colourProfile{}, xyzErr
+			}
+			for row := 0; row < 3; row++ {
+				primaries[row][channel] = xyz[row]
+			}
+
+			if curves[channel], err = readCurve(tags[prefix+"TRC"]); nil != err {
+				return colourProfile{}, err
+			}
+		}
+		profile.matrix = multiply(srgbFromXYZ, primaries)
+	case "GRAY":
+		curve, curveErr := readCurve(tags["kTRC"])
+		if nil != curveErr {
+			return colourProfile{}, curveErr
+		}
+		curves = [3]toneCurve{curve, curve, curve}
+		profile.matrix = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	default:
+		return colourProfile{}, errUnsupportedProfile
+	}
+
+	for channel, curve := range curves {
+		for value := 0; value < 256; value++ {
+			profile.linear[channel][value] = curve.linear(float64(value) / 255)
+		}
+	}
+
+	return profile, nil
+}
+
+func readXYZ(tag []byte) ([3]float64, error) {
+	if 20 > len(tag) || "XYZ " != string(tag[:4]) {
+		return [3]float64{}, errUnsupportedProfile
+	}
+
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+func readCurve(tag []byte) (toneCurve, error) {
+	if 12 > len(tag) {
+		return nil, errUnsupportedProfile
+	}
+
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+2*count > len(tag) {
+			return nil, errUnsupportedProfile
+		}
+
+		switch count {
+		case 0:
+			return gammaCurve(1), nil
+		case 1:
+			return gammaCurve(float64(binary.BigEndian.Uint16(tag[12:])) / 256), nil
+		}
+
+		samples := make(sampledCurve, count)
+		for i := range samples {
+			samples[i] = binary.BigEndian.Uint16(tag[12+2*i:])
+		}
+
+		return samples, nil
+	case "para":
+		kind := binary.BigEndian.Uint16(tag[8:])
+		counts := []int{1, 3, 4, 5, 7}
+		if int(kind) >= len(counts) || 12+4*counts[kind] > len(tag) {
+			return nil, errUnsupportedProfile
+		}
+
+		params := make([]float64, counts[kind])
+		for i := range params {
+			params[i] = s15Fixed16(tag[12+4*i:])
+		}
+
+		return parametricCurve{kind: kind, params: params}, nil
+	}
+
+	return nil, errUnsupportedProfile
+}
+
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+func writeS15Fixed16(buf *bytes.Buffer, value float64) {
+	_ = binary.Write(buf, binary.BigEndian, int32(math.Round(value*65536)))
+}
+
+// writeMatrixProfile builds a minimal ICC v4 display profile from D50
+// adapted primaries and one tone curve shared by all three channels.
+func writeMatrixProfile(description string, primaries [3][3]float64, curve parametricCurve) []byte {
+	text := func(value string) []byte {
+		encoded := utf16.Encode([]rune(value))
+		buf := new(bytes.Buffer)
+		buf.WriteString("mluc\x00\x00\x00\x00")
+		_ = binary.Write(buf, binary.BigEndian, []uint32{1, 12})
+		buf.WriteString("enUS")
+		_ = binary.Write(buf, binary.BigEndian, []uint32{uint32(2 * len(encoded)), 28})
+		_ = binary.Write(buf, binary.BigEndian, encoded)
+		return buf.Bytes()
+	}
+
+	xyz := func(values ...float64) []byte {
+		buf := new(bytes.Buffer)
+		buf.WriteString("XYZ \x00\x00\x00\x00")
+		for _, value := range values {
+			writeS15Fixed16(buf, value)
+		}
+		return buf.Bytes()
+	}
+
+	trc := new(bytes.Buffer)
+	trc.WriteString("para\x00\x00\x00\x00")
+	_ = binary.Write(trc, binary.BigEndian, []uint16{curve.kind, 0})
+	for _, param := range curve.params {
+		writeS15Fixed16(trc, param)
+	}
+
+	chad := new(bytes.Buffer)
+	chad.WriteString("sf32\x00\x00\x00\x00")
+	for _, row := range bradfordD65ToD50 {
+		for _, value := range row {
+			writeS15Fixed16(chad, value)
+		}
+	}
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", text(description)},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(d50White[:]...)},
+		{"chad", chad.Bytes()},
+		{"rXYZ", xyz(primaries[0][0], primaries[1][0], primaries[2][0])},
+		{"gXYZ", xyz(primaries[0][1], primaries[1][1], primaries[2][1])},
+		{"bXYZ", xyz(primaries[0][2], primaries[1][2], primaries[2][2])},
+		{"rTRC", trc.Bytes()},
+		{"gTRC", trc.Bytes()},
+		{"bTRC", trc.Bytes()},
+	}
+
+	table := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+	offsets := map[string]int{}
+	dataStart := 128 + 4 + 12*len(tags)
+	_ = binary.Write(table, binary.BigEndian, uint32(len(tags)))
+	for _, tag := range tags {
+		offset, shared := offsets[string(tag.data)]
+		if !shared {
+			offset = dataStart + body.Len()
+			offsets[string(tag.data)] = offset
+			body.Write(tag.data)
+			for 0 != body.Len()%4 {
+				body.WriteByte(0)
+			}
+		}
+
+		table.WriteString(tag.signature)
+		_ = binary.Write(table, binary.BigEndian, []uint32{uint32(offset), uint32(len(tag.data))})
+	}
+
+	header := new(bytes.Buffer)
+	_ = binary.Write(header, binary.BigEndian, []uint32{uint32(dataStart + body.Len()), 0, 0x04300000})
+	header.WriteString("mntrRGB XYZ ")
+	header.Write(make([]byte, 12))
+	header.WriteString("acsp")
+	header.Write(make([]byte, 24))
+	_ = binary.Write(header, binary.BigEndian, uint32(0))
+	for _, value := range d50White {
+		writeS15Fixed16(header, value)
+	}
+	header.Write(make([]byte, 48))
+
+	return append(append(header.Bytes(), table.Bytes()...), body.Bytes()...)
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var product [3][3]float64
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			for k := 0; k < 3; k++ {
+				product[row][column] += a[row][k] * b[k][column]
+			}
+		}
+	}
+
+	return product
+}
+
+func invert(m [3][3]float64) [3][3]float64 {
+	determinant := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+
+	var inverse [3][3]float64
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			r0, r1 := (column+1)%3, (column+2)%3
+			c0, c1 := (row+1)%3, (row+2)%3
+			inverse[row][column] = (m[r0][c0]*m[r1][c1] - m[r0][c1]*m[r1][c0]) / determinant
+		}
+	}
+
+	return inverse
+}
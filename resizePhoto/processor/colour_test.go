@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type colourTestSuite struct {
+	suite.Suite
+}
+
+var displayP3Profile = writeMatrixProfile("Display P3", [3][3]float64{
+	{0.5151, 0.2920, 0.1571},
+	{0.2412, 0.6922, 0.0666},
+	{-0.0011, 0.0419, 0.7841},
+}, srgbCurve)
+
+func (s *colourTestSuite) TestParseColourProfile() {
+	s.T().Run("recognises the srgb output profile", func(t *testing.T) {
+		profile, err := parseColourProfile(srgbProfile)
+
+		assert.Nil(t, err)
+		assert.True(t, profile.isSRGB())
+	})
+
+	s.T().Run("returns an error for profiles without matrix and trc tags", func(t *testing.T) {
+		_, err := parseColourProfile(testProfile)
+
+		assert.Equal(t, errUnsupportedProfile, err)
+	})
+}
+
+func (s *colourTestSuite) TestConvert() {
+	s.T().Run("maps display p3 primaries onto srgb", func(t *testing.T) {
+		profile, _ := parseColourProfile(displayP3Profile)
+
+		converted := profile.convert(solid(2, 2, color.NRGBA{R: 200, A: 255}))
+		pixel := converted.NRGBAAt(0, 0)
+
+		assert.False(t, profile.isSRGB())
+		assert.InDelta(t, 219, int(pixel.R), 1)
+		assert.Equal(t, uint8(0), pixel.G)
+		assert.Equal(t, uint8(0), pixel.B)
+	})
+
+	s.T().Run("linearises with the profile tone curve", func(t *testing.T) {
+		profile, _ := parseColourProfile(writeMatrixProfile("Linear sRGB", srgbPrimaries, parametricCurve{params: []float64{1}}))
+
+		converted := profile.convert(solid(2, 2, color.NRGBA{R: 128, G: 128, B: 128, A: 128}))
+
+		assert.Equal(t, color.NRGBA{R: 188, G: 188, B: 188, A: 128}, converted.NRGBAAt(1, 1))
+	})
+}
+
+func (s *colourTestSuite) TestColourStage() {
+	s.T().Run("passes unreadable rgb profiles through with the unconverted pixels", func(t *testing.T) {
+		img := solid(2, 2, color.NRGBA{R: 200, A: 255})
+		profile := append([]byte{}, testProfile...)
+		copy(profile[16:], "RGB ")
+
+		decoded, err := NewColourStage().Apply(DecodedImage{Image: img, ICC: profile})
+
+		assert.Nil(t, err)
+		assert.Equal(t, img, decoded.Image)
+		assert.Equal(t, profile, decoded.OutputICC)
+	})
+
+	s.T().Run("tags unreadable profiles of other colour spaces as srgb", func(t *testing.T) {
+		img := solid(2, 2, color.NRGBA{R: 200, A: 255})
+		profile := append([]byte{}, testProfile...)
+		copy(profile[16:], "CMYK")
+
+		cmyk, err := NewColourStage().Apply(DecodedImage{Image: img, ICC: profile})
+		short, shortErr := NewColourStage().Apply(DecodedImage{Image: img, ICC: []byte("RGB ")})
+
+		assert.Nil(t, err)
+		assert.Nil(t, shortErr)
+		assert.Equal(t, img, cmyk.Image)
+		assert.Equal(t, srgbProfile, cmyk.OutputICC)
+		assert.Equal(t, srgbProfile, short.OutputICC)
+	})
+
+	s.T().Run("tags untagged and srgb uploads as srgb", func(t *testing.T) {
+		img := solid(2, 2, color.NRGBA{R: 200, A: 255})
+
+		untagged, err := NewColourStage().Apply(DecodedImage{Image: img})
+		tagged, taggedErr := NewColourStage().Apply(DecodedImage{Image: img, ICC: srgbProfile})
+
+		assert.Nil(t, err)
+		assert.Nil(t, taggedErr)
+		assert.Equal(t, srgbProfile, untagged.OutputICC)
+		assert.Equal(t, srgbProfile, tagged.OutputICC)
+		assert.Equal(t, img, tagged.Image)
+	})
+
+	s.T().Run("converts profiled uploads and embeds srgb in the output", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		_ = jpeg.Encode(buf, solid(16, 16, color.NRGBA{R: 200, A: 255}), &jpeg.Options{Quality: 100})
+
+		resizer := NewResizer(8, 8, WithStages(StageColour, StageResize))
+
+		output, err := resizer.Run(Image{Image: insertJPEGICC(buf.Bytes(), displayP3Profile)})
+		resized, _ := jpeg.Decode(bytes.NewReader(output.Image))
+		r, _, _, _ := resized.At(4, 4).RGBA()
+
+		assert.Nil(t, err)
+		assert.Equal(t, srgbProfile, readICCProfile(output.Image))
+		assert.InDelta(t, 219, int(r>>8), 3)
+	})
+
+	s.T().Run("embeds srgb in png output", func(t *testing.T) {
+		decoded := DecodedImage{Image: image.NewRGBA(image.Rect(0, 0, 8, 8)), OutputICC: srgbProfile}
+
+		output, err := decoded.Encode(NewPNGEncoder())
+		_, decodeErr := png.Decode(bytes.NewReader(output.Image))
+
+		assert.Nil(t, err)
+		assert.Nil(t, decodeErr)
+		assert.Equal(t, srgbProfile, readICCProfile(output.Image))
+	})
+
+	s.T().Run("finds ihdr by walking the png chunks", func(t *testing.T) {
+		encoded := encodeWith(func(buf *bytes.Buffer) error {
+			return png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+		})
+
+		assert.Equal(t, 33, pngChunkEnd(encoded, "IHDR"))
+		assert.Equal(t, -1, pngChunkEnd(encoded[:20], "IHDR"))
+		assert.Equal(t, encoded[:20], insertPNGICC(encoded[:20], srgbProfile))
+	})
+}
+
+func TestColourTestSuite(t *testing.T) {
+	suite.Run(t, new(colourTestSuite))
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// DecodedImage carries pixels between pipeline stages so an upload is
+// decoded once and encoded once. Exif and ICC hold the source metadata,
+// OutputExif and OutputICC what the encoder writes. Metadata is the source
+// object's user metadata.
+type DecodedImage struct {
+	Image      image.Image
+	Format     Format
+	Exif       []byte
+	ICC        []byte
+	OutputExif []byte
+	OutputICC  []byte
+	Bucket     string
+	Key        string
+	Metadata   map[string]string
+}
+
+// LimitedDecoder decodes photos within its limits, returning errors as a
+// StageError from the decode stage.
+type LimitedDecoder struct {
+	limits Limits
+}
+
+func (d LimitedDecoder) Decode(imageInput Image) (DecodedImage, error) {
+	decoded, err := Decode(imageInput, d.limits)
+	if nil != err {
+		return DecodedImage{}, StageError{Stage: StageDecode, Err: err}
+	}
+
+	return decoded, nil
+}
+
+func NewDecoder(limits Limits) LimitedDecoder {
+	return LimitedDecoder{
+		limits: limits,
+	}
+}
+
+func Decode(imageInput Image, limits Limits) (DecodedImage, error) {
+	format := DetectFormat(imageInput.Image)
+	if FormatUnknown == format {
+		return DecodedImage{}, DecodeImageError{Err: fmt.Errorf("error decoding image %s/%s: unsupported image format", imageInput.Bucket, imageInput.Key)}
+	}
+
+	if err := limits.check(imageInput, format); nil != err {
+		return DecodedImage{}, err
+	}
+
+	img, decodeErr := decode(imageInput.Image, format)
+	if nil != decodeErr {
+		return DecodedImage{}, DecodeImageError{Err: fmt.Errorf("error decoding %s image %s/%s: %s", format, imageInput.Bucket, imageInput.Key, decodeErr.Error())}
+	}
+
+	decoded := DecodedImage{
+		Image:    img,
+		Format:   format,
+		Exif:     rawExif(imageInput.Image),
+		ICC:      readICCProfile(imageInput.Image),
+		Bucket:   imageInput.Bucket,
+		Key:      imageInput.Key,
+		Metadata: imageInput.Metadata,
+	}
+
+	return decoded, nil
+}
+
+func (d DecodedImage) Encode(encoder Encoder) (Image, error) {
+	buffer := new(bytes.Buffer)
+	encodeErr := encoder.Encode(buffer, d.Image)
+
+	if nil != encodeErr {
+		return Image{}, EncodeImageError{Err: fmt.Errorf("error encoding image: %s/%s: %s", d.Bucket, d.Key, encodeErr.Error())}
+	}
+
+	output := buffer.Bytes()
+	if nil != d.OutputICC {
+		output = insertICC(output, encoder.Format(), d.OutputICC)
+	}
+	if nil != d.OutputExif && FormatJPEG == encoder.Format() {
+		output = insertExif(output, d.OutputExif)
+	}
+
+	encoded := Image{
+		Image:       output,
+		Bucket:      d.Bucket,
+		Key:         d.Key,
+		ContentType: encoder.Format().ContentType(),
+	}
+
+	return encoded, nil
+}
+
+func decode(data []byte, format Format) (image.Image, error) {
+	if isRAW(format) {
+		return decodeRAW(data, format)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+
+	return img, err
+}
@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/gen2brain/webp"
+)
+
+const DefaultQuality = 75
+
+type Encoder interface {
+	Encode(writer io.Writer, img image.Image) error
+	Format() Format
+}
+
+type EncoderConfig struct {
+	Format      Format
+	Quality     int
+	Progressive bool
+}
+
+type JPEGEncoder struct {
+	quality     int
+	progressive bool
+}
+
+func (e JPEGEncoder) Encode(writer io.Writer, img image.Image) error {
+	if e.progressive {
+		return encodeProgressiveJPEG(writer, img, e.quality)
+	}
+
+	return jpeg.Encode(writer, img, &jpeg.Options{Quality: e.quality})
+}
+
+func (e JPEGEncoder) Format() Format {
+	return FormatJPEG
+}
+
+func NewJPEGEncoder(quality int, progressive bool) JPEGEncoder {
+	return JPEGEncoder{
+		quality:     quality,
+		progressive: progressive,
+	}
+}
+
+type PNGEncoder struct{}
+
+func (e PNGEncoder) Encode(writer io.Writer, img image.Image) error {
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+
+	return encoder.Encode(writer, img)
+}
+
+func (e PNGEncoder) Format() Format {
+	return FormatPNG
+}
+
+func NewPNGEncoder() PNGEncoder {
+	return PNGEncoder{}
+}
+
+type WebPEncoder struct {
+	quality int
+}
+
+func (e WebPEncoder) Encode(writer io.Writer, img image.Image) error {
+	return webp.Encode(writer, img, webp.Options{Quality: e.quality, Method: 4})
+}
+
+func (e WebPEncoder) Format() Format {
+	return FormatWebP
+}
+
+func NewWebPEncoder(quality int) WebPEncoder {
+	return WebPEncoder{
+		quality: quality,
+	}
+}
+
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatJPEG, "jpg":
+		return FormatJPEG, nil
+	case FormatPNG:
+		return FormatPNG, nil
+	case FormatWebP:
+		return FormatWebP, nil
+	}
+
+	return FormatUnknown, EncoderConfigError{Err: fmt.Errorf("unsupported output format %s", name)}
+}
+
+func NewEncoder(config EncoderConfig) (Encoder, error) {
+	if FormatPNG != config.Format && (1 > config.Quality || 100 < config.Quality) {
+		return nil, EncoderConfigError{Err: fmt.Errorf("output quality %d must be between 1 and 100", config.Quality)}
+	}
+
+	if config.Progressive && FormatJPEG != config.Format {
+		return nil, EncoderConfigError{Err: fmt.Errorf("progressive output is only supported for jpeg, not %s", config.Format)}
+	}
+
+	switch config.Format {
+	case FormatJPEG:
+		return NewJPEGEncoder(config.Quality, config.Progressive), nil
+	case FormatPNG:
+		return NewPNGEncoder(), nil
+	case FormatWebP:
+		return NewWebPEncoder(config.Quality), nil
+	}
+
+	return nil, EncoderConfigError{Err: fmt.Errorf("unsupported output format %s", config.Format)}
+}
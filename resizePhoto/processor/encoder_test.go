@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type encoderTestSuite struct {
+	suite.Suite
+}
+
+func gradient(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+
+	return img
+}
+
+func meanDifference(a, b image.Image) float64 {
+	total := 0.0
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			total += absDiff(r1, r2) + absDiff(g1, g2) + absDiff(b1, b2)
+		}
+	}
+
+	return total / float64(3*bounds.Dx()*bounds.Dy()) / 257
+}
+
+func absDiff(a, b uint32) float64 {
+	if a > b {
+		return float64(a - b)
+	}
+
+	return float64(b - a)
+}
+
+func (s *encoderTestSuite) TestJPEGEncoder() {
+	s.T().Run("encodes baseline jpeg at the configured quality", func(t *testing.T) {
+		img := gradient(64, 48)
+
+		low, high := new(bytes.Buffer), new(bytes.Buffer)
+		assert.Nil(t, NewJPEGEncoder(10, false).Encode(low, img))
+		assert.Nil(t, NewJPEGEncoder(95, false).Encode(high, img))
+
+		assert.Less(t, low.Len(), high.Len())
+		assert.False(t, bytes.Contains(high.Bytes(), []byte{0xFF, 0xC2}))
+	})
+
+	s.T().Run("encodes progressive jpeg readable by image/jpeg", func(t *testing.T) {
+		img := gradient(67, 45)
+
+		buf := new(bytes.Buffer)
+		err := NewJPEGEncoder(90, true).Encode(buf, img)
+
+		assert.Nil(t, err)
+		assert.True(t, bytes.Contains(buf.Bytes(), []byte{0xFF, 0xC2}))
+
+		decoded, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+
+		assert.Nil(t, err)
+		assert.Equal(t, img.Bounds(), decoded.Bounds())
+		assert.Less(t, meanDifference(img, decoded), 4.0)
+	})
+
+	s.T().Run("reads nrgba and ycbcr pixels directly", func(t *testing.T) {
+		source := gradient(67, 45)
+		nrgba := image.NewNRGBA(source.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), source, image.Point{}, draw.Src)
+		baseline, _ := jpeg.Decode(bytes.NewReader(encodeWith(func(buf *bytes.Buffer) error {
+			return jpeg.Encode(buf, source, &jpeg.Options{Quality: 100})
+		})))
+
+		for _, img := range []image.Image{nrgba, baseline} {
+			buf := new(bytes.Buffer)
+			assert.Nil(t, NewJPEGEncoder(90, true).Encode(buf, img))
+
+			decoded, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+
+			assert.Nil(t, err)
+			assert.Less(t, meanDifference(source, decoded), 4.0)
+		}
+	})
+}
+
+func (s *encoderTestSuite) TestForwardDCT() {
+	s.T().Run("matches the two dimensional DCT definition", func(t *testing.T) {
+		var block [64]float64
+		for k := range block {
+			block[k] = float64((k*37)%255) - 128
+		}
+
+		actual := forwardDCT(&block)
+
+		for v := 0; v < 8; v++ {
+			for u := 0; u < 8; u++ {
+				sum := 0.0
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						sum += block[y*8+x] * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16) * math.Cos(float64(2*y+1)*float64(v)*math.Pi/16)
+					}
+				}
+				cu, cv := 1.0, 1.0
+				if 0 == u {
+					cu = math.Sqrt2 / 2
+				}
+				if 0 == v {
+					cv = math.Sqrt2 / 2
+				}
+
+				assert.InDelta(t, sum*cu*cv/4, actual[v*8+u], 1e-6)
+			}
+		}
+	})
+}
+
+func (s *encoderTestSuite) TestPNGEncoder() {
+	s.T().Run("encodes lossless png", func(t *testing.T) {
+		img := gradient(32, 32)
+
+		buf := new(bytes.Buffer)
+		err := NewPNGEncoder().Encode(buf, img)
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatPNG, DetectFormat(buf.Bytes()))
+
+		decoded, _, _ := image.Decode(bytes.NewReader(buf.Bytes()))
+		assert.Equal(t, 0.0, meanDifference(img, decoded))
+	})
+}
+
+func (s *encoderTestSuite) TestWebPEncoder() {
+	s.T().Run("encodes lossy webp", func(t *testing.T) {
+		img := gradient(32, 32)
+
+		buf := new(bytes.Buffer)
+		err := NewWebPEncoder(80).Encode(buf, img)
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatWebP, DetectFormat(buf.Bytes()))
+
+		decoded, _, err := image.Decode(bytes.NewReader(buf.Bytes()))
+
+		assert.Nil(t, err)
+		assert.Less(t, meanDifference(img, decoded), 8.0)
+	})
+}
+
+func (s *encoderTestSuite) TestNewEncoder() {
+	s.T().Run("builds the encoder for the configured format", func(t *testing.T) {
+		for _, format := range []Format{FormatJPEG, FormatPNG, FormatWebP} {
+			encoder, err := NewEncoder(EncoderConfig{Format: format, Quality: DefaultQuality})
+
+			assert.Nil(t, err)
+			assert.Equal(t, format, encoder.Format())
+		}
+	})
+
+	s.T().Run("returns EncoderConfigError for invalid settings", func(t *testing.T) {
+		configs := []EncoderConfig{
+			{Format: FormatJPEG, Quality: 0},
+			{Format: FormatWebP, Quality: 101},
+			{Format: FormatPNG, Progressive: true},
+			{Format: FormatGIF, Quality: DefaultQuality},
+		}
+
+		for _, config := range configs {
+			_, err := NewEncoder(config)
+
+			assert.True(t, errors.Is(err, EncoderConfigError{}))
+		}
+	})
+}
+
+func (s *encoderTestSuite) TestParseFormat() {
+	s.T().Run("parses supported output formats", func(t *testing.T) {
+		format, err := ParseFormat("jpg")
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatJPEG, format)
+
+		_, err = ParseFormat("heic")
+
+		assert.True(t, errors.Is(err, EncoderConfigError{}))
+	})
+}
+
+func BenchmarkProgressiveJPEG(b *testing.B) {
+	img := gradient(1920, 1080)
+	encoder := NewJPEGEncoder(DefaultQuality, true)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = encoder.Encode(io.Discard, img)
+	}
+}
+
+func BenchmarkBaselineJPEG(b *testing.B) {
+	img := gradient(1920, 1080)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = jpeg.Encode(io.Discard, img, &jpeg.Options{Quality: DefaultQuality})
+	}
+}
+
+func TestEncoderTestSuite(t *testing.T) {
+	suite.Run(t, new(encoderTestSuite))
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+const (
+	levelsClip     = 0.005
+	maxChannelGain = 2.0
+	minChannelGain = 0.5
+)
+
+// Enhancement strengths run from 0, which leaves a photo alone, to 1. Keys
+// starting with any of SkipPrefixes are never enhanced.
+type Enhancement struct {
+	Levels       float64
+	WhiteBalance float64
+	Contrast     float64
+	Saturation   float64
+	SkipPrefixes []string
+}
+
+func (e Enhancement) Validate() error {
+	strengths := []struct {
+		name  string
+		value float64
+	}{
+		{"levels", e.Levels},
+		{"white balance", e.WhiteBalance},
+		{"contrast", e.Contrast},
+		{"saturation", e.Saturation},
+	}
+
+	for _, strength := range strengths {
+		if !(0 <= strength.value && 1 >= strength.value) {
+			return ResizerConfigError{Err: fmt.Errorf("%s strength %g must be between 0 and 1", strength.name, strength.value)}
+		}
+	}
+
+	return nil
+}
+
+func DefaultEnhancement() Enhancement {
+	return Enhancement{
+		Levels:       1,
+		WhiteBalance: 0.8,
+		Contrast:     0.1,
+		Saturation:   0.1,
+	}
+}
+
+type EnhanceStage struct {
+	enhancement Enhancement
+}
+
+func (s EnhanceStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	for _, prefix := range s.enhancement.SkipPrefixes {
+		if strings.HasPrefix(decoded.Key, prefix) {
+			return decoded, nil
+		}
+	}
+
+	decoded.Image = s.enhance(decoded.Image)
+
+	return decoded, nil
+}
+
+func (s EnhanceStage) enhance(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	enhanced := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(enhanced, enhanced.Bounds(), img, bounds.Min, draw.Src)
+
+	var histograms [3][256]int
+	for i := 0; i < len(enhanced.Pix); i += 4 {
+		for channel := 0; channel < 3; channel++ {
+			histograms[channel][enhanced.Pix[i+channel]]++
+		}
+	}
+
+	curves := s.curves(histograms, len(enhanced.Pix)/4)
+	saturation := 1 + s.enhancement.Saturation
+	for i := 0; i < len(enhanced.Pix); i += 4 {
+		r := curves[0][enhanced.Pix[i]]
+		g := curves[1][enhanced.Pix[i+1]]
+		b := curves[2][enhanced.Pix[i+2]]
+		luma := 0.299*r + 0.587*g + 0.114*b
+
+		enhanced.Pix[i] = clampChannel(luma + (r-luma)*saturation)
+		enhanced.Pix[i+1] = clampChannel(luma + (g-luma)*saturation)
+		enhanced.Pix[i+2] = clampChannel(luma + (b-luma)*saturation)
+	}
+
+	return enhanced
+}
+
+// curves folds auto-levels, grey-world white balance and contrast into one
+// lookup table per channel, worked out from the source histograms.
+func (s EnhanceStage) curves(histograms [3][256]int, pixels int) [3][256]float64 {
+	low, high := 255, 0
+	for _, histogram := range histograms {
+		channelLow, channelHigh := clippedRange(histogram, pixels)
+		low, high = minInt(low, channelLow), maxInt(high, channelHigh)
+	}
+
+	var levels [256]float64
+	for value := range levels {
+		stretched := float64(value)
+		if low < high {
+			stretched = float64(value-low) * 255 / float64(high-low)
+		}
+		levels[value] = float64(value) + s.enhancement.Levels*(stretched-float64(value))
+	}
+
+	var means [3]float64
+	for channel, histogram := range histograms {
+		for value, count := range histogram {
+			means[channel] += levels[value] * float64(count)
+		}
+		means[channel] /= math.Max(1, float64(pixels))
+	}
+	grey := (means[0] + means[1] + means[2]) / 3
+
+	var curves [3][256]float64
+	contrast := 1 + s.enhancement.Contrast
+	for channel := range curves {
+		gain := 1.0
+		if 0 < means[channel] {
+			gain = math.Min(maxChannelGain, math.Max(minChannelGain, grey/means[channel]))
+		}
+		gain = 1 + s.enhancement.WhiteBalance*(gain-1)
+
+		for value := range curves[channel] {
+			curves[channel][value] = 127.5 + (levels[value]*gain-127.5)*contrast
+		}
+	}
+
+	return curves
+}
+
+func clippedRange(histogram [256]int, pixels int) (int, int) {
+	clip := int(float64(pixels) * levelsClip)
+
+	low, count := 0, 0
+	for ; low < 255; low++ {
+		if count += histogram[low]; count > clip {
+			break
+		}
+	}
+
+	high, count := 255, 0
+	for ; high > 0; high-- {
+		if count += histogram[high]; count > clip {
+			break
+		}
+	}
+
+	return low, high
+}
+
+func clampChannel(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(value))))
+}
+
+func NewEnhanceStage(enhancement Enhancement) EnhanceStage {
+	return EnhanceStage{
+		enhancement: enhancement,
+	}
+}
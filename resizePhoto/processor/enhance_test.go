@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type enhanceTestSuite struct {
+	suite.Suite
+}
+
+func faded(width, height int, low, high uint8, cast color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := int(low) + (int(high)-int(low))*x/(width-1)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(math.Min(255, float64(value+int(cast.R)))),
+				G: uint8(math.Min(255, float64(value+int(cast.G)))),
+				B: uint8(math.Min(255, float64(value+int(cast.B)))),
+				A: 255,
+			})
+		}
+	}
+
+	return img
+}
+
+func channelMeans(img image.Image) [3]float64 {
+	var means [3]float64
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			means[0] += float64(pixel.R)
+			means[1] += float64(pixel.G)
+			means[2] += float64(pixel.B)
+		}
+	}
+
+	for channel := range means {
+		means[channel] /= float64(bounds.Dx() * bounds.Dy())
+	}
+
+	return means
+}
+
+func (s *enhanceTestSuite) TestApply() {
+	s.T().Run("stretches faded photos to the full tonal range", func(t *testing.T) {
+		stage := NewEnhanceStage(Enhancement{Levels: 1})
+
+		decoded, err := stage.Apply(DecodedImage{Image: faded(64, 4, 80, 170, color.NRGBA{})})
+		enhanced := decoded.Image.(*image.NRGBA)
+
+		assert.Nil(t, err)
+		assert.Equal(t, uint8(0), enhanced.NRGBAAt(0, 0).R)
+		assert.Equal(t, uint8(255), enhanced.NRGBAAt(63, 0).R)
+	})
+
+	s.T().Run("removes colour casts with grey-world white balance", func(t *testing.T) {
+		stage := NewEnhanceStage(Enhancement{WhiteBalance: 1})
+
+		decoded, _ := stage.Apply(DecodedImage{Image: faded(64, 4, 60, 180, color.NRGBA{R: 40})})
+		means := channelMeans(decoded.Image)
+
+		assert.InDelta(t, means[1], means[0], 1)
+		assert.InDelta(t, means[1], means[2], 1)
+	})
+
+	s.T().Run("boosts contrast and saturation", func(t *testing.T) {
+		stage := NewEnhanceStage(Enhancement{Contrast: 0.2, Saturation: 0.5})
+
+		decoded, _ := stage.Apply(DecodedImage{Image: solid(2, 2, color.NRGBA{R: 200, G: 100, B: 100, A: 255})})
+		pixel := decoded.Image.(*image.NRGBA).NRGBAAt(0, 0)
+
+		assert.Greater(t, pixel.R, uint8(200))
+		assert.Less(t, pixel.G, uint8(100))
+	})
+
+	s.T().Run("leaves photos alone at zero strength", func(t *testing.T) {
+		img := faded(16, 2, 80, 170, color.NRGBA{B: 30})
+
+		decoded, _ := NewEnhanceStage(Enhancement{}).Apply(DecodedImage{Image: img})
+
+		assert.Equal(t, img.Pix, decoded.Image.(*image.NRGBA).Pix)
+	})
+
+	s.T().Run("skips keys with an opted out prefix", func(t *testing.T) {
+		img := faded(16, 2, 80, 170, color.NRGBA{})
+		enhancement := DefaultEnhancement()
+		enhancement.SkipPrefixes = []string{"stylised/"}
+
+		decoded, err := NewEnhanceStage(enhancement).Apply(DecodedImage{Image: img, Key: "stylised/sepia.jpg"})
+
+		assert.Nil(t, err)
+		assert.Same(t, img, decoded.Image)
+	})
+}
+
+func (s *enhanceTestSuite) TestValidate() {
+	s.T().Run("accepts the default strengths", func(t *testing.T) {
+		assert.Nil(t, DefaultEnhancement().Validate())
+	})
+
+	s.T().Run("returns ResizerConfigError for strengths outside 0 to 1", func(t *testing.T) {
+		err := Enhancement{Contrast: 1.5}.Validate()
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+		assert.Equal(t, "contrast strength 1.5 must be between 0 and 1", err.Error())
+	})
+}
+
+func TestEnhanceTestSuite(t *testing.T) {
+	suite.Run(t, new(enhanceTestSuite))
+}
@@ -39,3 +39,147 @@ func (err EncodeImageError) Is(target error) bool {
 	}
 	return ok
 }
+
+type MetadataPolicyError struct {
+	Err error
+}
+
+func (err MetadataPolicyError) Unwrap() error {
+	return err.Err
+}
+
+func (err MetadataPolicyError) Error() string {
+	return err.Err.Error()
+}
+
+func (err MetadataPolicyError) Is(target error) bool {
+	_, ok := target.(MetadataPolicyError)
+	if !ok {
+		_, ok = target.(*MetadataPolicyError)
+	}
+	return ok
+}
+
+type EncoderConfigError struct {
+	Err error
+}
+
+func (err EncoderConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err EncoderConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err EncoderConfigError) Is(target error) bool {
+	_, ok := target.(EncoderConfigError)
+	if !ok {
+		_, ok = target.(*EncoderConfigError)
+	}
+	return ok
+}
+
+type ResizerConfigError struct {
+	Err error
+}
+
+func (err ResizerConfigError) Unwrap() error {
+	return err.Err
+}
+
+func (err ResizerConfigError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ResizerConfigError) Is(target error) bool {
+	_, ok := target.(ResizerConfigError)
+	if !ok {
+		_, ok = target.(*ResizerConfigError)
+	}
+	return ok
+}
+
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (err StageError) Unwrap() error {
+	return err.Err
+}
+
+func (err StageError) Error() string {
+	return "error in " + err.Stage + " stage: " + err.Err.Error()
+}
+
+func (err StageError) Is(target error) bool {
+	_, ok := target.(StageError)
+	if !ok {
+		_, ok = target.(*StageError)
+	}
+	return ok
+}
+
+type ImageTooLargeError struct {
+	Err error
+}
+
+func (err ImageTooLargeError) Unwrap() error {
+	return err.Err
+}
+
+func (err ImageTooLargeError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ImageTooLargeError) Is(target error) bool {
+	_, ok := target.(ImageTooLargeError)
+	if !ok {
+		_, ok = target.(*ImageTooLargeError)
+	}
+	return ok
+}
+
+// RejectedImageError is returned for photos that fail the quality gate, along
+// with the scores that failed it.
+type RejectedImageError struct {
+	Err    error
+	Scores QualityScores
+}
+
+func (err RejectedImageError) Unwrap() error {
+	return err.Err
+}
+
+func (err RejectedImageError) Error() string {
+	return err.Err.Error()
+}
+
+func (err RejectedImageError) Is(target error) bool {
+	_, ok := target.(RejectedImageError)
+	if !ok {
+		_, ok = target.(*RejectedImageError)
+	}
+	return ok
+}
+
+type OverlayError struct {
+	Err error
+}
+
+func (err OverlayError) Unwrap() error {
+	return err.Err
+}
+
+func (err OverlayError) Error() string {
+	return err.Err.Error()
+}
+
+func (err OverlayError) Is(target error) bool {
+	_, ok := target.(OverlayError)
+	if !ok {
+		_, ok = target.(*OverlayError)
+	}
+	return ok
+}
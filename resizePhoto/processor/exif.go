@@ -0,0 +1,410 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+const (
+	tagOrientation uint16 = 0x0112
+	tagExifIFD     uint16 = 0x8769
+
+	typeASCII uint16 = 2
+	typeShort uint16 = 3
+	typeLong  uint16 = 4
+)
+
+// maxSegment is the largest payload a jpeg segment length field can describe.
+const maxSegment = 0xFFFF - 2
+
+var exifHeader = []byte("Exif\x00\x00")
+
+type exifEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	value    []byte
+}
+
+type exif struct {
+	byteOrder binary.ByteOrder
+	ifd0      []exifEntry
+	exifIFD   []exifEntry
+}
+
+func (e exif) orientation() int {
+	for _, entry := range e.ifd0 {
+		if tagOrientation == entry.tag && typeShort == entry.dataType && 2 <= len(entry.value) {
+			return int(e.byteOrder.Uint16(entry.value))
+		}
+	}
+
+	return 1
+}
+
+func exifFromJPEG(data []byte) []byte {
+	if 2 > len(data) || 0xFF != data[0] || 0xD8 != data[1] {
+		return nil
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if 0xFF != data[offset] {
+			return nil
+		}
+
+		marker := data[offset+1]
+		if 0xDA == marker || 0xD9 == marker {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		end := offset + 2 + length
+		if 2 > length || end > len(data) {
+			return nil
+		}
+
+		segment := data[offset+4 : end]
+		if 0xE1 == marker && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+
+		offset = end
+	}
+
+	return nil
+}
+
+func readMetadata(data []byte) exif {
+	return parseMetadata(rawExif(data))
+}
+
+func rawExif(data []byte) []byte {
+	switch format := DetectFormat(data); {
+	case FormatJPEG == format:
+		return exifFromJPEG(data)
+	case FormatHEIF == format:
+		return exifFromHEIF(data)
+	case FormatTIFF == format, isRAW(format):
+		return data
+	}
+
+	return nil
+}
+
+func parseMetadata(tiff []byte) exif {
+	if nil == tiff {
+		return exif{}
+	}
+
+	metadata, err := parseExif(tiff)
+	if nil != err {
+		return exif{}
+	}
+
+	return metadata
+}
+
+func (e exif) ascii(tag uint16) (string, bool) {
+	for _, entries := range [][]exifEntry{e.ifd0, e.exifIFD} {
+		for _, entry := range entries {
+			if tag == entry.tag && typeASCII == entry.dataType {
+				return string(bytes.TrimRight(entry.value, "\x00")), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// insertExif places the Exif APP1 segment after any JFIF APP0 segment, which
+// readers expect to come first. Exif too large for one segment is dropped.
+func insertExif(data []byte, tiff []byte) []byte {
+	segment := append(append([]byte{}, exifHeader...), tiff...)
+	if maxSegment < len(segment) {
+		return data
+	}
+
+	offset := jpegSegmentsEnd(data, 0xE0)
+
+	output := make([]byte, 0, len(data)+len(segment)+4)
+	output = append(output, data[:offset]...)
+	output = append(output, 0xFF, 0xE1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	output = append(output, segment...)
+
+	return append(output, data[offset:]...)
+}
+
+// jpegSegmentsEnd returns the offset just past SOI and any run of the given
+// marker segments that follows it.
+func jpegSegmentsEnd(data []byte, markers ...byte) int {
+	offset := 2
+	for offset+4 <= len(data) && 0xFF == data[offset] && 0 <= bytes.IndexByte(markers, data[offset+1]) {
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) {
+			break
+		}
+		offset = end
+	}
+
+	return offset
+}
+
+func writeExif(ifd0, exifIFD map[uint16]string) []byte {
+	if 0 == len(ifd0) && 0 == len(exifIFD) {
+		return nil
+	}
+
+	ifd0Tags := sortedTags(ifd0)
+	exifTags := sortedTags(exifIFD)
+
+	ifd0Count := len(ifd0Tags)
+	if 0 < len(exifTags) {
+		ifd0Count++
+	}
+
+	ifd0Size := 2 + ifd0Count*12 + 4
+	exifIFDOffset := 8 + ifd0Size + valuesSize(ifd0)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("II")
+	_ = binary.Write(buf, binary.LittleEndian, uint16(42))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(8))
+
+	var ifd0Entries []exifEntry
+	for _, tag := range ifd0Tags {
+		ifd0Entries = append(ifd0Entries, asciiEntry(tag, ifd0[tag]))
+	}
+	if 0 < len(exifTags) {
+		pointer := make([]byte, 4)
+		binary.LittleEndian.PutUint32(pointer, uint32(exifIFDOffset))
+		ifd0Entries = append(ifd0Entries, exifEntry{tag: tagExifIFD, dataType: typeLong, count: 1, value: pointer})
+	}
+	writeIFD(buf, ifd0Entries)
+
+	if 0 < len(exifTags) {
+		var exifEntries []exifEntry
+		for _, tag := range exifTags {
+			exifEntries = append(exifEntries, asciiEntry(tag, exifIFD[tag]))
+		}
+		writeIFD(buf, exifEntries)
+	}
+
+	return buf.Bytes()
+}
+
+func writeIFD(buf *bytes.Buffer, entries []exifEntry) {
+	offset := uint32(buf.Len() + 2 + len(entries)*12 + 4)
+
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+
+	var values []byte
+	for _, entry := range entries {
+		_ = binary.Write(buf, binary.LittleEndian, entry.tag)
+		_ = binary.Write(buf, binary.LittleEndian, entry.dataType)
+		_ = binary.Write(buf, binary.LittleEndian, entry.count)
+
+		if 4 >= len(entry.value) {
+			inline := make([]byte, 4)
+			copy(inline, entry.value)
+			buf.Write(inline)
+			continue
+		}
+
+		_ = binary.Write(buf, binary.LittleEndian, offset+uint32(len(values)))
+		values = append(values, entry.value...)
+		if 1 == len(values)%2 {
+			values = append(values, 0)
+		}
+	}
+
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(values)
+}
+
+func asciiEntry(tag uint16, value string) exifEntry {
+	data := append([]byte(value), 0)
+
+	return exifEntry{tag: tag, dataType: typeASCII, count: uint32(len(data)), value: data}
+}
+
+func valuesSize(values map[uint16]string) int {
+	size := 0
+	for _, value := range values {
+		length := len(value) + 1
+		if 4 < length {
+			size += length + length%2
+		}
+	}
+
+	return size
+}
+
+func sortedTags(values map[uint16]string) []uint16 {
+	var tags []uint16
+	for tag := range values {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	return tags
+}
+
+func parseExif(tiff []byte) (exif, error) {
+	byteOrder, err := tiffByteOrder(tiff)
+	if nil != err {
+		return exif{}, err
+	}
+
+	ifd0, err := readIFD(tiff, byteOrder, byteOrder.Uint32(tiff[4:]))
+	if nil != err {
+		return exif{}, err
+	}
+
+	metadata := exif{byteOrder: byteOrder, ifd0: ifd0}
+
+	for _, entry := range ifd0 {
+		if tagExifIFD == entry.tag && typeLong == entry.dataType && 4 == len(entry.value) {
+			exifIFD, exifErr := readIFD(tiff, byteOrder, byteOrder.Uint32(entry.value))
+			if nil == exifErr {
+				metadata.exifIFD = exifIFD
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+func tiffByteOrder(tiff []byte) (binary.ByteOrder, error) {
+	if 8 > len(tiff) {
+		return nil, errors.New("exif data too short")
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return nil, errors.New("invalid exif byte order")
+	}
+
+	if 42 != byteOrder.Uint16(tiff[2:]) {
+		return nil, errors.New("invalid exif header")
+	}
+
+	return byteOrder, nil
+}
+
+func readIFD(tiff []byte, byteOrder binary.ByteOrder, offset uint32) ([]exifEntry, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, errors.New("exif ifd offset out of range")
+	}
+
+	count := int(byteOrder.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(tiff) {
+		return nil, errors.New("exif ifd truncated")
+	}
+
+	var entries []exifEntry
+	for i := 0; i < count; i++ {
+		raw := tiff[start+i*12 : start+(i+1)*12]
+		entry := exifEntry{
+			tag:      byteOrder.Uint16(raw),
+			dataType: byteOrder.Uint16(raw[2:]),
+			count:    byteOrder.Uint32(raw[4:]),
+		}
+
+		size := uint64(typeSize(entry.dataType)) * uint64(entry.count)
+		if 0 == size {
+			continue
+		}
+
+		if 4 >= size {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := uint64(byteOrder.Uint32(raw[8:]))
+			if valueOffset+size > uint64(len(tiff)) {
+				continue
+			}
+			entry.value = tiff[valueOffset : valueOffset+size]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func nextIFDOffset(tiff []byte, byteOrder binary.ByteOrder, offset uint32) uint32 {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+
+	next := uint64(offset) + 2 + uint64(byteOrder.Uint16(tiff[offset:]))*12
+	if next+4 > uint64(len(tiff)) {
+		return 0
+	}
+
+	return byteOrder.Uint32(tiff[next:])
+}
+
+func (e exifEntry) uints(byteOrder binary.ByteOrder) []uint32 {
+	var values []uint32
+	for i := uint32(0); i < e.count; i++ {
+		switch e.dataType {
+		case 1, 7:
+			values = append(values, uint32(e.value[i]))
+		case typeShort:
+			values = append(values, uint32(byteOrder.Uint16(e.value[i*2:])))
+		case typeLong, 13:
+			values = append(values, byteOrder.Uint32(e.value[i*4:]))
+		}
+	}
+
+	return values
+}
+
+func (e exifEntry) floats(byteOrder binary.ByteOrder) []float64 {
+	if 5 != e.dataType && 10 != e.dataType {
+		var values []float64
+		for _, value := range e.uints(byteOrder) {
+			values = append(values, float64(value))
+		}
+		return values
+	}
+
+	var values []float64
+	for i := uint32(0); i < e.count; i++ {
+		numerator := byteOrder.Uint32(e.value[i*8:])
+		denominator := byteOrder.Uint32(e.value[i*8+4:])
+		if 0 == denominator {
+			values = append(values, 0)
+		} else if 10 == e.dataType {
+			values = append(values, float64(int32(numerator))/float64(int32(denominator)))
+		} else {
+			values = append(values, float64(numerator)/float64(denominator))
+		}
+	}
+
+	return values
+}
+
+func typeSize(dataType uint16) int {
+	switch dataType {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11, 13:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+
+	return 0
+}
@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type exifTestSuite struct {
+	suite.Suite
+}
+
+func (s *exifTestSuite) TestExifFromJPEG() {
+	s.T().Run("returns tiff payload from APP1 segment", func(t *testing.T) {
+		tiff := orientationExif(binary.LittleEndian, 6)
+		data := jpegWithExif(image.NewRGBA(image.Rect(0, 0, 8, 8)), tiff)
+
+		assert.Equal(t, tiff, exifFromJPEG(data))
+	})
+
+	s.T().Run("returns nil when jpeg has no exif segment", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		_ = jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+
+		assert.Nil(t, exifFromJPEG(buf.Bytes()))
+	})
+
+	s.T().Run("returns nil for non jpeg data", func(t *testing.T) {
+		assert.Nil(t, exifFromJPEG([]byte("not a jpeg")))
+	})
+}
+
+func (s *exifTestSuite) TestParseExif() {
+	s.T().Run("reads orientation from little endian exif", func(t *testing.T) {
+		metadata, err := parseExif(orientationExif(binary.LittleEndian, 8))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 8, metadata.orientation())
+	})
+
+	s.T().Run("reads orientation from big endian exif", func(t *testing.T) {
+		metadata, err := parseExif(orientationExif(binary.BigEndian, 3))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, metadata.orientation())
+	})
+
+	s.T().Run("defaults orientation to 1 when tag is missing", func(t *testing.T) {
+		metadata, err := parseExif([]byte{'I', 'I', 42, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, metadata.orientation())
+	})
+
+	s.T().Run("returns error for invalid header", func(t *testing.T) {
+		_, err := parseExif([]byte("XX*\x00\x08\x00\x00\x00"))
+
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("returns error for out of range ifd offset", func(t *testing.T) {
+		_, err := parseExif([]byte{'I', 'I', 42, 0, 0xFF, 0, 0, 0})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func (s *exifTestSuite) TestInsertExif() {
+	s.T().Run("places the exif segment after the jfif segment", func(t *testing.T) {
+		data := jpegWithJFIF(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+		tiff := orientationExif(binary.BigEndian, 6)
+
+		output := insertExif(data, tiff)
+
+		assert.Equal(t, data[:len(jfifSegment)+2], output[:len(jfifSegment)+2])
+		assert.Equal(t, []byte{0xFF, 0xE1}, output[len(jfifSegment)+2:len(jfifSegment)+4])
+		assert.Equal(t, tiff, exifFromJPEG(output))
+		_, err := jpeg.Decode(bytes.NewReader(output))
+		assert.Nil(t, err)
+	})
+
+	s.T().Run("places the exif segment after soi without jfif", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		_ = jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+
+		output := insertExif(buf.Bytes(), orientationExif(binary.BigEndian, 6))
+
+		assert.Equal(t, []byte{0xFF, 0xD8, 0xFF, 0xE1}, output[:4])
+	})
+
+	s.T().Run("drops exif too large for one segment", func(t *testing.T) {
+		data := jpegWithJFIF(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+
+		output := insertExif(data, make([]byte, maxSegment))
+
+		assert.Equal(t, data, output)
+	})
+}
+
+func orientationExif(byteOrder binary.ByteOrder, orientation uint16) []byte {
+	buf := new(bytes.Buffer)
+	if binary.LittleEndian == byteOrder {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	_ = binary.Write(buf, byteOrder, uint16(42))
+	_ = binary.Write(buf, byteOrder, uint32(8))
+	_ = binary.Write(buf, byteOrder, uint16(1))
+	_ = binary.Write(buf, byteOrder, tagOrientation)
+	_ = binary.Write(buf, byteOrder, typeShort)
+	_ = binary.Write(buf, byteOrder, uint32(1))
+	_ = binary.Write(buf, byteOrder, orientation)
+	_ = binary.Write(buf, byteOrder, uint16(0))
+	_ = binary.Write(buf, byteOrder, uint32(0))
+
+	return buf.Bytes()
+}
+
+func jpegWithExif(img image.Image, tiff []byte) []byte {
+	buf := new(bytes.Buffer)
+	_ = jpeg.Encode(buf, img, nil)
+	encoded := buf.Bytes()
+
+	segment := append(append([]byte{}, exifHeader...), tiff...)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(segment)+2))
+
+	output := append([]byte{}, encoded[:2]...)
+	output = append(output, 0xFF, 0xE1)
+	output = append(output, length...)
+	output = append(output, segment...)
+
+	return append(output, encoded[2:]...)
+}
+
+var jfifSegment = []byte{0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00}
+
+func jpegWithJFIF(img image.Image) []byte {
+	buf := new(bytes.Buffer)
+	_ = jpeg.Encode(buf, img, nil)
+	encoded := buf.Bytes()
+
+	output := append([]byte{}, encoded[:2]...)
+	output = append(output, jfifSegment...)
+
+	return append(output, encoded[2:]...)
+}
+
+func TestExifTestSuite(t *testing.T) {
+	suite.Run(t, new(exifTestSuite))
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	blurDownscale  = 8
+	blurRadius     = 4
+	blurBrightness = 0.6
+)
+
+func ParseColour(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if 6 != len(hex) && 8 != len(hex) {
+		return color.NRGBA{}, ResizerConfigError{Err: fmt.Errorf("invalid colour %s, expected #RRGGBB or #RRGGBBAA", value)}
+	}
+
+	parsed, err := strconv.ParseUint(hex, 16, 32)
+	if nil != err {
+		return color.NRGBA{}, ResizerConfigError{Err: fmt.Errorf("invalid colour %s, expected #RRGGBB or #RRGGBBAA", value)}
+	}
+
+	if 6 == len(hex) {
+		parsed = parsed<<8 | 0xFF
+	}
+
+	return color.NRGBA{R: uint8(parsed >> 24), G: uint8(parsed >> 16), B: uint8(parsed >> 8), A: uint8(parsed)}, nil
+}
+
+func (s ResizeStage) fit(img image.Image) image.Image {
+	interpolation := s.filter.interpolation()
+	if 0 == s.width || 0 == s.height {
+		return resize.Resize(s.width, s.height, img, interpolation)
+	}
+
+	switch s.fitMode {
+	case FitModeFill:
+		return fill(img, int(s.width), int(s.height), interpolation)
+	case FitModePad:
+		return pad(img, int(s.width), int(s.height), s.padColour, interpolation)
+	case FitModeBlur:
+		return blurredPad(img, int(s.width), int(s.height), interpolation)
+	case FitModeSmart:
+		return smartFill(img, int(s.width), int(s.height), interpolation)
+	}
+
+	return fit(img, int(s.width), int(s.height), interpolation)
+}
+
+func fit(img image.Image, width, height int, interpolation resize.InterpolationFunction) image.Image {
+	bounds := img.Bounds()
+	scale := math.Min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+
+	return resize.Resize(scaled(bounds.Dx(), scale, width), scaled(bounds.Dy(), scale, height), img, interpolation)
+}
+
+func fill(img image.Image, width, height int, interpolation resize.InterpolationFunction) *image.NRGBA {
+	covered := cover(img, width, height, interpolation)
+	coveredBounds := covered.Bounds()
+	offset := image.Pt((coveredBounds.Dx()-width)/2, (coveredBounds.Dy()-height)/2).Add(coveredBounds.Min)
+
+	return crop(covered, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))})
+}
+
+func cover(img image.Image, width, height int, interpolation resize.InterpolationFunction) image.Image {
+	bounds := img.Bounds()
+	scale := math.Max(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+
+	return resize.Resize(scaledCover(bounds.Dx(), scale, width), scaledCover(bounds.Dy(), scale, height), img, interpolation)
+}
+
+func pad(img image.Image, width, height int, colour color.Color, interpolation resize.InterpolationFunction) image.Image {
+	fitted := fit(img, width, height, interpolation)
+	fittedBounds := fitted.Bounds()
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(colour), image.Point{}, draw.Src)
+
+	offset := image.Pt((width-fittedBounds.Dx())/2, (height-fittedBounds.Dy())/2)
+	draw.Draw(canvas, fittedBounds.Sub(fittedBounds.Min).Add(offset), fitted, fittedBounds.Min, draw.Over)
+
+	return canvas
+}
+
+func crop(img image.Image, rect image.Rectangle) *image.NRGBA {
+	cropped := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+
+	return cropped
+}
+
+func scaled(size int, scale float64, limit int) uint {
+	return uint(math.Max(1, math.Min(float64(limit), math.Round(float64(size)*scale))))
+}
+
+func scaledCover(size int, scale float64, limit int) uint {
+	return uint(math.Max(float64(limit), math.Round(float64(size)*scale)))
+}
+
+func blurredPad(img image.Image, width, height int, interpolation resize.InterpolationFunction) image.Image {
+	background := fill(img, maxInt(1, width/blurDownscale), maxInt(1, height/blurDownscale), interpolation)
+	for i := 0; i < 3; i++ {
+		boxBlur(background, blurRadius)
+	}
+	darken(background, blurBrightness)
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), resize.Resize(uint(width), uint(height), background, resize.Bilinear), image.Point{}, draw.Src)
+
+	fitted := fit(img, width, height, interpolation)
+	fittedBounds := fitted.Bounds()
+	offset := image.Pt((width-fittedBounds.Dx())/2, (height-fittedBounds.Dy())/2)
+	draw.Draw(canvas, fittedBounds.Sub(fittedBounds.Min).Add(offset), fitted, fittedBounds.Min, draw.Over)
+
+	return canvas
+}
+
+func boxBlur(img *image.NRGBA, radius int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	line := make([]uint8, 4*maxInt(width, height))
+
+	blurLine := func(length int, pixel func(int) int) {
+		for i := 0; i < length; i++ {
+			copy(line[i*4:i*4+4], img.Pix[pixel(i):pixel(i)+4])
+		}
+
+		for i := 0; i < length; i++ {
+			var sums [4]int
+			for k := -radius; k <= radius; k++ {
+				index := 4 * minInt(maxInt(i+k, 0), length-1)
+				for channel := range sums {
+					sums[channel] += int(line[index+channel])
+				}
+			}
+
+			for channel, sum := range sums {
+				img.Pix[pixel(i)+channel] = uint8(sum / (2*radius + 1))
+			}
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		blurLine(width, func(x int) int { return y*img.Stride + x*4 })
+	}
+	for x := 0; x < width; x++ {
+		blurLine(height, func(y int) int { return y*img.Stride + x*4 })
+	}
+}
+
+func darken(img *image.NRGBA, brightness float64) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		for channel := 0; channel < 3; channel++ {
+			img.Pix[i+channel] = uint8(float64(img.Pix[i+channel]) * brightness)
+		}
+	}
+}
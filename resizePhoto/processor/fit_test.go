@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/nfnt/resize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type fitTestSuite struct {
+	suite.Suite
+}
+
+func solid(width, height int, colour color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colour)
+		}
+	}
+
+	return img
+}
+
+func (s *fitTestSuite) TestFit() {
+	s.T().Run("scales portrait photos to fit inside the target box", func(t *testing.T) {
+		resizer := NewResizer(800, 480)
+
+		output := resizer.resize.fit(solid(300, 400, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 360, 480), output.Bounds())
+	})
+
+	s.T().Run("scales landscape photos to fit inside the target box", func(t *testing.T) {
+		resizer := NewResizer(800, 480)
+
+		output := resizer.resize.fit(solid(1000, 400, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 800, 320), output.Bounds())
+	})
+
+	s.T().Run("keeps aspect ratio when one dimension is 0 in every mode", func(t *testing.T) {
+		for _, mode := range []FitMode{FitModeFit, FitModeFill, FitModePad, FitModeBlur} {
+			resizer := NewResizer(0, 480, WithFitMode(mode))
+
+			output := resizer.resize.fit(solid(300, 400, color.White))
+
+			assert.Equal(t, image.Rect(0, 0, 360, 480), output.Bounds(), mode)
+		}
+	})
+}
+
+func (s *fitTestSuite) TestFill() {
+	s.T().Run("centre-crops portrait photos to the exact target box", func(t *testing.T) {
+		img := solid(300, 400, color.White)
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 300; x++ {
+				img.Set(x, y, color.Black)
+				img.Set(x, 399-y, color.Black)
+			}
+		}
+
+		resizer := NewResizer(800, 480, WithFitMode(FitModeFill))
+
+		output := resizer.resize.fit(img)
+
+		assert.Equal(t, image.Rect(0, 0, 800, 480), output.Bounds())
+
+		r, g, b, _ := output.At(400, 5).RGBA()
+		assert.Equal(t, []uint32{0xFFFF, 0xFFFF, 0xFFFF}, []uint32{r, g, b})
+	})
+
+	s.T().Run("centre-crops landscape photos to the exact target box", func(t *testing.T) {
+		resizer := NewResizer(480, 800, WithFitMode(FitModeFill))
+
+		output := resizer.resize.fit(solid(1001, 397, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 480, 800), output.Bounds())
+	})
+}
+
+func (s *fitTestSuite) TestPad() {
+	s.T().Run("letterboxes photos on a canvas of the exact target box", func(t *testing.T) {
+		padColour := color.NRGBA{R: 0x20, G: 0x40, B: 0x60, A: 0xFF}
+		resizer := NewResizer(800, 480, WithFitMode(FitModePad), WithPadColour(padColour))
+
+		output := resizer.resize.fit(solid(300, 400, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 800, 480), output.Bounds())
+		assert.Equal(t, padColour, color.NRGBAModel.Convert(output.At(0, 240)))
+		assert.Equal(t, padColour, color.NRGBAModel.Convert(output.At(799, 240)))
+		assert.Equal(t, padColour, color.NRGBAModel.Convert(output.At(219, 240)))
+		assert.Equal(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, color.NRGBAModel.Convert(output.At(220, 240)))
+		assert.Equal(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, color.NRGBAModel.Convert(output.At(579, 240)))
+		assert.Equal(t, padColour, color.NRGBAModel.Convert(output.At(580, 240)))
+	})
+
+	s.T().Run("pads with black by default", func(t *testing.T) {
+		resizer := NewResizer(400, 400, WithFitMode(FitModePad))
+
+		output := resizer.resize.fit(solid(400, 200, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 400, 400), output.Bounds())
+		assert.Equal(t, color.NRGBA{A: 0xFF}, color.NRGBAModel.Convert(output.At(200, 0)))
+	})
+}
+
+func (s *fitTestSuite) TestBlurredPad() {
+	s.T().Run("composites the sharp photo over a blurred, darkened copy on the exact target box", func(t *testing.T) {
+		img := solid(300, 400, color.NRGBA{R: 0xFF, A: 0xFF})
+		for y := 0; y < 400; y += 2 {
+			for x := 0; x < 300; x++ {
+				img.Set(x, y, color.NRGBA{B: 0xFF, A: 0xFF})
+			}
+		}
+
+		resizer := NewResizer(800, 480, WithFitMode(FitModeBlur))
+
+		output := resizer.resize.fit(img)
+
+		assert.Equal(t, image.Rect(0, 0, 800, 480), output.Bounds())
+
+		for _, x := range []int{0, 100, 700, 799} {
+			background := color.NRGBAModel.Convert(output.At(x, 240)).(color.NRGBA)
+
+			assert.InDelta(t, 0xFF*blurBrightness/2, float64(background.R), 12, x)
+			assert.InDelta(t, 0xFF*blurBrightness/2, float64(background.B), 12, x)
+			assert.Equal(t, uint8(0), background.G, x)
+			assert.Equal(t, uint8(0xFF), background.A, x)
+		}
+
+		sharp := fit(img, 800, 480, resize.Lanczos3)
+		assert.Equal(t, color.NRGBAModel.Convert(sharp.At(180, 240)), output.At(400, 240))
+	})
+
+	s.T().Run("handles target boxes smaller than the blur downscale", func(t *testing.T) {
+		resizer := NewResizer(4, 2, WithFitMode(FitModeBlur))
+
+		output := resizer.resize.fit(solid(30, 40, color.White))
+
+		assert.Equal(t, image.Rect(0, 0, 4, 2), output.Bounds())
+	})
+}
+
+func zonePlate(size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			value := uint8(127.5 + 127.5*math.Cos(math.Pi*float64(x*x+y*y)/float64(size)))
+			img.Set(x, y, color.NRGBA{R: value, G: value, B: value, A: 255})
+		}
+	}
+
+	return img
+}
+
+func (s *fitTestSuite) TestFilter() {
+	s.T().Run("matches golden downscales for each resampling filter", func(t *testing.T) {
+		for _, filter := range []Filter{FilterNearest, FilterBilinear, FilterBicubic, FilterMitchell, FilterLanczos2, FilterLanczos3} {
+			resizer := NewResizer(64, 64, WithFilter(filter))
+
+			assertGolden(t, "resample/"+string(filter)+".png", resizer.resize.fit(zonePlate(256)))
+		}
+	})
+
+	s.T().Run("changes the output with the filter", func(t *testing.T) {
+		nearest := NewResizer(64, 64, WithFilter(FilterNearest))
+		lanczos := NewResizer(64, 64, WithFilter(FilterLanczos3))
+
+		assert.Greater(t, meanDifference(nearest.resize.fit(zonePlate(256)), lanczos.resize.fit(zonePlate(256))), 5.0)
+	})
+}
+
+func (s *fitTestSuite) TestParseFilter() {
+	s.T().Run("parses filters case-insensitively", func(t *testing.T) {
+		filter, err := ParseFilter(" Mitchell ")
+
+		assert.Nil(t, err)
+		assert.Equal(t, FilterMitchell, filter)
+	})
+
+	s.T().Run("returns ResizerConfigError for unknown filters", func(t *testing.T) {
+		_, err := ParseFilter("sinc")
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+	})
+}
+
+func (s *fitTestSuite) TestParseColour() {
+	s.T().Run("parses rgb and rgba hex colours", func(t *testing.T) {
+		rgb, err := ParseColour("#102030")
+
+		assert.Nil(t, err)
+		assert.Equal(t, color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF}, rgb)
+
+		rgba, err := ParseColour("10203040")
+
+		assert.Nil(t, err)
+		assert.Equal(t, color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x40}, rgba)
+	})
+
+	s.T().Run("returns ResizerConfigError for invalid colours", func(t *testing.T) {
+		for _, value := range []string{"black", "#12345", "#GGGGGG"} {
+			_, err := ParseColour(value)
+
+			assert.True(t, errors.Is(err, ResizerConfigError{}), value)
+		}
+	})
+}
+
+func TestFitTestSuite(t *testing.T) {
+	suite.Run(t, new(fitTestSuite))
+}
@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"bytes"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "github.com/gen2brain/webp"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatJPEG    Format = "jpeg"
+	FormatPNG     Format = "png"
+	FormatGIF     Format = "gif"
+	FormatWebP    Format = "webp"
+	FormatTIFF    Format = "tiff"
+	FormatBMP     Format = "bmp"
+	FormatHEIF    Format = "heic"
+	FormatDNG     Format = "dng"
+	FormatCR2     Format = "cr2"
+	FormatNEF     Format = "nef"
+	FormatARW     Format = "arw"
+)
+
+func (f Format) String() string {
+	if FormatUnknown == f {
+		return "unknown"
+	}
+
+	return string(f)
+}
+
+// ContentType returns the media type written for an encoded format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP, FormatTIFF, FormatBMP, FormatHEIF:
+		return "image/" + string(f)
+	}
+
+	return "application/octet-stream"
+}
+
+func DetectFormat(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case 12 <= len(data) && "RIFF" == string(data[:4]) && "WEBP" == string(data[8:12]):
+		return FormatWebP
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		if raw := detectRAWFormat(data); FormatUnknown != raw {
+			return raw
+		}
+		return FormatTIFF
+	case bytes.HasPrefix(data, []byte("BM")):
+		return FormatBMP
+	case isHEIF(data):
+		return FormatHEIF
+	}
+
+	return FormatUnknown
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/gen2brain/webp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type formatsTestSuite struct {
+	suite.Suite
+}
+
+func (s *formatsTestSuite) TestDetectFormat() {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	heifData, _ := os.ReadFile("testdata/single-image.heic")
+
+	cases := map[Format][]byte{
+		FormatJPEG: encodeWith(func(buf *bytes.Buffer) error { return jpeg.Encode(buf, img, nil) }),
+		FormatPNG:  encodeWith(func(buf *bytes.Buffer) error { return png.Encode(buf, img) }),
+		FormatGIF:  encodeWith(func(buf *bytes.Buffer) error { return gif.Encode(buf, img, nil) }),
+		FormatWebP: encodeWith(func(buf *bytes.Buffer) error { return webp.Encode(buf, img) }),
+		FormatTIFF: encodeWith(func(buf *bytes.Buffer) error { return tiff.Encode(buf, img, nil) }),
+		FormatBMP:  encodeWith(func(buf *bytes.Buffer) error { return bmp.Encode(buf, img) }),
+		FormatHEIF: heifData,
+	}
+
+	for format, data := range cases {
+		s.T().Run("detects "+format.String()+" from magic bytes", func(t *testing.T) {
+			assert.Equal(t, format, DetectFormat(data))
+		})
+	}
+
+	s.T().Run("detects big endian tiff", func(t *testing.T) {
+		assert.Equal(t, FormatTIFF, DetectFormat([]byte("MM\x00*\x00\x00\x00\x08")))
+	})
+
+	s.T().Run("returns unknown for unrecognised data", func(t *testing.T) {
+		assert.Equal(t, FormatUnknown, DetectFormat([]byte("ftypisom mp4 video")))
+		assert.Equal(t, "unknown", DetectFormat(nil).String())
+	})
+}
+
+func (s *formatsTestSuite) TestContentType() {
+	s.T().Run("maps output formats to media types", func(t *testing.T) {
+		assert.Equal(t, "image/jpeg", FormatJPEG.ContentType())
+		assert.Equal(t, "image/png", FormatPNG.ContentType())
+		assert.Equal(t, "image/webp", FormatWebP.ContentType())
+		assert.Equal(t, "application/octet-stream", FormatDNG.ContentType())
+	})
+
+	s.T().Run("tags encoded images with the encoder's content type", func(t *testing.T) {
+		decoded := DecodedImage{Image: image.NewRGBA(image.Rect(0, 0, 8, 8))}
+
+		output, err := decoded.Encode(NewPNGEncoder())
+
+		assert.Nil(t, err)
+		assert.Equal(t, "image/png", output.ContentType)
+	})
+}
+
+func (s *formatsTestSuite) TestDecode() {
+	s.T().Run("uses first frame of animated gif", func(t *testing.T) {
+		red := image.NewPaletted(image.Rect(0, 0, 10, 10), []color.Color{color.RGBA{R: 255, A: 255}})
+		blue := image.NewPaletted(image.Rect(0, 0, 10, 10), []color.Color{color.RGBA{B: 255, A: 255}})
+		data := encodeWith(func(buf *bytes.Buffer) error {
+			return gif.EncodeAll(buf, &gif.GIF{Image: []*image.Paletted{red, blue}, Delay: []int{10, 10}})
+		})
+
+		img, format, err := image.Decode(bytes.NewReader(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatGIF.String(), format)
+		assert.Equal(t, color.RGBA{R: 255, A: 255}, color.RGBAModel.Convert(img.At(5, 5)))
+	})
+
+	s.T().Run("uses first frame of animated webp", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/animated.webp")
+		frames, _ := webp.DecodeAll(bytes.NewReader(data))
+
+		img, format, err := image.Decode(bytes.NewReader(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatWebP.String(), format)
+		assert.Equal(t, frames.Image[0].Bounds(), img.Bounds())
+		assert.Equal(t, frames.Image[0].At(100, 100), img.At(100, 100))
+	})
+}
+
+func encodeWith(encode func(*bytes.Buffer) error) []byte {
+	buf := new(bytes.Buffer)
+	_ = encode(buf)
+
+	return buf.Bytes()
+}
+
+func TestFormatsTestSuite(t *testing.T) {
+	suite.Run(t, new(formatsTestSuite))
+}
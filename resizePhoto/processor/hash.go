@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"image"
+	"image/draw"
+	"math/bits"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+type Hasher interface {
+	Hash(DecodedImage) uint64
+}
+
+// DifferenceHasher computes a 64 bit dHash of the upright photo, so re-encoded,
+// resized and renamed copies hash within a few bits of each other.
+type DifferenceHasher struct{}
+
+func (h DifferenceHasher) Hash(decoded DecodedImage) uint64 {
+	upright, _ := NewOrientStage().Apply(decoded)
+
+	return differenceHash(upright.Image)
+}
+
+func NewDifferenceHasher() DifferenceHasher {
+	return DifferenceHasher{}
+}
+
+func differenceHash(img image.Image) uint64 {
+	small := resize.Resize(hashWidth, hashHeight, img, resize.Bilinear)
+	grey := image.NewGray(image.Rect(0, 0, hashWidth, hashHeight))
+	draw.Draw(grey, grey.Bounds(), small, small.Bounds().Min, draw.Src)
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if grey.GrayAt(x, y).Y < grey.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
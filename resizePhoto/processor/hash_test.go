@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/nfnt/resize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type hashTestSuite struct {
+	suite.Suite
+}
+
+func decodeBytes(t *testing.T, data []byte) DecodedImage {
+	decoded, err := Decode(Image{Image: data}, DefaultLimits())
+	assert.Nil(t, err)
+
+	return decoded
+}
+
+func (s *hashTestSuite) TestHash() {
+	s.T().Run("hashes re-encoded and resized copies within a few bits", func(t *testing.T) {
+		original := groupShot(600, 400, 300, 180)
+		hasher := NewDifferenceHasher()
+
+		originalHash := hasher.Hash(decodeBytes(t, encodeWith(func(buf *bytes.Buffer) error { return png.Encode(buf, original) })))
+		copyHash := hasher.Hash(decodeBytes(t, encodeWith(func(buf *bytes.Buffer) error {
+			return jpeg.Encode(buf, resize.Resize(300, 200, original, resize.Bilinear), &jpeg.Options{Quality: 60})
+		})))
+
+		assert.LessOrEqual(t, HammingDistance(originalHash, copyHash), 4)
+	})
+
+	s.T().Run("hashes different photos far apart", func(t *testing.T) {
+		hasher := NewDifferenceHasher()
+
+		left := hasher.Hash(DecodedImage{Image: groupShot(600, 400, 120, 180)})
+		right := hasher.Hash(DecodedImage{Image: gradient(600, 400)})
+
+		assert.Greater(t, HammingDistance(left, right), 10)
+	})
+
+	s.T().Run("hashes the upright photo", func(t *testing.T) {
+		img := groupShot(300, 200, 90, 100)
+		hasher := NewDifferenceHasher()
+
+		tagged := hasher.Hash(decodeBytes(t, jpegWithExif(img, orientationExif(binary.LittleEndian, 6))))
+		rotated := hasher.Hash(decodeBytes(t, jpegWithExif(orient(img, 6), orientationExif(binary.LittleEndian, 1))))
+
+		assert.LessOrEqual(t, HammingDistance(tagged, rotated), 2)
+	})
+
+}
+
+func (s *hashTestSuite) TestHammingDistance() {
+	s.T().Run("counts differing bits", func(t *testing.T) {
+		assert.Equal(t, 0, HammingDistance(0xF0, 0xF0))
+		assert.Equal(t, 3, HammingDistance(0b1011, 0b0000))
+	})
+}
+
+func TestHashTestSuite(t *testing.T) {
+	suite.Run(t, new(hashTestSuite))
+}
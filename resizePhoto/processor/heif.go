@@ -0,0 +1,456 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+
+	"github.com/gen2brain/heic"
+)
+
+var heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+
+func init() {
+	for _, brand := range heifBrands {
+		image.RegisterFormat("heic", "????ftyp"+brand, decodeHEIF, decodeHEIFConfig)
+	}
+}
+
+func decodeHEIF(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if nil != err {
+		return nil, err
+	}
+
+	return heic.Decode(bytes.NewReader(normaliseHEIFBrand(data)))
+}
+
+func decodeHEIFConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if nil != err {
+		return image.Config{}, err
+	}
+
+	return heic.DecodeConfig(bytes.NewReader(normaliseHEIFBrand(data)))
+}
+
+// libheif only accepts an hevc major brand, so generic mif1/msf1 containers
+// that list heic as a compatible brand are relabelled before decoding.
+func normaliseHEIFBrand(data []byte) []byte {
+	if !isHEIF(data) || "heic" == string(data[8:12]) {
+		return data
+	}
+
+	size := int(binary.BigEndian.Uint32(data))
+	if size > len(data) {
+		return data
+	}
+
+	for offset := 16; offset+4 <= size; offset += 4 {
+		brand := string(data[offset : offset+4])
+		if "heic" == brand || "heix" == brand {
+			normalised := append([]byte{}, data...)
+			copy(normalised[8:12], "heic")
+			return normalised
+		}
+	}
+
+	return data
+}
+
+type heifExtent struct {
+	offset uint64
+	length uint64
+}
+
+type heifItem struct {
+	id                 uint32
+	itemType           string
+	constructionMethod uint16
+	extents            []heifExtent
+}
+
+type heifReference struct {
+	referenceType string
+	from          uint32
+	to            []uint32
+}
+
+type heifFile struct {
+	primary    uint32
+	items      map[uint32]*heifItem
+	references []heifReference
+	idat       []byte
+}
+
+type heifBox struct {
+	boxType string
+	body    []byte
+}
+
+func isHEIF(data []byte) bool {
+	if 12 > len(data) || "ftyp" != string(data[4:8]) {
+		return false
+	}
+
+	for _, brand := range heifBrands {
+		if brand == string(data[8:12]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func exifFromHEIF(data []byte) []byte {
+	file, err := parseHEIF(data)
+	if nil != err {
+		return nil
+	}
+
+	item := file.exifItem()
+	if nil == item {
+		return nil
+	}
+
+	payload := file.itemData(data, item)
+	if 4 > len(payload) {
+		return nil
+	}
+
+	start := 4 + uint64(binary.BigEndian.Uint32(payload))
+	if start >= uint64(len(payload)) {
+		return nil
+	}
+
+	return payload[start:]
+}
+
+func (f heifFile) exifItem() *heifItem {
+	var fallback *heifItem
+	for _, item := range f.items {
+		if "Exif" != item.itemType {
+			continue
+		}
+
+		for _, reference := range f.references {
+			if "cdsc" == reference.referenceType && item.id == reference.from && containsItem(reference.to, f.primary) {
+				return item
+			}
+		}
+
+		if nil == fallback || item.id < fallback.id {
+			fallback = item
+		}
+	}
+
+	return fallback
+}
+
+func (f heifFile) itemData(data []byte, item *heifItem) []byte {
+	source := data
+	if 1 == item.constructionMethod {
+		source = f.idat
+	} else if 0 != item.constructionMethod {
+		return nil
+	}
+
+	var payload []byte
+	for _, extent := range item.extents {
+		end := extent.offset + extent.length
+		if 0 == extent.length {
+			end = uint64(len(source))
+		}
+		if end > uint64(len(source)) || extent.offset > end {
+			return nil
+		}
+		payload = append(payload, source[extent.offset:end]...)
+	}
+
+	return payload
+}
+
+func parseHEIF(data []byte) (heifFile, error) {
+	if !isHEIF(data) {
+		return heifFile{}, errors.New("not a heif file")
+	}
+
+	boxes, err := readBoxes(data)
+	if nil != err {
+		return heifFile{}, err
+	}
+
+	meta := findBox(boxes, "meta")
+	if nil == meta || 4 > len(meta.body) {
+		return heifFile{}, errors.New("heif file has no meta box")
+	}
+
+	children, err := readBoxes(meta.body[4:])
+	if nil != err {
+		return heifFile{}, err
+	}
+
+	file := heifFile{items: map[uint32]*heifItem{}}
+
+	pitm := findBox(children, "pitm")
+	if nil == pitm {
+		return heifFile{}, errors.New("heif file has no primary item")
+	}
+	reader := boxReader{data: pitm.body}
+	version := reader.fullBox()
+	file.primary = reader.id(version)
+	if nil != reader.err {
+		return heifFile{}, reader.err
+	}
+
+	if iinf := findBox(children, "iinf"); nil != iinf {
+		readItemInfo(&file, iinf.body)
+	}
+
+	if iloc := findBox(children, "iloc"); nil != iloc {
+		readItemLocations(&file, iloc.body)
+	}
+
+	if iref := findBox(children, "iref"); nil != iref {
+		readItemReferences(&file, iref.body)
+	}
+
+	if idat := findBox(children, "idat"); nil != idat {
+		file.idat = idat.body
+	}
+
+	if _, ok := file.items[file.primary]; !ok {
+		return heifFile{}, errors.New("heif primary item is missing")
+	}
+
+	return file, nil
+}
+
+func readItemInfo(file *heifFile, body []byte) {
+	reader := boxReader{data: body}
+	version := reader.fullBox()
+	if 0 == version {
+		reader.uint16()
+	} else {
+		reader.uint32()
+	}
+	if nil != reader.err {
+		return
+	}
+
+	entries, err := readBoxes(reader.data[reader.offset:])
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		if "infe" != entry.boxType {
+			continue
+		}
+
+		entryReader := boxReader{data: entry.body}
+		entryVersion := entryReader.fullBox()
+		if 2 > entryVersion {
+			continue
+		}
+
+		id := entryReader.id(entryVersion - 2)
+		entryReader.uint16()
+		itemType := entryReader.fourCC()
+		if nil != entryReader.err {
+			continue
+		}
+
+		file.item(id).itemType = itemType
+	}
+}
+
+func readItemLocations(file *heifFile, body []byte) {
+	reader := boxReader{data: body}
+	version := reader.fullBox()
+
+	sizes := reader.uint8()
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = reader.uint8()
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0x0F)
+	if 0 == version {
+		indexSize = 0
+	}
+
+	var count uint32
+	if 2 > version {
+		count = uint32(reader.uint16())
+	} else {
+		count = reader.uint32()
+	}
+
+	for i := uint32(0); i < count && nil == reader.err; i++ {
+		item := file.item(reader.id(version / 2))
+		if 1 == version || 2 == version {
+			item.constructionMethod = reader.uint16() & 0x0F
+		}
+		reader.uint16()
+		baseOffset := reader.sized(baseOffsetSize)
+
+		extentCount := reader.uint16()
+		for j := uint16(0); j < extentCount && nil == reader.err; j++ {
+			reader.sized(indexSize)
+			offset := reader.sized(offsetSize)
+			length := reader.sized(lengthSize)
+			item.extents = append(item.extents, heifExtent{offset: baseOffset + offset, length: length})
+		}
+	}
+}
+
+func readItemReferences(file *heifFile, body []byte) {
+	reader := boxReader{data: body}
+	version := reader.fullBox()
+	if nil != reader.err {
+		return
+	}
+
+	references, err := readBoxes(reader.data[reader.offset:])
+	if nil != err {
+		return
+	}
+
+	for _, box := range references {
+		referenceReader := boxReader{data: box.body}
+		reference := heifReference{referenceType: box.boxType, from: referenceReader.id(version)}
+
+		count := referenceReader.uint16()
+		for i := uint16(0); i < count; i++ {
+			reference.to = append(reference.to, referenceReader.id(version))
+		}
+
+		if nil == referenceReader.err {
+			file.references = append(file.references, reference)
+		}
+	}
+}
+
+func (f *heifFile) item(id uint32) *heifItem {
+	item, ok := f.items[id]
+	if !ok {
+		item = &heifItem{id: id}
+		f.items[id] = item
+	}
+
+	return item
+}
+
+func readBoxes(data []byte) ([]heifBox, error) {
+	var boxes []heifBox
+	for offset := uint64(0); offset < uint64(len(data)); {
+		if offset+8 > uint64(len(data)) {
+			return nil, errors.New("heif box header truncated")
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		boxType := string(data[offset+4 : offset+8])
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data)) - offset
+		case 1:
+			if offset+16 > uint64(len(data)) {
+				return nil, errors.New("heif box header truncated")
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			header = 16
+		}
+
+		if size < header || offset+size > uint64(len(data)) {
+			return nil, errors.New("heif box size out of range")
+		}
+
+		boxes = append(boxes, heifBox{boxType: boxType, body: data[offset+header : offset+size]})
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+func findBox(boxes []heifBox, boxType string) *heifBox {
+	for i := range boxes {
+		if boxType == boxes[i].boxType {
+			return &boxes[i]
+		}
+	}
+
+	return nil
+}
+
+func containsItem(ids []uint32, id uint32) bool {
+	for _, candidate := range ids {
+		if id == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+type boxReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *boxReader) next(size int) []byte {
+	if nil != r.err {
+		return make([]byte, size)
+	}
+
+	if r.offset+size > len(r.data) {
+		r.err = errors.New("heif box truncated")
+		return make([]byte, size)
+	}
+
+	value := r.data[r.offset : r.offset+size]
+	r.offset += size
+
+	return value
+}
+
+func (r *boxReader) uint8() uint8 {
+	return r.next(1)[0]
+}
+
+func (r *boxReader) uint16() uint16 {
+	return binary.BigEndian.Uint16(r.next(2))
+}
+
+func (r *boxReader) uint32() uint32 {
+	return binary.BigEndian.Uint32(r.next(4))
+}
+
+func (r *boxReader) fourCC() string {
+	return string(r.next(4))
+}
+
+func (r *boxReader) fullBox() uint8 {
+	return uint8(r.uint32() >> 24)
+}
+
+func (r *boxReader) id(version uint8) uint32 {
+	if 0 == version {
+		return uint32(r.uint16())
+	}
+
+	return r.uint32()
+}
+
+func (r *boxReader) sized(size int) uint64 {
+	switch size {
+	case 4:
+		return uint64(r.uint32())
+	case 8:
+		return binary.BigEndian.Uint64(r.next(8))
+	}
+
+	return 0
+}
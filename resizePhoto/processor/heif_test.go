@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type heifTestSuite struct {
+	suite.Suite
+}
+
+func (s *heifTestSuite) TestParseHEIF() {
+	s.T().Run("finds primary item in multi-image container", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/multi-image.heic")
+
+		file, err := parseHEIF(data)
+
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(10), file.primary)
+		assert.Equal(t, "grid", file.items[file.primary].itemType)
+		assert.Equal(t, 11, len(file.items))
+	})
+
+	s.T().Run("finds primary item in single image container", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/single-image.heic")
+
+		file, err := parseHEIF(data)
+
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(1), file.primary)
+		assert.Equal(t, "hvc1", file.items[file.primary].itemType)
+	})
+
+	s.T().Run("returns error for non heif data", func(t *testing.T) {
+		_, err := parseHEIF([]byte("not a heif file"))
+
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("returns error for truncated container", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/single-image.heic")
+
+		_, err := parseHEIF(data[:64])
+
+		assert.NotNil(t, err)
+	})
+}
+
+func (s *heifTestSuite) TestExifFromHEIF() {
+	s.T().Run("extracts exif linked to the primary item", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/multi-image.heic")
+
+		metadata, err := parseExif(exifFromHEIF(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, metadata.orientation())
+	})
+}
+
+func (s *heifTestSuite) TestDecode() {
+	s.T().Run("decodes the primary image of a multi-image container", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/multi-image.heic")
+
+		img, format, err := image.Decode(bytes.NewReader(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "heic", format)
+		assert.Equal(t, image.Rect(0, 0, 1346, 1346), img.Bounds())
+	})
+
+	s.T().Run("decodes heif files with a mif1 major brand", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/single-image.heic")
+		copy(data[8:12], "mif1")
+
+		img, format, err := image.Decode(bytes.NewReader(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "heic", format)
+		assert.Equal(t, image.Rect(0, 0, 512, 512), img.Bounds())
+	})
+}
+
+func TestHeifTestSuite(t *testing.T) {
+	suite.Run(t, new(heifTestSuite))
+}
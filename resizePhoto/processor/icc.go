@@ -0,0 +1,267 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+const (
+	tagICCProfile uint16 = 0x8773
+	maxICCProfile        = 4 << 20
+	iccJPEGHeader        = "ICC_PROFILE\x00"
+	iccJPEGChunk         = 0xFFFF - 2 - len(iccJPEGHeader) - 2
+)
+
+func readICCProfile(data []byte) []byte {
+	switch format := DetectFormat(data); {
+	case FormatJPEG == format:
+		return iccFromJPEG(data)
+	case FormatPNG == format:
+		return iccFromPNG(data)
+	case FormatWebP == format:
+		return iccFromWebP(data)
+	case FormatHEIF == format:
+		return iccFromHEIF(data)
+	case FormatTIFF == format, isRAW(format):
+		metadata := parseMetadata(data)
+		for _, entry := range metadata.ifd0 {
+			if tagICCProfile == entry.tag {
+				return entry.value
+			}
+		}
+	}
+
+	return nil
+}
+
+func iccFromJPEG(data []byte) []byte {
+	type chunk struct {
+		sequence int
+		payload  []byte
+	}
+	var chunks []chunk
+
+	offset := 2
+	for offset+4 <= len(data) && 0xFF == data[offset] && 0xDA != data[offset+1] && 0xD9 != data[offset+1] {
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) {
+			break
+		}
+
+		segment := data[offset+4 : end]
+		if 0xE2 == data[offset+1] && bytes.HasPrefix(segment, []byte(iccJPEGHeader)) && len(iccJPEGHeader)+2 <= len(segment) {
+			chunks = append(chunks, chunk{sequence: int(segment[len(iccJPEGHeader)]), payload: segment[len(iccJPEGHeader)+2:]})
+		}
+
+		offset = end
+	}
+
+	if 0 == len(chunks) {
+		return nil
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].sequence < chunks[j].sequence
+	})
+
+	var profile []byte
+	for _, chunk := range chunks {
+		profile = append(profile, chunk.payload...)
+	}
+
+	return profile
+}
+
+func iccFromPNG(data []byte) []byte {
+	for offset := 8; offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		if offset+12+length > len(data) || 0 > length {
+			return nil
+		}
+
+		if "iCCP" == chunkType {
+			body := data[offset+8 : offset+8+length]
+			separator := bytes.IndexByte(body, 0)
+			if 0 > separator || separator+2 > len(body) || 0 != body[separator+1] {
+				return nil
+			}
+
+			reader, err := zlib.NewReader(bytes.NewReader(body[separator+2:]))
+			if nil != err {
+				return nil
+			}
+			defer reader.Close()
+
+			profile, err := io.ReadAll(io.LimitReader(reader, maxICCProfile))
+			if nil != err {
+				return nil
+			}
+
+			return profile
+		}
+
+		if "IDAT" == chunkType || "IEND" == chunkType {
+			return nil
+		}
+
+		offset += 12 + length
+	}
+
+	return nil
+}
+
+func iccFromWebP(data []byte) []byte {
+	for offset := 12; offset+8 <= len(data); {
+		chunkType := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if offset+8+length > len(data) || 0 > length {
+			return nil
+		}
+
+		if "ICCP" == chunkType {
+			return data[offset+8 : offset+8+length]
+		}
+
+		offset += 8 + length + length%2
+	}
+
+	return nil
+}
+
+func iccFromHEIF(data []byte) []byte {
+	boxes, err := readBoxes(data)
+	if nil != err {
+		return nil
+	}
+
+	meta := findBox(boxes, "meta")
+	if nil == meta || 4 > len(meta.body) {
+		return nil
+	}
+
+	children, err := readBoxes(meta.body[4:])
+	if nil != err {
+		return nil
+	}
+
+	iprp := findBox(children, "iprp")
+	if nil == iprp {
+		return nil
+	}
+
+	properties, err := readBoxes(iprp.body)
+	if nil != err {
+		return nil
+	}
+
+	ipco := findBox(properties, "ipco")
+	if nil == ipco {
+		return nil
+	}
+
+	items, err := readBoxes(ipco.body)
+	if nil != err {
+		return nil
+	}
+
+	for _, item := range items {
+		if "colr" == item.boxType && 4 <= len(item.body) {
+			colourType := string(item.body[:4])
+			if "prof" == colourType || "rICC" == colourType {
+				return item.body[4:]
+			}
+		}
+	}
+
+	return nil
+}
+
+// insertICC embeds a profile in jpeg and png output. WebP without a
+// profile is sRGB by definition, so it is left as it is.
+func insertICC(data []byte, format Format, profile []byte) []byte {
+	switch format {
+	case FormatJPEG:
+		return insertJPEGICC(data, profile)
+	case FormatPNG:
+		return insertPNGICC(data, profile)
+	}
+
+	return data
+}
+
+// insertJPEGICC places the APP2 chunks after any JFIF APP0 and Exif APP1
+// segments. Chunks are numbered in a single byte, so a profile needing more
+// than 255 of them is left out.
+func insertJPEGICC(data []byte, profile []byte) []byte {
+	count := (len(profile) + iccJPEGChunk - 1) / iccJPEGChunk
+	if 255 < count {
+		return data
+	}
+
+	offset := jpegSegmentsEnd(data, 0xE0, 0xE1)
+
+	output := make([]byte, 0, len(data)+len(profile)+count*(4+len(iccJPEGHeader)+2))
+	output = append(output, data[:offset]...)
+	for i := 0; i < count; i++ {
+		chunk := profile[i*iccJPEGChunk : minInt((i+1)*iccJPEGChunk, len(profile))]
+		length := 2 + len(iccJPEGHeader) + 2 + len(chunk)
+
+		output = append(output, 0xFF, 0xE2, byte(length>>8), byte(length))
+		output = append(output, iccJPEGHeader...)
+		output = append(output, byte(i+1), byte(count))
+		output = append(output, chunk...)
+	}
+
+	return append(output, data[offset:]...)
+}
+
+func insertPNGICC(data []byte, profile []byte) []byte {
+	compressed := new(bytes.Buffer)
+	writer := zlib.NewWriter(compressed)
+	_, _ = writer.Write(profile)
+	_ = writer.Close()
+
+	chunk := make([]byte, 8, 12+len("ICC\x00\x00")+compressed.Len())
+	binary.BigEndian.PutUint32(chunk, uint32(len("ICC\x00\x00")+compressed.Len()))
+	copy(chunk[4:], "iCCP")
+	chunk = append(chunk, "ICC\x00\x00"...)
+	chunk = append(chunk, compressed.Bytes()...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// iCCP has to come before IDAT, so it goes straight after IHDR.
+	end := pngChunkEnd(data, "IHDR")
+	if 0 > end {
+		return data
+	}
+
+	output := make([]byte, 0, len(data)+len(chunk))
+	output = append(output, data[:end]...)
+	output = append(output, chunk...)
+
+	return append(output, data[end:]...)
+}
+
+// pngChunkEnd returns the offset just past the named chunk, or -1 when the
+// chunk list does not hold it.
+func pngChunkEnd(data []byte, chunkType string) int {
+	for offset := 8; offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 12 + length
+		if 0 > length || end > len(data) {
+			return -1
+		}
+
+		if chunkType == string(data[offset+4:offset+8]) {
+			return end
+		}
+
+		offset = end
+	}
+
+	return -1
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type iccTestSuite struct {
+	suite.Suite
+}
+
+var testProfile = bytes.Repeat([]byte("profile-"), 16)
+
+func jpegWithICC(chunks ...[]byte) []byte {
+	encoded := testJPEG(8, 8)
+	output := append([]byte{}, encoded[:2]...)
+	for i, chunk := range chunks {
+		segment := append([]byte(iccJPEGHeader), byte(i+1), byte(len(chunks)))
+		segment = append(segment, chunk...)
+		output = append(output, 0xFF, 0xE2, byte((len(segment)+2)>>8), byte(len(segment)+2))
+		output = append(output, segment...)
+	}
+
+	return append(output, encoded[2:]...)
+}
+
+func pngWithICC(profile []byte) []byte {
+	encoded := encodeWith(func(buf *bytes.Buffer) error {
+		return png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	})
+
+	compressed := new(bytes.Buffer)
+	writer := zlib.NewWriter(compressed)
+	_, _ = writer.Write(profile)
+	_ = writer.Close()
+
+	body := append([]byte("icc\x00\x00"), compressed.Bytes()...)
+	chunk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)))
+	copy(chunk[4:], "iCCP")
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// iCCP must precede IDAT, so it goes straight after IHDR.
+	end := pngChunkEnd(encoded, "IHDR")
+	output := append([]byte{}, encoded[:end]...)
+	output = append(output, chunk...)
+
+	return append(output, encoded[end:]...)
+}
+
+func box(boxType string, body []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(body)))
+	copy(header[4:], boxType)
+
+	return append(header, body...)
+}
+
+func (s *iccTestSuite) TestReadICCProfile() {
+	s.T().Run("joins jpeg app2 chunks", func(t *testing.T) {
+		profile := readICCProfile(jpegWithICC(testProfile[:50], testProfile[50:]))
+
+		assert.Equal(t, testProfile, profile)
+	})
+
+	s.T().Run("inflates png iccp chunk", func(t *testing.T) {
+		data := pngWithICC(testProfile)
+
+		_, err := png.Decode(bytes.NewReader(data))
+
+		assert.Nil(t, err)
+		assert.Equal(t, testProfile, readICCProfile(data))
+	})
+
+	s.T().Run("reads webp iccp chunk", func(t *testing.T) {
+		chunks := []byte("ICCP")
+		chunks = binary.LittleEndian.AppendUint32(chunks, uint32(len(testProfile)))
+		chunks = append(chunks, testProfile...)
+		data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunks...)
+
+		assert.Equal(t, testProfile, readICCProfile(data))
+	})
+
+	s.T().Run("reads heif colr property", func(t *testing.T) {
+		ipco := box("ipco", box("colr", append([]byte("prof"), testProfile...)))
+		meta := box("meta", append([]byte{0, 0, 0, 0}, box("iprp", ipco)...))
+		data := append(box("ftyp", []byte("heic\x00\x00\x00\x00")), meta...)
+
+		assert.Equal(t, testProfile, readICCProfile(data))
+	})
+
+	s.T().Run("returns nil without a profile", func(t *testing.T) {
+		assert.Nil(t, readICCProfile(testJPEG(8, 8)))
+	})
+}
+
+func (s *iccTestSuite) TestInsertJPEGICC() {
+	s.T().Run("places app2 chunks after the jfif and exif segments", func(t *testing.T) {
+		data := insertExif(jpegWithJFIF(image.NewRGBA(image.Rect(0, 0, 8, 8))), orientationExif(binary.BigEndian, 6))
+		headers := jpegSegmentsEnd(data, 0xE0, 0xE1)
+
+		output := insertJPEGICC(data, testProfile)
+
+		assert.Equal(t, data[:headers], output[:headers])
+		assert.Equal(t, []byte{0xFF, 0xE2}, output[headers:headers+2])
+		assert.Equal(t, testProfile, readICCProfile(output))
+		_, err := jpeg.Decode(bytes.NewReader(output))
+		assert.Nil(t, err)
+	})
+
+	s.T().Run("leaves out profiles needing more than 255 chunks", func(t *testing.T) {
+		data := jpegWithJFIF(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+
+		output := insertJPEGICC(data, make([]byte, 255*iccJPEGChunk+1))
+
+		assert.Equal(t, data, output)
+	})
+}
+
+func TestICCTestSuite(t *testing.T) {
+	suite.Run(t, new(iccTestSuite))
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+const (
+	DefaultMaxPixels = 50_000_000
+	DefaultMaxBytes  = 100 << 20
+)
+
+// Limits are checked against the file size and header dimensions before an
+// image is decoded. A zero limit is not enforced.
+type Limits struct {
+	MaxPixels int
+	MaxBytes  int
+}
+
+func (l Limits) check(imageInput Image, format Format) error {
+	if 0 < l.MaxBytes && len(imageInput.Image) > l.MaxBytes {
+		return ImageTooLargeError{Err: fmt.Errorf("image %s/%s is %d bytes, limit is %d", imageInput.Bucket, imageInput.Key, len(imageInput.Image), l.MaxBytes)}
+	}
+
+	if 0 >= l.MaxPixels {
+		return nil
+	}
+
+	config, err := decodeConfig(imageInput.Image, format)
+	if nil != err {
+		return DecodeImageError{Err: fmt.Errorf("error reading %s image header %s/%s: %s", format, imageInput.Bucket, imageInput.Key, err.Error())}
+	}
+
+	if pixels := int64(config.Width) * int64(config.Height); pixels > int64(l.MaxPixels) {
+		return ImageTooLargeError{Err: fmt.Errorf("image %s/%s is %dx%d pixels, limit is %d", imageInput.Bucket, imageInput.Key, config.Width, config.Height, l.MaxPixels)}
+	}
+
+	return nil
+}
+
+func decodeConfig(data []byte, format Format) (image.Config, error) {
+	if isRAW(format) {
+		return decodeRAWConfig(data)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	return config, err
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPixels: DefaultMaxPixels,
+		MaxBytes:  DefaultMaxBytes,
+	}
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type limitsTestSuite struct {
+	suite.Suite
+}
+
+// pngHeader returns a PNG signature and IHDR claiming the given size, with no
+// pixel data behind it.
+func pngHeader(width, height uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func (s *limitsTestSuite) TestCheck() {
+	s.T().Run("rejects images over the pixel limit from the header alone", func(t *testing.T) {
+		err := DefaultLimits().check(Image{Image: pngHeader(20000, 20000), Bucket: "bucket", Key: "bomb.png"}, FormatPNG)
+
+		assert.True(t, errors.Is(err, ImageTooLargeError{}))
+		assert.Equal(t, "image bucket/bomb.png is 20000x20000 pixels, limit is 50000000", err.Error())
+	})
+
+	s.T().Run("rejects files over the byte limit", func(t *testing.T) {
+		limits := Limits{MaxBytes: 1024}
+
+		err := limits.check(Image{Image: bytes.Repeat([]byte{0}, 1025), Bucket: "bucket", Key: "key"}, FormatJPEG)
+
+		assert.True(t, errors.Is(err, ImageTooLargeError{}))
+		assert.Equal(t, "image bucket/key is 1025 bytes, limit is 1024", err.Error())
+	})
+
+	s.T().Run("accepts images within limits", func(t *testing.T) {
+		err := Limits{MaxPixels: 64, MaxBytes: 1 << 20}.check(Image{Image: testJPEG(8, 8)}, FormatJPEG)
+
+		assert.Nil(t, err)
+	})
+
+	s.T().Run("does not enforce zero limits", func(t *testing.T) {
+		err := Limits{}.check(Image{Image: pngHeader(20000, 20000)}, FormatPNG)
+
+		assert.Nil(t, err)
+	})
+
+	s.T().Run("checks raw files against their decoded size", func(t *testing.T) {
+		data := buildTIFF(nil, [][]byte{rggbSamples(8, 8, 60000, 0, 0)}, []testIFD{
+			{entries: dngEntries(8, 8)},
+		})
+
+		err := Limits{MaxPixels: 63}.check(Image{Image: data}, FormatDNG)
+
+		assert.True(t, errors.Is(err, ImageTooLargeError{}))
+	})
+}
+
+func (s *limitsTestSuite) TestPipeline() {
+	s.T().Run("rejects oversized images before decoding", func(t *testing.T) {
+		resizer := NewResizer(50, 50)
+
+		_, err := resizer.Run(Image{Image: pngHeader(20000, 20000), Bucket: "bucket", Key: "bomb.png"})
+
+		assert.True(t, errors.Is(err, ImageTooLargeError{}))
+		assert.False(t, errors.Is(err, DecodeImageError{}))
+	})
+}
+
+func TestLimitsTestSuite(t *testing.T) {
+	suite.Run(t, new(limitsTestSuite))
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ExifTag uint16
+
+const (
+	TagImageDescription  ExifTag = 0x010E
+	TagMake              ExifTag = 0x010F
+	TagModel             ExifTag = 0x0110
+	TagDateTime          ExifTag = 0x0132
+	TagArtist            ExifTag = 0x013B
+	TagCopyright         ExifTag = 0x8298
+	TagDateTimeOriginal  ExifTag = 0x9003
+	TagDateTimeDigitized ExifTag = 0x9004
+	TagOffsetTime        ExifTag = 0x9010
+	TagOffsetTimeOrig    ExifTag = 0x9011
+)
+
+type tagInfo struct {
+	name    string
+	exifIFD bool
+}
+
+// Only these tags can ever be written to a display rendition. GPS, serial
+// numbers, owner names and maker notes are deliberately absent.
+var safeTags = map[ExifTag]tagInfo{
+	TagImageDescription:  {name: "ImageDescription"},
+	TagMake:              {name: "Make"},
+	TagModel:             {name: "Model"},
+	TagDateTime:          {name: "DateTime"},
+	TagArtist:            {name: "Artist"},
+	TagCopyright:         {name: "Copyright"},
+	TagDateTimeOriginal:  {name: "DateTimeOriginal", exifIFD: true},
+	TagDateTimeDigitized: {name: "DateTimeDigitized", exifIFD: true},
+	TagOffsetTime:        {name: "OffsetTime", exifIFD: true},
+	TagOffsetTimeOrig:    {name: "OffsetTimeOriginal", exifIFD: true},
+}
+
+type MetadataPolicy struct {
+	allow   []ExifTag
+	rewrite map[ExifTag]string
+}
+
+func (p MetadataPolicy) apply(metadata exif) []byte {
+	ifd0 := map[uint16]string{}
+	exifIFD := map[uint16]string{}
+
+	set := func(tag ExifTag, value string) {
+		if safeTags[tag].exifIFD {
+			exifIFD[uint16(tag)] = value
+		} else {
+			ifd0[uint16(tag)] = value
+		}
+	}
+
+	for _, tag := range p.allow {
+		if value, ok := metadata.ascii(uint16(tag)); ok {
+			set(tag, value)
+		}
+	}
+
+	for tag, value := range p.rewrite {
+		set(tag, value)
+	}
+
+	return writeExif(ifd0, exifIFD)
+}
+
+func ParseExifTag(name string) (ExifTag, error) {
+	for tag, info := range safeTags {
+		if strings.EqualFold(info.name, strings.TrimSpace(name)) {
+			return tag, nil
+		}
+	}
+
+	return 0, MetadataPolicyError{Err: fmt.Errorf("exif tag %s cannot be kept in display images", name)}
+}
+
+func StripAllMetadata() MetadataPolicy {
+	return MetadataPolicy{}
+}
+
+func NewMetadataPolicy(allow []ExifTag, rewrite map[ExifTag]string) (MetadataPolicy, error) {
+	for _, tag := range allow {
+		if _, ok := safeTags[tag]; !ok {
+			return MetadataPolicy{}, MetadataPolicyError{Err: fmt.Errorf("exif tag 0x%04X cannot be kept in display images", uint16(tag))}
+		}
+	}
+
+	policy := MetadataPolicy{
+		allow:   append([]ExifTag{}, allow...),
+		rewrite: map[ExifTag]string{},
+	}
+
+	var rewriteTags []ExifTag
+	for tag := range rewrite {
+		rewriteTags = append(rewriteTags, tag)
+	}
+	sort.Slice(rewriteTags, func(i, j int) bool { return rewriteTags[i] < rewriteTags[j] })
+
+	for _, tag := range rewriteTags {
+		if _, ok := safeTags[tag]; !ok {
+			return MetadataPolicy{}, MetadataPolicyError{Err: fmt.Errorf("exif tag 0x%04X cannot be rewritten in display images", uint16(tag))}
+		}
+		policy.rewrite[tag] = rewrite[tag]
+	}
+
+	if maxSegment < len(exifHeader)+len(policy.apply(exif{})) {
+		return MetadataPolicy{}, MetadataPolicyError{Err: fmt.Errorf("exif rewrites must fit in %d bytes", maxSegment)}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	tagGPSIFD           uint16 = 0x8825
+	tagBodySerialNumber uint16 = 0xA431
+)
+
+type metadataTestSuite struct {
+	suite.Suite
+}
+
+func (s *metadataTestSuite) TestApply() {
+	source, _ := parseExif(privateExif())
+
+	s.T().Run("strips all metadata by default", func(t *testing.T) {
+		assert.Nil(t, StripAllMetadata().apply(source))
+	})
+
+	s.T().Run("keeps only allow-listed tags", func(t *testing.T) {
+		policy, err := NewMetadataPolicy([]ExifTag{TagModel, TagDateTimeOriginal}, nil)
+		assert.Nil(t, err)
+
+		output, err := parseExif(policy.apply(source))
+		assert.Nil(t, err)
+
+		model, _ := output.ascii(uint16(TagModel))
+		date, _ := output.ascii(uint16(TagDateTimeOriginal))
+		_, hasMake := output.ascii(uint16(TagMake))
+		_, hasSerial := output.ascii(tagBodySerialNumber)
+
+		assert.Equal(t, "EOS 5D", model)
+		assert.Equal(t, "2021:06:01 10:00:00", date)
+		assert.False(t, hasMake)
+		assert.False(t, hasSerial)
+		assert.False(t, hasGPSIFD(output))
+		assert.Equal(t, 1, output.orientation())
+	})
+
+	s.T().Run("rewrites fields", func(t *testing.T) {
+		policy, err := NewMetadataPolicy([]ExifTag{TagMake}, map[ExifTag]string{
+			TagMake:   "Camera",
+			TagArtist: "King Family",
+		})
+		assert.Nil(t, err)
+
+		output, err := parseExif(policy.apply(source))
+		assert.Nil(t, err)
+
+		cameraMake, _ := output.ascii(uint16(TagMake))
+		artist, _ := output.ascii(uint16(TagArtist))
+
+		assert.Equal(t, "Camera", cameraMake)
+		assert.Equal(t, "King Family", artist)
+	})
+
+	s.T().Run("skips allow-listed tags missing from the source", func(t *testing.T) {
+		policy, _ := NewMetadataPolicy([]ExifTag{TagCopyright}, nil)
+
+		assert.Nil(t, policy.apply(source))
+	})
+}
+
+func (s *metadataTestSuite) TestNewMetadataPolicy() {
+	s.T().Run("rejects unsafe tags in allow list", func(t *testing.T) {
+		_, err := NewMetadataPolicy([]ExifTag{ExifTag(tagGPSIFD)}, nil)
+
+		assert.True(t, errors.Is(err, MetadataPolicyError{}))
+		assert.Equal(t, "exif tag 0x8825 cannot be kept in display images", err.Error())
+	})
+
+	s.T().Run("rejects unsafe tags in rewrite", func(t *testing.T) {
+		_, err := NewMetadataPolicy(nil, map[ExifTag]string{ExifTag(tagBodySerialNumber): "0"})
+
+		assert.True(t, errors.Is(err, MetadataPolicyError{}))
+		assert.Equal(t, "exif tag 0xA431 cannot be rewritten in display images", err.Error())
+	})
+
+	s.T().Run("rejects rewrites too large for one exif segment", func(t *testing.T) {
+		_, err := NewMetadataPolicy(nil, map[ExifTag]string{TagImageDescription: strings.Repeat("x", maxSegment)})
+
+		assert.True(t, errors.Is(err, MetadataPolicyError{}))
+		assert.Equal(t, "exif rewrites must fit in 65533 bytes", err.Error())
+	})
+}
+
+func (s *metadataTestSuite) TestParseExifTag() {
+	s.T().Run("parses tag names case insensitively", func(t *testing.T) {
+		tag, err := ParseExifTag(" datetimeoriginal ")
+
+		assert.Nil(t, err)
+		assert.Equal(t, TagDateTimeOriginal, tag)
+	})
+
+	s.T().Run("returns error for unknown or unsafe tags", func(t *testing.T) {
+		_, err := ParseExifTag("GPSLatitude")
+
+		assert.True(t, errors.Is(err, MetadataPolicyError{}))
+		assert.Equal(t, "exif tag GPSLatitude cannot be kept in display images", err.Error())
+	})
+}
+
+func hasGPSIFD(metadata exif) bool {
+	for _, entry := range metadata.ifd0 {
+		if tagGPSIFD == entry.tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func privateExif() []byte {
+	pointer := func(tag uint16) exifEntry {
+		return exifEntry{tag: tag, dataType: typeLong, count: 1, value: make([]byte, 4)}
+	}
+	orientation := exifEntry{tag: tagOrientation, dataType: typeShort, count: 1, value: []byte{6, 0}}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("II")
+	_ = binary.Write(buf, binary.LittleEndian, uint16(42))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(8))
+
+	writeIFD(buf, []exifEntry{
+		asciiEntry(uint16(TagMake), "Canon"),
+		asciiEntry(uint16(TagModel), "EOS 5D"),
+		orientation,
+		pointer(tagExifIFD),
+		pointer(tagGPSIFD),
+	})
+
+	exifIFDOffset := buf.Len()
+	writeIFD(buf, []exifEntry{
+		asciiEntry(uint16(TagDateTimeOriginal), "2021:06:01 10:00:00"),
+		asciiEntry(tagBodySerialNumber, "123456789"),
+	})
+
+	gpsIFDOffset := buf.Len()
+	writeIFD(buf, []exifEntry{
+		asciiEntry(0x0001, "N"),
+	})
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[8+2+3*12+8:], uint32(exifIFDOffset))
+	binary.LittleEndian.PutUint32(data[8+2+4*12+8:], uint32(gpsIFDOffset))
+
+	return data
+}
+
+func TestMetadataTestSuite(t *testing.T) {
+	suite.Run(t, new(metadataTestSuite))
+}
@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"image"
+	"image/draw"
+)
+
+func orient(img image.Image, orientation int) image.Image {
+	if 2 > orientation || 8 < orientation {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if 5 <= orientation {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := orientedPoint(orientation, x, y, width, height)
+			srcOffset := src.PixOffset(x, y)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+4], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+
+	return dst
+}
+
+func orientedPoint(orientation, x, y, width, height int) (int, int) {
+	switch orientation {
+	case 2:
+		return width - 1 - x, y
+	case 3:
+		return width - 1 - x, height - 1 - y
+	case 4:
+		return x, height - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return height - 1 - y, x
+	case 7:
+		return height - 1 - y, width - 1 - x
+	case 8:
+		return y, width - 1 - x
+	}
+
+	return x, y
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type orientationTestSuite struct {
+	suite.Suite
+}
+
+func (s *orientationTestSuite) TestOrient() {
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	// 3x2 source with red top-left, green top-right and blue bottom-left
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+	src.Set(2, 0, green)
+	src.Set(0, 1, blue)
+
+	cases := []struct {
+		orientation int
+		width       int
+		height      int
+		red         image.Point
+		green       image.Point
+		blue        image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0), image.Pt(2, 0), image.Pt(0, 1)},
+		{2, 3, 2, image.Pt(2, 0), image.Pt(0, 0), image.Pt(2, 1)},
+		{3, 3, 2, image.Pt(2, 1), image.Pt(0, 1), image.Pt(2, 0)},
+		{4, 3, 2, image.Pt(0, 1), image.Pt(2, 1), image.Pt(0, 0)},
+		{5, 2, 3, image.Pt(0, 0), image.Pt(0, 2), image.Pt(1, 0)},
+		{6, 2, 3, image.Pt(1, 0), image.Pt(1, 2), image.Pt(0, 0)},
+		{7, 2, 3, image.Pt(1, 2), image.Pt(1, 0), image.Pt(0, 2)},
+		{8, 2, 3, image.Pt(0, 2), image.Pt(0, 0), image.Pt(1, 2)},
+	}
+
+	for _, c := range cases {
+		s.T().Run(fmt.Sprintf("applies orientation %d", c.orientation), func(t *testing.T) {
+			output := orient(src, c.orientation)
+
+			assert.Equal(t, c.width, output.Bounds().Dx())
+			assert.Equal(t, c.height, output.Bounds().Dy())
+			assert.Equal(t, red, color.RGBAModel.Convert(output.At(c.red.X, c.red.Y)))
+			assert.Equal(t, green, color.RGBAModel.Convert(output.At(c.green.X, c.green.Y)))
+			assert.Equal(t, blue, color.RGBAModel.Convert(output.At(c.blue.X, c.blue.Y)))
+		})
+	}
+
+	s.T().Run("ignores invalid orientation values", func(t *testing.T) {
+		assert.Equal(t, image.Image(src), orient(src, 9))
+		assert.Equal(t, image.Image(src), orient(src, 0))
+	})
+}
+
+func TestOrientationTestSuite(t *testing.T) {
+	suite.Run(t, new(orientationTestSuite))
+}
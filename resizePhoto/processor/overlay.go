@@ -0,0 +1,259 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	exifDateLayout    = "2006:01:02 15:04:05"
+	overlayDateLayout = "2 January 2006"
+	overlaySeparator  = " · "
+	minOverlayPixels  = 8
+)
+
+var overlayFonts = map[string]*overlayFont{
+	"regular": {ttf: goregular.TTF},
+	"bold":    {ttf: gobold.TTF},
+	"mono":    {ttf: gomono.TTF},
+}
+
+// overlayFont parses its font the first time it is drawn with and shares
+// the result between every image and stage after that.
+type overlayFont struct {
+	ttf    []byte
+	once   sync.Once
+	parsed *opentype.Font
+	err    error
+}
+
+func (f *overlayFont) parse() (*opentype.Font, error) {
+	f.once.Do(func() {
+		f.parsed, f.err = opentype.Parse(f.ttf)
+	})
+
+	return f.parsed, f.err
+}
+
+type OverlayField string
+
+const (
+	OverlayDate    OverlayField = "date"
+	OverlayCaption OverlayField = "caption"
+	OverlayAlbum   OverlayField = "album"
+)
+
+func ParseOverlayField(name string) (OverlayField, error) {
+	switch field := OverlayField(strings.ToLower(strings.TrimSpace(name))); field {
+	case OverlayDate, OverlayCaption, OverlayAlbum:
+		return field, nil
+	}
+
+	return "", ResizerConfigError{Err: fmt.Errorf("unsupported overlay field %s", name)}
+}
+
+type OverlayPosition string
+
+const (
+	OverlayTopLeft     OverlayPosition = "top-left"
+	OverlayTopRight    OverlayPosition = "top-right"
+	OverlayBottomLeft  OverlayPosition = "bottom-left"
+	OverlayBottomRight OverlayPosition = "bottom-right"
+)
+
+func ParseOverlayPosition(name string) (OverlayPosition, error) {
+	switch position := OverlayPosition(strings.ToLower(strings.TrimSpace(name))); position {
+	case OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight:
+		return position, nil
+	}
+
+	return "", ResizerConfigError{Err: fmt.Errorf("unsupported overlay position %s", name)}
+}
+
+// Overlay describes the text written into a corner of the display image.
+// Fields that have no value for a photo are left out, and nothing is drawn
+// when none of them do. Size is the text height as a percentage of the
+// image height.
+type Overlay struct {
+	Fields     []OverlayField
+	Font       string
+	Size       float64
+	Position   OverlayPosition
+	Colour     color.NRGBA
+	Background color.NRGBA
+}
+
+func (o Overlay) Validate() error {
+	if _, ok := overlayFonts[o.Font]; !ok {
+		return ResizerConfigError{Err: fmt.Errorf("unsupported overlay font %s", o.Font)}
+	}
+
+	if !(0 < o.Size && 50 >= o.Size) {
+		return ResizerConfigError{Err: fmt.Errorf("overlay size %g must be above 0 and at most 50", o.Size)}
+	}
+
+	return nil
+}
+
+func DefaultOverlay() Overlay {
+	return Overlay{
+		Fields:     []OverlayField{OverlayDate},
+		Font:       "regular",
+		Size:       4,
+		Position:   OverlayBottomRight,
+		Colour:     color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		Background: color.NRGBA{A: 0x99},
+	}
+}
+
+type OverlayStage struct {
+	overlay Overlay
+}
+
+func (s OverlayStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	text := s.text(decoded)
+	if "" == text {
+		return decoded, nil
+	}
+
+	img, err := s.draw(decoded.Image, text)
+	if nil != err {
+		return DecodedImage{}, OverlayError{Err: fmt.Errorf("error drawing overlay on %s/%s: %s", decoded.Bucket, decoded.Key, err.Error())}
+	}
+	decoded.Image = img
+
+	return decoded, nil
+}
+
+func (s OverlayStage) text(decoded DecodedImage) string {
+	var parts []string
+	for _, field := range s.overlay.Fields {
+		var value string
+		switch field {
+		case OverlayDate:
+			value = captureDate(decoded.Exif)
+		case OverlayCaption:
+			value = decoded.Metadata["caption"]
+		case OverlayAlbum:
+			value = decoded.Metadata["album"]
+			if "" == value && strings.Contains(decoded.Key, "/") {
+				value = path.Base(path.Dir(decoded.Key))
+			}
+		}
+
+		if value = strings.TrimSpace(value); "" != value {
+			parts = append(parts, value)
+		}
+	}
+
+	return strings.Join(parts, overlaySeparator)
+}
+
+func captureDate(exif []byte) string {
+	metadata := parseMetadata(exif)
+	for _, tag := range []ExifTag{TagDateTimeOriginal, TagDateTime} {
+		value, ok := metadata.ascii(uint16(tag))
+		if !ok {
+			continue
+		}
+
+		captured, err := time.Parse(exifDateLayout, strings.TrimSpace(value))
+		if nil == err {
+			return captured.Format(overlayDateLayout)
+		}
+	}
+
+	return ""
+}
+
+func (s OverlayStage) draw(img image.Image, text string) (image.Image, error) {
+	typeface, ok := overlayFonts[s.overlay.Font]
+	if !ok {
+		return nil, fmt.Errorf("unsupported overlay font %s", s.overlay.Font)
+	}
+
+	parsed, err := typeface.parse()
+	if nil != err {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	size := math.Max(minOverlayPixels, float64(bounds.Dy())*s.overlay.Size/100)
+
+	face, err := overlayFace(parsed, size)
+	if nil != err {
+		return nil, err
+	}
+
+	// Long captions shrink to fit the width rather than running off the image.
+	if width := font.MeasureString(face, text).Ceil() + 4*int(math.Ceil(size/3)); width > bounds.Dx() {
+		_ = face.Close()
+		size = math.Max(minOverlayPixels, size*float64(bounds.Dx())/float64(width))
+		if face, err = overlayFace(parsed, size); nil != err {
+			return nil, err
+		}
+	}
+	defer face.Close()
+
+	padding := int(math.Ceil(size / 3))
+
+	metrics := face.Metrics()
+	box := image.Rect(0, 0, font.MeasureString(face, text).Ceil()+2*padding, (metrics.Ascent+metrics.Descent).Ceil()+2*padding)
+	box = box.Add(s.corner(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), box.Size(), padding))
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+	draw.Draw(canvas, box, image.NewUniform(s.overlay.Background), image.Point{}, draw.Over)
+
+	drawer := font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(s.overlay.Colour),
+		Face: face,
+		Dot:  fixed.P(box.Min.X+padding, box.Min.Y+padding+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+
+	return canvas, nil
+}
+
+func overlayFace(parsed *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func (s OverlayStage) corner(bounds image.Rectangle, size image.Point, margin int) image.Point {
+	left := margin
+	right := bounds.Dx() - size.X - margin
+	top := margin
+	bottom := bounds.Dy() - size.Y - margin
+
+	switch s.overlay.Position {
+	case OverlayTopLeft:
+		return image.Pt(left, top)
+	case OverlayTopRight:
+		return image.Pt(right, top)
+	case OverlayBottomLeft:
+		return image.Pt(left, bottom)
+	}
+
+	return image.Pt(right, bottom)
+}
+
+func NewOverlayStage(overlay Overlay) OverlayStage {
+	return OverlayStage{
+		overlay: overlay,
+	}
+}
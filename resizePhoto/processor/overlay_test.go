@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type overlayTestSuite struct {
+	suite.Suite
+}
+
+func (s *overlayTestSuite) TestText() {
+	s.T().Run("joins the capture date, caption and album", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayDate, OverlayCaption, OverlayAlbum}
+
+		text := NewOverlayStage(overlay).text(DecodedImage{
+			Exif:     rawExif(jpegWithExif(image.NewRGBA(image.Rect(0, 0, 8, 8)), privateExif())),
+			Key:      "holidays/cornwall-2021/beach.jpg",
+			Metadata: map[string]string{"caption": " Beach day "},
+		})
+
+		assert.Equal(t, "1 June 2021 · Beach day · cornwall-2021", text)
+	})
+
+	s.T().Run("leaves out fields without a value", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayDate, OverlayCaption, OverlayAlbum}
+
+		text := NewOverlayStage(overlay).text(DecodedImage{
+			Key:      "beach.jpg",
+			Metadata: map[string]string{"album": "Cornwall"},
+		})
+
+		assert.Equal(t, "Cornwall", text)
+	})
+}
+
+func (s *overlayTestSuite) TestApply() {
+	s.T().Run("leaves images alone when there is nothing to write", func(t *testing.T) {
+		img := solid(64, 48, color.White)
+
+		decoded, err := NewOverlayStage(DefaultOverlay()).Apply(DecodedImage{Image: img})
+
+		assert.Nil(t, err)
+		assert.Same(t, img, decoded.Image)
+	})
+
+	s.T().Run("draws text on a backing box in the configured corner", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayCaption}
+		overlay.Size = 10
+		overlay.Position = OverlayTopLeft
+
+		decoded, err := NewOverlayStage(overlay).Apply(DecodedImage{
+			Image:    solid(320, 240, color.White),
+			Metadata: map[string]string{"caption": "Beach day"},
+		})
+		output := decoded.Image.(*image.NRGBA)
+
+		assert.Nil(t, err)
+		assert.Equal(t, color.NRGBA{R: 0x66, G: 0x66, B: 0x66, A: 0xFF}, output.NRGBAAt(10, 10))
+		assert.Equal(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, output.NRGBAAt(310, 230))
+	})
+
+	s.T().Run("matches golden bottom right overlay", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayDate, OverlayCaption}
+		overlay.Size = 8
+
+		decoded, err := NewOverlayStage(overlay).Apply(DecodedImage{
+			Image:    gradient(320, 240),
+			Exif:     rawExif(jpegWithExif(image.NewRGBA(image.Rect(0, 0, 8, 8)), privateExif())),
+			Metadata: map[string]string{"caption": "Beach day"},
+		})
+
+		assert.Nil(t, err)
+		assertGolden(t, "overlay/bottom-right.png", decoded.Image)
+	})
+
+	s.T().Run("shrinks long text to fit the image width", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayCaption}
+		overlay.Size = 20
+		overlay.Position = OverlayBottomLeft
+
+		decoded, err := NewOverlayStage(overlay).Apply(DecodedImage{
+			Image:    solid(120, 240, color.White),
+			Metadata: map[string]string{"caption": "Grandma and grandad on the pier at Whitby"},
+		})
+		output := decoded.Image.(*image.NRGBA)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, output.NRGBAAt(110, 230))
+		assert.Equal(t, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, output.NRGBAAt(119, 239))
+	})
+
+	s.T().Run("parses each font once and draws from it concurrently", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayCaption}
+		stage := NewOverlayStage(overlay)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = stage.Apply(DecodedImage{
+					Image:    solid(64, 48, color.White),
+					Metadata: map[string]string{"caption": "Beach day"},
+				})
+			}(i)
+		}
+		wg.Wait()
+
+		first, err := overlayFonts["regular"].parse()
+		second, _ := overlayFonts["regular"].parse()
+
+		assert.Equal(t, make([]error, 4), errs)
+		assert.Nil(t, err)
+		assert.Same(t, first, second)
+	})
+
+	s.T().Run("returns OverlayError when the text cannot be drawn", func(t *testing.T) {
+		overlay := DefaultOverlay()
+		overlay.Fields = []OverlayField{OverlayCaption}
+		overlay.Font = "comic-sans"
+
+		_, err := NewOverlayStage(overlay).Apply(DecodedImage{
+			Image:    solid(64, 48, color.White),
+			Bucket:   "bucket",
+			Key:      "photo.jpg",
+			Metadata: map[string]string{"caption": "Beach day"},
+		})
+
+		assert.True(t, errors.Is(err, OverlayError{}))
+		assert.EqualError(t, err, "error drawing overlay on bucket/photo.jpg: unsupported overlay font comic-sans")
+	})
+}
+
+func (s *overlayTestSuite) TestValidate() {
+	s.T().Run("accepts the default overlay", func(t *testing.T) {
+		assert.Nil(t, DefaultOverlay().Validate())
+	})
+
+	s.T().Run("returns ResizerConfigError for unknown fonts and sizes", func(t *testing.T) {
+		unknownFont := DefaultOverlay()
+		unknownFont.Font = "comic-sans"
+		tooLarge := DefaultOverlay()
+		tooLarge.Size = 80
+
+		assert.True(t, errors.Is(unknownFont.Validate(), ResizerConfigError{}))
+		assert.True(t, errors.Is(tooLarge.Validate(), ResizerConfigError{}))
+	})
+
+	s.T().Run("parses positions and fields", func(t *testing.T) {
+		position, err := ParseOverlayPosition(" Top-Right ")
+
+		assert.Nil(t, err)
+		assert.Equal(t, OverlayTopRight, position)
+
+		_, err = ParseOverlayPosition("middle")
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+
+		field, err := ParseOverlayField("Caption")
+
+		assert.Nil(t, err)
+		assert.Equal(t, OverlayCaption, field)
+
+		_, err = ParseOverlayField("camera")
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+	})
+}
+
+func TestOverlayTestSuite(t *testing.T) {
+	suite.Run(t, new(overlayTestSuite))
+}
@@ -0,0 +1,62 @@
+package processor
+
+// Transform is one pipeline stage. Renditions share the decoded photo, so
+// a Transform must return new pixels rather than change the ones it is given.
+type Transform interface {
+	Apply(DecodedImage) (DecodedImage, error)
+}
+
+type Stage struct {
+	Name      string
+	Transform Transform
+}
+
+type Pipeline struct {
+	stages  []Stage
+	encoder Encoder
+	limits  Limits
+}
+
+func (p *Pipeline) Run(imageInput Image) (Image, error) {
+	decoded, err := NewDecoder(p.limits).Decode(imageInput)
+	if nil != err {
+		return Image{}, err
+	}
+
+	return p.RunDecoded(decoded)
+}
+
+// RunDecoded runs the stages on a photo that has already been decoded.
+func (p *Pipeline) RunDecoded(decoded DecodedImage) (Image, error) {
+	var err error
+	for _, stage := range p.stages {
+		decoded, err = stage.Transform.Apply(decoded)
+		if nil != err {
+			return Image{}, StageError{Stage: stage.Name, Err: err}
+		}
+	}
+
+	output, err := decoded.Encode(p.encoder)
+	if nil != err {
+		return Image{}, StageError{Stage: StageEncode, Err: err}
+	}
+
+	return output, nil
+}
+
+func (p *Pipeline) Stages() []string {
+	var names []string
+	for _, stage := range p.stages {
+		names = append(names, stage.Name)
+	}
+
+	return names
+}
+
+func NewPipeline(encoder Encoder, limits Limits, stages ...Stage) Pipeline {
+	return Pipeline{
+		stages:  stages,
+		encoder: encoder,
+		limits:  limits,
+	}
+}
@@ -0,0 +1,307 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type pipelineTestSuite struct {
+	suite.Suite
+}
+
+type recordingTransform struct {
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (t recordingTransform) Apply(decoded DecodedImage) (DecodedImage, error) {
+	*t.calls = append(*t.calls, t.name)
+
+	return decoded, t.err
+}
+
+func (s *pipelineTestSuite) TestRun() {
+	s.T().Run("decodes once, runs stages in order and encodes once", func(t *testing.T) {
+		var calls []string
+		pipeline := NewPipeline(NewPNGEncoder(), DefaultLimits(),
+			Stage{Name: "first", Transform: recordingTransform{name: "first", calls: &calls}},
+			Stage{Name: "second", Transform: recordingTransform{name: "second", calls: &calls}},
+		)
+
+		output, err := pipeline.Run(Image{Image: testJPEG(8, 8), Bucket: "bucket", Key: "key"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"first", "second"}, calls)
+		assert.Equal(t, []string{"first", "second"}, pipeline.Stages())
+		assert.Equal(t, FormatPNG, DetectFormat(output.Image))
+		assert.Equal(t, "bucket", output.Bucket)
+		assert.Equal(t, "key", output.Key)
+	})
+
+	s.T().Run("wraps stage errors with the stage name", func(t *testing.T) {
+		var calls []string
+		pipeline := NewPipeline(NewPNGEncoder(), DefaultLimits(),
+			Stage{Name: "first", Transform: recordingTransform{name: "first", calls: &calls, err: EncodeImageError{Err: errors.New("something went wrong")}}},
+			Stage{Name: "second", Transform: recordingTransform{name: "second", calls: &calls}},
+		)
+
+		_, err := pipeline.Run(Image{Image: testJPEG(8, 8)})
+
+		var stageErr StageError
+		assert.True(t, errors.As(err, &stageErr))
+		assert.Equal(t, "first", stageErr.Stage)
+		assert.True(t, errors.Is(err, EncodeImageError{}))
+		assert.Equal(t, "error in first stage: something went wrong", err.Error())
+		assert.Equal(t, []string{"first"}, calls)
+	})
+
+	s.T().Run("reports decode failures as the decode stage", func(t *testing.T) {
+		pipeline := NewPipeline(NewPNGEncoder(), DefaultLimits())
+
+		_, err := pipeline.Run(Image{Image: []byte("Thumbs.db"), Bucket: "bucket", Key: "key"})
+
+		assert.True(t, errors.Is(err, DecodeImageError{}))
+		assert.Equal(t, "error in decode stage: error decoding image bucket/key: unsupported image format", err.Error())
+	})
+}
+
+func (s *pipelineTestSuite) TestStages() {
+	s.T().Run("metadata stage keeps only allow-listed exif", func(t *testing.T) {
+		policy, _ := NewMetadataPolicy([]ExifTag{TagDateTimeOriginal}, nil)
+		decoded, _ := Decode(Image{Image: jpegWithExif(image.NewRGBA(image.Rect(0, 0, 8, 8)), privateExif())}, DefaultLimits())
+
+		output, err := NewMetadataStage(policy).Apply(decoded)
+
+		assert.Nil(t, err)
+
+		metadata, _ := parseExif(output.OutputExif)
+		date, _ := metadata.ascii(uint16(TagDateTimeOriginal))
+
+		assert.Equal(t, "2021:06:01 10:00:00", date)
+		assert.False(t, hasGPSIFD(metadata))
+	})
+
+	s.T().Run("orient stage rotates pixels using the source exif", func(t *testing.T) {
+		decoded, _ := Decode(Image{Image: jpegWithExif(image.NewRGBA(image.Rect(0, 0, 40, 20)), orientationExif(binary.LittleEndian, 6))}, DefaultLimits())
+
+		output, err := NewOrientStage().Apply(decoded)
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 20, 40), output.Image.Bounds())
+	})
+
+	s.T().Run("resize stage fits the image", func(t *testing.T) {
+		output, err := NewResizeStage(800, 480, FitModePad, color.Black, FilterLanczos3).Apply(DecodedImage{Image: image.NewRGBA(image.Rect(0, 0, 300, 400))})
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 800, 480), output.Image.Bounds())
+	})
+}
+
+func (s *pipelineTestSuite) TestDecode() {
+	s.T().Run("carries format, metadata and source key", func(t *testing.T) {
+		tiff := orientationExif(binary.LittleEndian, 6)
+
+		decoded, err := Decode(Image{Image: jpegWithExif(image.NewRGBA(image.Rect(0, 0, 40, 20)), tiff), Bucket: "bucket", Key: "key"}, DefaultLimits())
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatJPEG, decoded.Format)
+		assert.Equal(t, tiff, decoded.Exif)
+		assert.Equal(t, "bucket", decoded.Bucket)
+		assert.Equal(t, "key", decoded.Key)
+		assert.Equal(t, image.Rect(0, 0, 40, 20), decoded.Image.Bounds())
+	})
+
+	s.T().Run("carries the source icc profile", func(t *testing.T) {
+		decoded, err := Decode(Image{Image: jpegWithICC(testProfile)}, DefaultLimits())
+
+		assert.Nil(t, err)
+		assert.Equal(t, testProfile, decoded.ICC)
+	})
+
+	s.T().Run("encodes with output exif only for jpeg", func(t *testing.T) {
+		tiff := writeExif(map[uint16]string{uint16(TagModel): "Camera"}, nil)
+		decoded := DecodedImage{Image: image.NewRGBA(image.Rect(0, 0, 8, 8)), OutputExif: tiff}
+
+		jpegOutput, err := decoded.Encode(NewJPEGEncoder(90, false))
+
+		assert.Nil(t, err)
+		assert.Equal(t, tiff, exifFromJPEG(jpegOutput.Image))
+
+		pngOutput, err := decoded.Encode(NewPNGEncoder())
+
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(pngOutput.Image, []byte("Camera")))
+	})
+}
+
+func (s *pipelineTestSuite) TestDecoder() {
+	s.T().Run("returns errors from the decode stage", func(t *testing.T) {
+		_, err := NewDecoder(DefaultLimits()).Decode(Image{Image: []byte("Thumbs.db")})
+
+		var stageErr StageError
+		assert.True(t, errors.As(err, &stageErr))
+		assert.Equal(t, StageDecode, stageErr.Stage)
+		assert.True(t, errors.Is(err, DecodeImageError{}))
+	})
+}
+
+func (s *pipelineTestSuite) TestRunDecoded() {
+	s.T().Run("shares one decoded photo between renditions", func(t *testing.T) {
+		decoded, err := NewDecoder(DefaultLimits()).Decode(Image{Image: benchmarkSource(), Bucket: "bucket", Key: "key"})
+		assert.Nil(t, err)
+		source := decoded.Image.(*image.YCbCr)
+		pixels := append([]byte{}, source.Y...)
+
+		for _, size := range []uint{480, 200} {
+			resizer := NewResizer(0, size, WithStages(append(append([]string{}, DefaultStages...), StageSharpen, StageOverlay)...))
+
+			output, err := resizer.RunDecoded(decoded)
+
+			assert.Nil(t, err)
+			assert.Equal(t, "key", output.Key)
+			img, _ := jpeg.Decode(bytes.NewReader(output.Image))
+			assert.Equal(t, int(size), img.Bounds().Dy())
+		}
+		assert.Equal(t, pixels, source.Y)
+	})
+}
+
+func (s *pipelineTestSuite) TestResizerStages() {
+	s.T().Run("runs the default stages", func(t *testing.T) {
+		resizer := NewResizer(50, 50)
+
+		assert.Equal(t, DefaultStages, resizer.pipeline.Stages())
+	})
+
+	s.T().Run("runs only the selected stages", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+		resizer := NewResizer(20, 0, WithStages(StageResize))
+
+		output, err := resizer.Run(Image{Image: jpegWithExif(img, orientationExif(binary.LittleEndian, 6))})
+		resized, _, _ := image.Decode(bytes.NewReader(output.Image))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{StageResize}, resizer.pipeline.Stages())
+		assert.Equal(t, image.Rect(0, 0, 20, 10), resized.Bounds())
+	})
+}
+
+func (s *pipelineTestSuite) TestParseStage() {
+	s.T().Run("parses known stages", func(t *testing.T) {
+		stage, err := ParseStage(" Orient ")
+
+		assert.Nil(t, err)
+		assert.Equal(t, StageOrient, stage)
+
+		stage, err = ParseStage("enhance")
+
+		assert.Nil(t, err)
+		assert.Equal(t, StageEnhance, stage)
+
+		_, err = ParseStage("encode")
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+	})
+}
+
+func TestPipelineTestSuite(t *testing.T) {
+	suite.Run(t, new(pipelineTestSuite))
+}
+
+// reencodingTransform reproduces stages that exchange encoded bytes, each
+// decoding its input and encoding its output.
+type reencodingTransform struct {
+	transform Transform
+}
+
+func (t reencodingTransform) Apply(decoded DecodedImage) (DecodedImage, error) {
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, decoded.Image, &jpeg.Options{Quality: DefaultQuality}); nil != err {
+		return DecodedImage{}, err
+	}
+
+	img, err := jpeg.Decode(buf)
+	if nil != err {
+		return DecodedImage{}, err
+	}
+	decoded.Image = img
+
+	return t.transform.Apply(decoded)
+}
+
+func benchmarkSource() []byte {
+	return encodeWith(func(buf *bytes.Buffer) error {
+		return jpeg.Encode(buf, gradient(2048, 1536), &jpeg.Options{Quality: 90})
+	})
+}
+
+func BenchmarkPipelineDecodeOnce(b *testing.B) {
+	source := benchmarkSource()
+	resizer := NewResizer(800, 480, WithFitMode(FitModeFill))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = resizer.Run(Image{Image: source})
+	}
+}
+
+// benchmarkRenditions are the deployed rendition sizes.
+var benchmarkRenditions = [][2]uint{{0, 480}, {200, 200}, {0, 1080}}
+
+func BenchmarkRenditionsDecodeOnce(b *testing.B) {
+	source := benchmarkSource()
+	decoder := NewDecoder(DefaultLimits())
+	var resizers []Resizer
+	for _, size := range benchmarkRenditions {
+		resizers = append(resizers, NewResizer(size[0], size[1]))
+	}
+	hasher := NewDifferenceHasher()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoded, _ := decoder.Decode(Image{Image: source})
+		hasher.Hash(decoded)
+		for _, resizer := range resizers {
+			_, _ = resizer.RunDecoded(decoded)
+		}
+	}
+}
+
+func BenchmarkRenditionsDecodeEach(b *testing.B) {
+	source := benchmarkSource()
+	var resizers []Resizer
+	for _, size := range benchmarkRenditions {
+		resizers = append(resizers, NewResizer(size[0], size[1]))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, resizer := range resizers {
+			_, _ = resizer.Run(Image{Image: source})
+		}
+	}
+}
+
+func BenchmarkPipelineReencodingStages(b *testing.B) {
+	source := benchmarkSource()
+	var stages []Stage
+	for _, stage := range NewResizer(800, 480, WithFitMode(FitModeFill)).pipeline.stages {
+		stages = append(stages, Stage{Name: stage.Name, Transform: reencodingTransform{transform: stage.Transform}})
+	}
+	pipeline := NewPipeline(NewJPEGEncoder(DefaultQuality, false), DefaultLimits(), stages...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = pipeline.Run(Image{Image: source})
+	}
+}
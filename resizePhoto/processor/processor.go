@@ -1,11 +1,25 @@
 package processor
 
+// Image is an encoded photo. Metadata holds the user metadata of the
+// source object, keyed by lower case name.
 type Image struct {
-	Image  []byte
-	Bucket string
-	Key    string
+	Image       []byte
+	Bucket      string
+	Key         string
+	ContentType string
+	Metadata    map[string]string
 }
 
 type Processor interface {
 	Run(Image) (Image, error)
 }
+
+// Decoder decodes a photo once for the hash and every rendition to share.
+type Decoder interface {
+	Decode(Image) (DecodedImage, error)
+}
+
+// DecodedProcessor processes a photo a Decoder has already decoded.
+type DecodedProcessor interface {
+	RunDecoded(DecodedImage) (Image, error)
+}
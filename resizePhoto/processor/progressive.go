@@ -0,0 +1,477 @@
+package processor
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+var baseQuantTables = [2][64]int{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffmanTable struct {
+	counts [16]byte
+	values []byte
+}
+
+var huffmanTables = [4]huffmanTable{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+type huffmanCode struct {
+	length uint8
+	code   uint16
+}
+
+type bitWriter struct {
+	writer *bufio.Writer
+	bits   uint32
+	count  uint8
+}
+
+func (w *bitWriter) write(bits uint32, count uint8) {
+	for i := int(count) - 1; i >= 0; i-- {
+		w.bits = w.bits<<1 | (bits>>uint(i))&1
+		w.count++
+		if 8 == w.count {
+			w.flushByte()
+		}
+	}
+}
+
+func (w *bitWriter) flushByte() {
+	value := byte(w.bits)
+	_ = w.writer.WriteByte(value)
+	if 0xFF == value {
+		_ = w.writer.WriteByte(0)
+	}
+	w.bits, w.count = 0, 0
+}
+
+func (w *bitWriter) pad() {
+	for 0 != w.count {
+		w.write(1, 1)
+	}
+}
+
+// encodeProgressiveJPEG writes a spectral selection progressive JPEG without
+// chroma subsampling. image/jpeg can only write baseline files.
+func encodeProgressiveJPEG(writer io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	blocksAcross, blocksDown := (width+7)/8, (height+7)/8
+
+	quant := scaledQuantTables(quality)
+	codes := [4][]huffmanCode{}
+	for i, table := range huffmanTables {
+		codes[i] = buildHuffmanCodes(table)
+	}
+
+	var coefficients [3][][64]int32
+	for component := range coefficients {
+		coefficients[component] = make([][64]int32, blocksAcross*blocksDown)
+	}
+
+	planes := ycbcrPlanes(img)
+	var block [64]float64
+	for by := 0; by < blocksDown; by++ {
+		for bx := 0; bx < blocksAcross; bx++ {
+			for component, plane := range planes {
+				for y := 0; y < 8; y++ {
+					row := minInt(by*8+y, height-1) * width
+					for x := 0; x < 8; x++ {
+						block[y*8+x] = float64(plane[row+minInt(bx*8+x, width-1)]) - 128
+					}
+				}
+
+				table := quant[minInt(component, 1)]
+				dct := forwardDCT(&block)
+				output := &coefficients[component][by*blocksAcross+bx]
+				for k := 0; k < 64; k++ {
+					output[k] = int32(math.Round(dct[zigzag[k]] / float64(table[k])))
+				}
+			}
+		}
+	}
+
+	buffered := bufio.NewWriter(writer)
+	_, _ = buffered.Write([]byte{0xFF, 0xD8})
+	writeQuantTables(buffered, quant)
+	writeFrameHeader(buffered, width, height)
+	writeHuffmanTables(buffered)
+
+	bits := &bitWriter{writer: buffered}
+
+	writeScanHeader(buffered, []int{0, 1, 2}, 0, 0)
+	var predictors [3]int32
+	for block := 0; block < blocksAcross*blocksDown; block++ {
+		for component := 0; component < 3; component++ {
+			value := coefficients[component][block][0]
+			encodeDC(bits, codes[minInt(component, 1)*2], value-predictors[component])
+			predictors[component] = value
+		}
+	}
+	bits.pad()
+
+	for component := 0; component < 3; component++ {
+		for _, band := range [][2]int{{1, 5}, {6, 63}} {
+			writeScanHeader(buffered, []int{component}, band[0], band[1])
+			for block := 0; block < blocksAcross*blocksDown; block++ {
+				encodeAC(bits, codes[minInt(component, 1)*2+1], coefficients[component][block], band[0], band[1])
+			}
+			bits.pad()
+		}
+	}
+
+	_, _ = buffered.Write([]byte{0xFF, 0xD9})
+
+	return buffered.Flush()
+}
+
+func encodeDC(bits *bitWriter, codes []huffmanCode, diff int32) {
+	size, value := magnitude(diff)
+	bits.write(uint32(codes[size].code), codes[size].length)
+	bits.write(value, size)
+}
+
+func encodeAC(bits *bitWriter, codes []huffmanCode, block [64]int32, start, end int) {
+	run := 0
+	for k := start; k <= end; k++ {
+		if 0 == block[k] {
+			run++
+			continue
+		}
+
+		for 15 < run {
+			bits.write(uint32(codes[0xF0].code), codes[0xF0].length)
+			run -= 16
+		}
+
+		size, value := magnitude(block[k])
+		symbol := run<<4 | int(size)
+		bits.write(uint32(codes[symbol].code), codes[symbol].length)
+		bits.write(value, size)
+		run = 0
+	}
+
+	if 0 < run {
+		bits.write(uint32(codes[0x00].code), codes[0x00].length)
+	}
+}
+
+func magnitude(value int32) (uint8, uint32) {
+	absolute := value
+	if 0 > value {
+		absolute = -value
+		value--
+	}
+
+	size := uint8(0)
+	for 0 != absolute {
+		size++
+		absolute >>= 1
+	}
+
+	return size, uint32(value) & (1<<size - 1)
+}
+
+// ycbcrPlanes converts img to full resolution Y, Cb and Cr planes, reading
+// the pixel buffers of the image types the pipeline produces directly.
+func ycbcrPlanes(img image.Image) [3][]uint8 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var planes [3][]uint8
+	for i := range planes {
+		planes[i] = make([]uint8, width*height)
+	}
+
+	switch img := img.(type) {
+	case *image.YCbCr:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				i := y*width + x
+				planes[0][i] = img.Y[img.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+				c := img.COffset(bounds.Min.X+x, bounds.Min.Y+y)
+				planes[1][i], planes[2][i] = img.Cb[c], img.Cr[c]
+			}
+		}
+	case *image.NRGBA:
+		for y := 0; y < height; y++ {
+			pix := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+			for x := 0; x < width; x++ {
+				p := pix[x*4 : x*4+4]
+				// Transparent pixels are composited onto black, as with image/jpeg.
+				a := uint32(p[3])
+				r, g, b := uint32(p[0])*a/0xFF, uint32(p[1])*a/0xFF, uint32(p[2])*a/0xFF
+				i := y*width + x
+				planes[0][i], planes[1][i], planes[2][i] = color.RGBToYCbCr(uint8(r), uint8(g), uint8(b))
+			}
+		}
+	case *image.RGBA:
+		for y := 0; y < height; y++ {
+			pix := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+			for x := 0; x < width; x++ {
+				i := y*width + x
+				planes[0][i], planes[1][i], planes[2][i] = color.RGBToYCbCr(pix[x*4], pix[x*4+1], pix[x*4+2])
+			}
+		}
+	default:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				i := y*width + x
+				planes[0][i], planes[1][i], planes[2][i] = color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			}
+		}
+	}
+
+	return planes
+}
+
+// forwardDCT is the AAN float DCT from the IJG library, run over the rows
+// and then the columns, with its output scaled back to JPEG coefficients.
+func forwardDCT(block *[64]float64) [64]float64 {
+	output := *block
+	for i := 0; i < 8; i++ {
+		aan(&output, i*8, 1)
+	}
+	for i := 0; i < 8; i++ {
+		aan(&output, i, 8)
+	}
+
+	for k := range output {
+		output[k] *= dctScale[k]
+	}
+
+	return output
+}
+
+func aan(data *[64]float64, offset, stride int) {
+	d0, d1, d2, d3 := data[offset], data[offset+stride], data[offset+2*stride], data[offset+3*stride]
+	d4, d5, d6, d7 := data[offset+4*stride], data[offset+5*stride], data[offset+6*stride], data[offset+7*stride]
+
+	tmp0, tmp7 := d0+d7, d0-d7
+	tmp1, tmp6 := d1+d6, d1-d6
+	tmp2, tmp5 := d2+d5, d2-d5
+	tmp3, tmp4 := d3+d4, d3-d4
+
+	tmp10, tmp13 := tmp0+tmp3, tmp0-tmp3
+	tmp11, tmp12 := tmp1+tmp2, tmp1-tmp2
+	data[offset] = tmp10 + tmp11
+	data[offset+4*stride] = tmp10 - tmp11
+	z1 := (tmp12 + tmp13) * 0.707106781
+	data[offset+2*stride] = tmp13 + z1
+	data[offset+6*stride] = tmp13 - z1
+
+	tmp10, tmp11, tmp12 = tmp4+tmp5, tmp5+tmp6, tmp6+tmp7
+	z5 := (tmp10 - tmp12) * 0.382683433
+	z2 := 0.541196100*tmp10 + z5
+	z4 := 1.306562965*tmp12 + z5
+	z3 := tmp11 * 0.707106781
+	z11, z13 := tmp7+z3, tmp7-z3
+	data[offset+5*stride] = z13 + z2
+	data[offset+3*stride] = z13 - z2
+	data[offset+stride] = z11 + z4
+	data[offset+7*stride] = z11 - z4
+}
+
+// dctScale undoes the per coefficient scaling AAN leaves in its output.
+var dctScale = func() [64]float64 {
+	factors := [8]float64{1, 1.387039845, 1.306562965, 1.175875602, 1, 0.785694958, 0.541196100, 0.275899379}
+
+	var scale [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			scale[v*8+u] = 1 / (8 * factors[u] * factors[v])
+		}
+	}
+
+	return scale
+}()
+
+func scaledQuantTables(quality int) [2][64]int {
+	scale := 200 - quality*2
+	if 50 > quality {
+		scale = 5000 / quality
+	}
+
+	var tables [2][64]int
+	for i, base := range baseQuantTables {
+		for k, value := range base {
+			scaled := (value*scale + 50) / 100
+			tables[i][k] = maxInt(1, minInt(255, scaled))
+		}
+	}
+
+	return tables
+}
+
+func buildHuffmanCodes(table huffmanTable) []huffmanCode {
+	codes := make([]huffmanCode, 256)
+	code, index := uint16(0), 0
+	for length := 0; length < 16; length++ {
+		for i := 0; i < int(table.counts[length]); i++ {
+			codes[table.values[index]] = huffmanCode{length: uint8(length + 1), code: code}
+			code++
+			index++
+		}
+		code <<= 1
+	}
+
+	return codes
+}
+
+func writeMarker(writer *bufio.Writer, marker byte, payload []byte) {
+	length := len(payload) + 2
+	_, _ = writer.Write([]byte{0xFF, marker, byte(length >> 8), byte(length)})
+	_, _ = writer.Write(payload)
+}
+
+func writeQuantTables(writer *bufio.Writer, tables [2][64]int) {
+	var payload []byte
+	for i, table := range tables {
+		payload = append(payload, byte(i))
+		for _, value := range table {
+			payload = append(payload, byte(value))
+		}
+	}
+	writeMarker(writer, 0xDB, payload)
+}
+
+func writeFrameHeader(writer *bufio.Writer, width, height int) {
+	writeMarker(writer, 0xC2, []byte{
+		8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 3,
+		1, 0x11, 0,
+		2, 0x11, 1,
+		3, 0x11, 1,
+	})
+}
+
+func writeHuffmanTables(writer *bufio.Writer) {
+	var payload []byte
+	for i, table := range huffmanTables {
+		payload = append(payload, byte((i%2)<<4|i/2))
+		payload = append(payload, table.counts[:]...)
+		payload = append(payload, table.values...)
+	}
+	writeMarker(writer, 0xC4, payload)
+}
+
+func writeScanHeader(writer *bufio.Writer, components []int, start, end int) {
+	payload := []byte{byte(len(components))}
+	for _, component := range components {
+		table := byte(minInt(component, 1))
+		payload = append(payload, byte(component+1), table<<4|table)
+	}
+	payload = append(payload, byte(start), byte(end), 0)
+	writeMarker(writer, 0xDA, payload)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
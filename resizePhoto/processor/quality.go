@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// qualitySize is the longest side photos are scored at, so sharpness does not
+// depend on the camera's resolution.
+const qualitySize = 512
+
+// QualityGate rejects blurred, too dark or too bright, and near-uniform
+// photos. Sharpness is the variance of the Laplacian, Brightness the mean
+// luma from 0 to 255, and Deviation the largest standard deviation of a
+// colour channel.
+type QualityGate struct {
+	MinSharpness  float64
+	MinBrightness float64
+	MaxBrightness float64
+	MinDeviation  float64
+}
+
+func (q QualityGate) Validate() error {
+	if 0 > q.MinSharpness {
+		return ResizerConfigError{Err: fmt.Errorf("minimum sharpness %g must not be negative", q.MinSharpness)}
+	}
+
+	if !(0 <= q.MinBrightness && q.MinBrightness < q.MaxBrightness && 255 >= q.MaxBrightness) {
+		return ResizerConfigError{Err: fmt.Errorf("brightness range %g-%g must be within 0-255", q.MinBrightness, q.MaxBrightness)}
+	}
+
+	if !(0 <= q.MinDeviation && 255 >= q.MinDeviation) {
+		return ResizerConfigError{Err: fmt.Errorf("minimum deviation %g must be between 0 and 255", q.MinDeviation)}
+	}
+
+	return nil
+}
+
+func DefaultQualityGate() QualityGate {
+	return QualityGate{
+		MinSharpness:  10,
+		MinBrightness: 15,
+		MaxBrightness: 245,
+		MinDeviation:  8,
+	}
+}
+
+type QualityScores struct {
+	Sharpness  float64
+	Brightness float64
+	Deviation  float64
+}
+
+func (q QualityGate) check(scores QualityScores) error {
+	var reasons []string
+	if scores.Sharpness < q.MinSharpness {
+		reasons = append(reasons, fmt.Sprintf("sharpness %.1f is below %g", scores.Sharpness, q.MinSharpness))
+	}
+	if scores.Brightness < q.MinBrightness {
+		reasons = append(reasons, fmt.Sprintf("brightness %.1f is below %g", scores.Brightness, q.MinBrightness))
+	}
+	if scores.Brightness > q.MaxBrightness {
+		reasons = append(reasons, fmt.Sprintf("brightness %.1f is above %g", scores.Brightness, q.MaxBrightness))
+	}
+	if scores.Deviation < q.MinDeviation {
+		reasons = append(reasons, fmt.Sprintf("colour deviation %.1f is below %g", scores.Deviation, q.MinDeviation))
+	}
+
+	if 0 == len(reasons) {
+		return nil
+	}
+
+	return RejectedImageError{Err: errors.New("rejected image: " + strings.Join(reasons, ", ")), Scores: scores}
+}
+
+type QualityStage struct {
+	gate QualityGate
+}
+
+func (s QualityStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	return decoded, s.gate.check(scoreQuality(decoded.Image))
+}
+
+func NewQualityStage(gate QualityGate) QualityStage {
+	return QualityStage{
+		gate: gate,
+	}
+}
+
+func scoreQuality(img image.Image) QualityScores {
+	bounds := img.Bounds()
+	if bounds.Dx() > qualitySize || bounds.Dy() > qualitySize {
+		img = resize.Thumbnail(qualitySize, qualitySize, img, resize.Bilinear)
+		bounds = img.Bounds()
+	}
+
+	rgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+
+	luma := make([]float64, width*height)
+	var sums, squares [3]float64
+	var brightness float64
+	for i := range luma {
+		pixel := rgba.Pix[i*4 : i*4+3]
+		for c := 0; c < 3; c++ {
+			value := float64(pixel[c])
+			sums[c] += value
+			squares[c] += value * value
+		}
+		luma[i] = 0.299*float64(pixel[0]) + 0.587*float64(pixel[1]) + 0.114*float64(pixel[2])
+		brightness += luma[i]
+	}
+
+	count := float64(len(luma))
+	var deviation float64
+	for c := 0; c < 3; c++ {
+		mean := sums[c] / count
+		deviation = math.Max(deviation, math.Sqrt(math.Max(0, squares[c]/count-mean*mean)))
+	}
+
+	return QualityScores{
+		Sharpness:  laplacianVariance(luma, width, height),
+		Brightness: brightness / count,
+		Deviation:  deviation,
+	}
+}
+
+func laplacianVariance(luma []float64, width, height int) float64 {
+	if 3 > width || 3 > height {
+		return 0
+	}
+
+	var sum, squares float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			laplacian := luma[i-width] + luma[i+width] + luma[i-1] + luma[i+1] - 4*luma[i]
+			sum += laplacian
+			squares += laplacian * laplacian
+		}
+	}
+
+	count := float64((width - 2) * (height - 2))
+	mean := sum / count
+
+	return squares/count - mean*mean
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type qualityTestSuite struct {
+	suite.Suite
+}
+
+func blurred(img *image.NRGBA, radius int) *image.NRGBA {
+	blurredImg := image.NewNRGBA(img.Rect)
+	copy(blurredImg.Pix, img.Pix)
+	boxBlur(blurredImg, radius)
+
+	return blurredImg
+}
+
+func (s *qualityTestSuite) TestApply() {
+	s.T().Run("passes sharp, well exposed photos", func(t *testing.T) {
+		_, err := NewQualityStage(DefaultQualityGate()).Apply(DecodedImage{Image: groupShot(1200, 800, 600, 400)})
+
+		assert.Nil(t, err)
+	})
+
+	s.T().Run("rejects blurred photos", func(t *testing.T) {
+		_, err := NewQualityStage(DefaultQualityGate()).Apply(DecodedImage{Image: blurred(groupShot(1200, 800, 600, 400), 4)})
+
+		var rejected RejectedImageError
+		assert.True(t, errors.As(err, &rejected))
+		assert.Less(t, rejected.Scores.Sharpness, 10.0)
+		assert.Contains(t, err.Error(), "rejected image: sharpness")
+	})
+
+	s.T().Run("rejects dark photos", func(t *testing.T) {
+		_, err := NewQualityStage(QualityGate{MinBrightness: 15, MaxBrightness: 245}).Apply(DecodedImage{Image: faded(600, 400, 0, 10, color.NRGBA{})})
+
+		assert.True(t, errors.Is(err, RejectedImageError{}))
+		assert.Contains(t, err.Error(), "brightness 4.5 is below 15")
+	})
+
+	s.T().Run("rejects near-uniform photos", func(t *testing.T) {
+		_, err := NewQualityStage(QualityGate{MinBrightness: 0, MaxBrightness: 255, MinDeviation: 8}).Apply(DecodedImage{Image: solid(600, 400, color.NRGBA{R: 100, G: 120, B: 140, A: 255})})
+
+		assert.Equal(t, "rejected image: colour deviation 0.0 is below 8", err.Error())
+	})
+
+	s.T().Run("scores at a fixed size", func(t *testing.T) {
+		large := scoreQuality(groupShot(2400, 1600, 1200, 800))
+		medium := scoreQuality(groupShot(1200, 800, 600, 400))
+
+		assert.InEpsilon(t, medium.Sharpness, large.Sharpness, 0.25)
+	})
+}
+
+func (s *qualityTestSuite) TestValidate() {
+	s.T().Run("accepts the default gate", func(t *testing.T) {
+		assert.Nil(t, DefaultQualityGate().Validate())
+	})
+
+	s.T().Run("returns ResizerConfigError for invalid thresholds", func(t *testing.T) {
+		for _, gate := range []QualityGate{
+			{MinSharpness: -1, MaxBrightness: 255},
+			{MinBrightness: 200, MaxBrightness: 100},
+			{MaxBrightness: 300},
+			{MaxBrightness: 255, MinDeviation: 256},
+		} {
+			assert.True(t, errors.Is(gate.Validate(), ResizerConfigError{}))
+		}
+	})
+}
+
+func TestQualityTestSuite(t *testing.T) {
+	suite.Run(t, new(qualityTestSuite))
+}
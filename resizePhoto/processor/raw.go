@@ -0,0 +1,381 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"strings"
+)
+
+const (
+	tagNewSubFileType   uint16 = 0x00FE
+	tagImageWidth       uint16 = 0x0100
+	tagImageLength      uint16 = 0x0101
+	tagBitsPerSample    uint16 = 0x0102
+	tagCompression      uint16 = 0x0103
+	tagPhotometric      uint16 = 0x0106
+	tagMake             uint16 = 0x010F
+	tagStripOffsets     uint16 = 0x0111
+	tagSamplesPerPixel  uint16 = 0x0115
+	tagStripByteCounts  uint16 = 0x0117
+	tagTileWidth        uint16 = 0x0142
+	tagTileLength       uint16 = 0x0143
+	tagTileOffsets      uint16 = 0x0144
+	tagTileByteCounts   uint16 = 0x0145
+	tagSubIFDs          uint16 = 0x014A
+	tagJPEGOffset       uint16 = 0x0201
+	tagJPEGLength       uint16 = 0x0202
+	tagCFARepeatPattern uint16 = 0x828D
+	tagCFAPattern       uint16 = 0x828E
+	tagDNGVersion       uint16 = 0xC612
+	tagBlackLevel       uint16 = 0xC61A
+	tagWhiteLevel       uint16 = 0xC61D
+	tagAsShotNeutral    uint16 = 0xC628
+
+	photometricCFA       uint32 = 32803
+	maxRAWDirectoryCount        = 64
+)
+
+type rawIFD map[uint16]exifEntry
+
+func detectRAWFormat(data []byte) Format {
+	if 10 <= len(data) && "CR" == string(data[8:10]) {
+		return FormatCR2
+	}
+
+	byteOrder, err := tiffByteOrder(data)
+	if nil != err {
+		return FormatUnknown
+	}
+
+	ifd0, err := readIFD(data, byteOrder, byteOrder.Uint32(data[4:]))
+	if nil != err {
+		return FormatUnknown
+	}
+
+	for _, entry := range ifd0 {
+		if tagDNGVersion == entry.tag {
+			return FormatDNG
+		}
+
+		if tagMake == entry.tag && typeASCII == entry.dataType {
+			cameraMake := strings.ToUpper(string(entry.value))
+			if strings.HasPrefix(cameraMake, "NIKON") {
+				return FormatNEF
+			}
+			if strings.HasPrefix(cameraMake, "SONY") {
+				return FormatARW
+			}
+		}
+	}
+
+	return FormatUnknown
+}
+
+func isRAW(format Format) bool {
+	return FormatDNG == format || FormatCR2 == format || FormatNEF == format || FormatARW == format
+}
+
+func decodeRAW(data []byte, format Format) (image.Image, error) {
+	byteOrder, err := tiffByteOrder(data)
+	if nil != err {
+		return nil, err
+	}
+
+	ifds := readRAWDirectories(data, byteOrder)
+
+	if preview := largestPreview(data, byteOrder, ifds); nil != preview {
+		return jpeg.Decode(bytes.NewReader(preview))
+	}
+
+	if FormatDNG == format {
+		return demosaicDNG(data, byteOrder, ifds)
+	}
+
+	return nil, errors.New("raw file has no embedded jpeg preview")
+}
+
+func readRAWDirectories(data []byte, byteOrder binary.ByteOrder) []rawIFD {
+	var ifds []rawIFD
+	visited := map[uint32]bool{}
+	pending := []uint32{byteOrder.Uint32(data[4:])}
+
+	for 0 < len(pending) && maxRAWDirectoryCount > len(ifds) {
+		offset := pending[0]
+		pending = pending[1:]
+		if 0 == offset || visited[offset] {
+			continue
+		}
+		visited[offset] = true
+
+		entries, err := readIFD(data, byteOrder, offset)
+		if nil != err {
+			continue
+		}
+
+		ifd := rawIFD{}
+		for _, entry := range entries {
+			ifd[entry.tag] = entry
+		}
+		ifds = append(ifds, ifd)
+
+		if subIFDs, ok := ifd[tagSubIFDs]; ok {
+			pending = append(pending, subIFDs.uints(byteOrder)...)
+		}
+		if exifIFD, ok := ifd[tagExifIFD]; ok {
+			pending = append(pending, exifIFD.uints(byteOrder)...)
+		}
+		pending = append(pending, nextIFDOffset(data, byteOrder, offset))
+	}
+
+	return ifds
+}
+
+func largestPreview(data []byte, byteOrder binary.ByteOrder, ifds []rawIFD) []byte {
+	var largest []byte
+	largestArea := 0
+
+	for _, ifd := range ifds {
+		for _, candidate := range previewCandidates(data, byteOrder, ifd) {
+			config, err := jpeg.DecodeConfig(bytes.NewReader(candidate))
+			if nil != err {
+				continue
+			}
+
+			if area := config.Width * config.Height; area > largestArea {
+				largest, largestArea = candidate, area
+			}
+		}
+	}
+
+	return largest
+}
+
+func previewCandidates(data []byte, byteOrder binary.ByteOrder, ifd rawIFD) [][]byte {
+	var candidates [][]byte
+
+	if offset, length, ok := ifd.pair(byteOrder, tagJPEGOffset, tagJPEGLength); ok {
+		if preview := slice(data, offset, length); nil != preview {
+			candidates = append(candidates, preview)
+		}
+	}
+
+	compression := ifd.value(byteOrder, tagCompression, 1)
+	if 6 == compression || 7 == compression {
+		if offset, length, ok := ifd.pair(byteOrder, tagStripOffsets, tagStripByteCounts); ok {
+			if preview := slice(data, offset, length); nil != preview && bytes.HasPrefix(preview, []byte{0xFF, 0xD8}) {
+				candidates = append(candidates, preview)
+			}
+		}
+	}
+
+	return candidates
+}
+
+func demosaicDNG(data []byte, byteOrder binary.ByteOrder, ifds []rawIFD) (image.Image, error) {
+	raw := cfaIFD(byteOrder, ifds)
+	if nil == raw {
+		return nil, errors.New("dng has no cfa image")
+	}
+
+	width := int(raw.value(byteOrder, tagImageWidth, 0))
+	height := int(raw.value(byteOrder, tagImageLength, 0))
+	bits := raw.value(byteOrder, tagBitsPerSample, 0)
+	if 1 != raw.value(byteOrder, tagCompression, 1) || 1 != raw.value(byteOrder, tagSamplesPerPixel, 1) {
+		return nil, errors.New("dng cfa image is compressed")
+	}
+	if 8 != bits && 16 != bits {
+		return nil, errors.New("dng cfa image has unsupported bit depth")
+	}
+	if 2 > width || 2 > height {
+		return nil, errors.New("dng cfa image is too small")
+	}
+
+	pattern, ok := raw[tagCFAPattern]
+	if dims := raw[tagCFARepeatPattern].uints(byteOrder); !ok || 4 != pattern.count || 2 != len(dims) || 2 != dims[0] || 2 != dims[1] {
+		return nil, errors.New("dng cfa pattern must be 2x2")
+	}
+
+	samples, err := readCFASamples(data, byteOrder, raw, width, height, int(bits))
+	if nil != err {
+		return nil, err
+	}
+
+	black := 0.0
+	if levels := raw[tagBlackLevel].floats(byteOrder); 0 < len(levels) {
+		black = levels[0]
+	}
+	white := float64(uint32(1)<<bits - 1)
+	if levels := raw[tagWhiteLevel].floats(byteOrder); 0 < len(levels) {
+		white = levels[0]
+	}
+	if white <= black {
+		return nil, errors.New("dng white level must exceed black level")
+	}
+
+	gains := [3]float64{1, 1, 1}
+	if neutral := raw[tagAsShotNeutral].floats(byteOrder); 3 == len(neutral) && 0 < neutral[0] && 0 < neutral[1] && 0 < neutral[2] {
+		gains = [3]float64{neutral[1] / neutral[0], 1, neutral[1] / neutral[2]}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width/2, height/2))
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width/2; x++ {
+			var sums [3]float64
+			var counts [3]float64
+			for i := 0; i < 4; i++ {
+				channel := pattern.value[i]
+				if 2 < channel {
+					continue
+				}
+				sample := float64(samples[(y*2+i/2)*width+x*2+i%2])
+				sums[channel] += (sample - black) / (white - black)
+				counts[channel]++
+			}
+
+			var rgb [3]uint8
+			for channel := range rgb {
+				if 0 < counts[channel] {
+					rgb[channel] = linearToSRGB(sums[channel] / counts[channel] * gains[channel])
+				}
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255})
+		}
+	}
+
+	return img, nil
+}
+
+func cfaIFD(byteOrder binary.ByteOrder, ifds []rawIFD) rawIFD {
+	for _, ifd := range ifds {
+		if photometricCFA == ifd.value(byteOrder, tagPhotometric, 0) && 0 == ifd.value(byteOrder, tagNewSubFileType, 0) {
+			return ifd
+		}
+	}
+
+	return nil
+}
+
+func decodeRAWConfig(data []byte) (image.Config, error) {
+	byteOrder, err := tiffByteOrder(data)
+	if nil != err {
+		return image.Config{}, err
+	}
+
+	ifds := readRAWDirectories(data, byteOrder)
+
+	if preview := largestPreview(data, byteOrder, ifds); nil != preview {
+		return jpeg.DecodeConfig(bytes.NewReader(preview))
+	}
+
+	if raw := cfaIFD(byteOrder, ifds); nil != raw {
+		return image.Config{
+			Width:  int(raw.value(byteOrder, tagImageWidth, 0)),
+			Height: int(raw.value(byteOrder, tagImageLength, 0)),
+		}, nil
+	}
+
+	return image.Config{}, errors.New("raw file has no embedded jpeg preview")
+}
+
+func readCFASamples(data []byte, byteOrder binary.ByteOrder, raw rawIFD, width, height, bits int) ([]uint16, error) {
+	bytesPerSample := bits / 8
+	samples := make([]uint16, width*height)
+
+	read := func(chunk []byte, x0, y0, chunkWidth, chunkHeight int) {
+		for y := 0; y < chunkHeight && y0+y < height; y++ {
+			for x := 0; x < chunkWidth && x0+x < width; x++ {
+				index := (y*chunkWidth + x) * bytesPerSample
+				if index+bytesPerSample > len(chunk) {
+					return
+				}
+				if 1 == bytesPerSample {
+					samples[(y0+y)*width+x0+x] = uint16(chunk[index])
+				} else {
+					samples[(y0+y)*width+x0+x] = byteOrder.Uint16(chunk[index:])
+				}
+			}
+		}
+	}
+
+	if offsets, ok := raw[tagTileOffsets]; ok {
+		tileWidth := int(raw.value(byteOrder, tagTileWidth, 0))
+		tileHeight := int(raw.value(byteOrder, tagTileLength, 0))
+		if 0 == tileWidth || 0 == tileHeight {
+			return nil, errors.New("dng tile size missing")
+		}
+
+		counts := raw[tagTileByteCounts].uints(byteOrder)
+		tilesAcross := (width + tileWidth - 1) / tileWidth
+		for i, offset := range offsets.uints(byteOrder) {
+			if i >= len(counts) {
+				break
+			}
+			chunk := slice(data, offset, counts[i])
+			if nil == chunk {
+				return nil, errors.New("dng tile out of range")
+			}
+			read(chunk, (i%tilesAcross)*tileWidth, (i/tilesAcross)*tileHeight, tileWidth, tileHeight)
+		}
+
+		return samples, nil
+	}
+
+	counts := raw[tagStripByteCounts].uints(byteOrder)
+	var strip []byte
+	for i, offset := range raw[tagStripOffsets].uints(byteOrder) {
+		if i >= len(counts) {
+			break
+		}
+		chunk := slice(data, offset, counts[i])
+		if nil == chunk {
+			return nil, errors.New("dng strip out of range")
+		}
+		strip = append(strip, chunk...)
+	}
+	read(strip, 0, 0, width, height)
+
+	return samples, nil
+}
+
+func (ifd rawIFD) value(byteOrder binary.ByteOrder, tag uint16, fallback uint32) uint32 {
+	if values := ifd[tag].uints(byteOrder); 0 < len(values) {
+		return values[0]
+	}
+
+	return fallback
+}
+
+func (ifd rawIFD) pair(byteOrder binary.ByteOrder, offsetTag, lengthTag uint16) (uint32, uint32, bool) {
+	offsets := ifd[offsetTag].uints(byteOrder)
+	lengths := ifd[lengthTag].uints(byteOrder)
+	if 1 != len(offsets) || 1 != len(lengths) {
+		return 0, 0, false
+	}
+
+	return offsets[0], lengths[0], true
+}
+
+func slice(data []byte, offset, length uint32) []byte {
+	end := uint64(offset) + uint64(length)
+	if 0 == length || end > uint64(len(data)) {
+		return nil
+	}
+
+	return data[offset:end]
+}
+
+func linearToSRGB(value float64) uint8 {
+	value = math.Max(0, math.Min(1, value))
+	if value <= 0.0031308 {
+		value *= 12.92
+	} else {
+		value = 1.055*math.Pow(value, 1/2.4) - 0.055
+	}
+
+	return uint8(math.Round(value * 255))
+}
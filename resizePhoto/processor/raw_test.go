@@ -0,0 +1,278 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type rawTestSuite struct {
+	suite.Suite
+}
+
+func (s *rawTestSuite) TestDetectFormat() {
+	s.T().Run("detects cr2 from header", func(t *testing.T) {
+		data := buildTIFF([]byte("CR\x02\x00\x00\x00\x00\x00"), nil, []testIFD{{}})
+
+		assert.Equal(t, FormatCR2, DetectFormat(data))
+	})
+
+	s.T().Run("detects dng from DNGVersion tag", func(t *testing.T) {
+		data := buildTIFF(nil, nil, []testIFD{{entries: []testEntry{{tag: tagDNGVersion, dataType: 1, values: []uint32{1, 4, 0, 0}}}}})
+
+		assert.Equal(t, FormatDNG, DetectFormat(data))
+	})
+
+	s.T().Run("detects nef and arw from camera make", func(t *testing.T) {
+		nef := buildTIFF(nil, nil, []testIFD{{entries: []testEntry{{tag: tagMake, text: "NIKON CORPORATION"}}}})
+		arw := buildTIFF(nil, nil, []testIFD{{entries: []testEntry{{tag: tagMake, text: "SONY"}}}})
+
+		assert.Equal(t, FormatNEF, DetectFormat(nef))
+		assert.Equal(t, FormatARW, DetectFormat(arw))
+	})
+
+	s.T().Run("treats other tiff files as tiff", func(t *testing.T) {
+		data := buildTIFF(nil, nil, []testIFD{{entries: []testEntry{{tag: tagMake, text: "Epson"}}}})
+
+		assert.Equal(t, FormatTIFF, DetectFormat(data))
+	})
+}
+
+func (s *rawTestSuite) TestDecodeRAW() {
+	s.T().Run("extracts largest jpeg preview from sub ifds", func(t *testing.T) {
+		small := testJPEG(16, 12)
+		large := testJPEG(64, 48)
+		data := buildTIFF(nil, [][]byte{small, large}, []testIFD{
+			{entries: []testEntry{{tag: tagMake, text: "NIKON CORPORATION"}, {tag: tagSubIFDs, ifds: []int{1, 2}}}},
+			{entries: []testEntry{{tag: tagJPEGOffset, blob: 0, blobOffset: true}, {tag: tagJPEGLength, blob: 0}}},
+			{entries: []testEntry{{tag: tagJPEGOffset, blob: 1, blobOffset: true}, {tag: tagJPEGLength, blob: 1}}},
+		})
+
+		img, err := decodeRAW(data, FormatNEF)
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 64, 48), img.Bounds())
+	})
+
+	s.T().Run("extracts jpeg strip preview from cr2", func(t *testing.T) {
+		preview := testJPEG(40, 30)
+		data := buildTIFF([]byte("CR\x02\x00\x00\x00\x00\x00"), [][]byte{preview}, []testIFD{
+			{entries: []testEntry{
+				{tag: tagCompression, values: []uint32{6}},
+				{tag: tagStripOffsets, blob: 0, blobOffset: true},
+				{tag: tagStripByteCounts, blob: 0},
+			}},
+		})
+
+		img, err := decodeRAW(data, FormatCR2)
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 40, 30), img.Bounds())
+	})
+
+	s.T().Run("demosaics dng without preview", func(t *testing.T) {
+		data := buildTIFF(nil, [][]byte{rggbSamples(8, 8, 60000, 0, 0)}, []testIFD{
+			{entries: dngEntries(8, 8)},
+		})
+
+		img, err := decodeRAW(data, FormatDNG)
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 4, 4), img.Bounds())
+		assert.Equal(t, color.NRGBA{R: 255, G: 0, B: 0, A: 255}, img.At(2, 2))
+	})
+
+	s.T().Run("applies as shot neutral white balance to dng", func(t *testing.T) {
+		entries := append(dngEntries(4, 4), testEntry{tag: tagAsShotNeutral, dataType: 5, values: []uint32{1, 2, 1, 1, 1, 2}})
+		data := buildTIFF(nil, [][]byte{rggbSamples(4, 4, 16383, 16383, 16383)}, []testIFD{{entries: entries}})
+
+		img, err := decodeRAW(data, FormatDNG)
+
+		assert.Nil(t, err)
+
+		pixel := img.At(0, 0).(color.NRGBA)
+		assert.Equal(t, pixel.R, pixel.B)
+		assert.Greater(t, pixel.R, pixel.G)
+	})
+
+	s.T().Run("returns error for raw without preview", func(t *testing.T) {
+		data := buildTIFF(nil, nil, []testIFD{{entries: []testEntry{{tag: tagMake, text: "SONY"}}}})
+
+		_, err := decodeRAW(data, FormatARW)
+
+		assert.Equal(t, "raw file has no embedded jpeg preview", err.Error())
+	})
+}
+
+type testEntry struct {
+	tag        uint16
+	dataType   uint16
+	values     []uint32
+	text       string
+	blob       int
+	blobOffset bool
+	ifds       []int
+}
+
+type testIFD struct {
+	entries []testEntry
+}
+
+// buildTIFF lays out a little endian TIFF as header, blobs then ifds. ifds[0]
+// is IFD0 and the others are only reachable through SubIFDs entries.
+func buildTIFF(extraHeader []byte, blobs [][]byte, ifds []testIFD) []byte {
+	header := append([]byte("II*\x00\x00\x00\x00\x00"), extraHeader...)
+	offset := len(header)
+
+	blobOffsets := make([]int, len(blobs))
+	for i, blob := range blobs {
+		blobOffsets[i] = offset
+		offset += len(blob) + len(blob)%2
+	}
+
+	ifdOffsets := make([]int, len(ifds))
+	for i, ifd := range ifds {
+		ifdOffsets[i] = offset
+		offset += 2 + len(ifd.entries)*12 + 4
+		for _, entry := range ifd.entries {
+			if size := len(entryData(entry, blobs, blobOffsets, ifdOffsets)); 4 < size {
+				offset += size + size%2
+			}
+		}
+	}
+
+	data := make([]byte, offset)
+	copy(data, header)
+	binary.LittleEndian.PutUint32(data[4:], uint32(ifdOffsets[0]))
+	for i, blob := range blobs {
+		copy(data[blobOffsets[i]:], blob)
+	}
+
+	for i, ifd := range ifds {
+		position := ifdOffsets[i]
+		values := position + 2 + len(ifd.entries)*12 + 4
+		binary.LittleEndian.PutUint16(data[position:], uint16(len(ifd.entries)))
+
+		for j, entry := range ifd.entries {
+			raw := data[position+2+j*12:]
+			value := entryData(entry, blobs, blobOffsets, ifdOffsets)
+			dataType, count := entryType(entry)
+
+			binary.LittleEndian.PutUint16(raw, entry.tag)
+			binary.LittleEndian.PutUint16(raw[2:], dataType)
+			binary.LittleEndian.PutUint32(raw[4:], count)
+			if 4 >= len(value) {
+				copy(raw[8:12], value)
+				continue
+			}
+
+			binary.LittleEndian.PutUint32(raw[8:], uint32(values))
+			copy(data[values:], value)
+			values += len(value) + len(value)%2
+		}
+	}
+
+	return data
+}
+
+func entryType(entry testEntry) (uint16, uint32) {
+	switch {
+	case "" != entry.text:
+		return typeASCII, uint32(len(entry.text) + 1)
+	case nil != entry.ifds:
+		return typeLong, uint32(len(entry.ifds))
+	case nil == entry.values:
+		return typeLong, 1
+	case 5 == entry.dataType:
+		return 5, uint32(len(entry.values) / 2)
+	case 0 != entry.dataType:
+		return entry.dataType, uint32(len(entry.values))
+	}
+
+	return typeLong, uint32(len(entry.values))
+}
+
+func entryData(entry testEntry, blobs [][]byte, blobOffsets, ifdOffsets []int) []byte {
+	if "" != entry.text {
+		return append([]byte(entry.text), 0)
+	}
+
+	values := entry.values
+	switch {
+	case nil != entry.ifds:
+		values = nil
+		for _, ifd := range entry.ifds {
+			values = append(values, uint32(ifdOffsets[ifd]))
+		}
+	case nil == values && entry.blobOffset:
+		values = []uint32{uint32(blobOffsets[entry.blob])}
+	case nil == values:
+		values = []uint32{uint32(len(blobs[entry.blob]))}
+	}
+
+	dataType, _ := entryType(entry)
+	buf := new(bytes.Buffer)
+	for _, value := range values {
+		switch dataType {
+		case 1:
+			buf.WriteByte(byte(value))
+		case typeShort:
+			_ = binary.Write(buf, binary.LittleEndian, uint16(value))
+		default:
+			_ = binary.Write(buf, binary.LittleEndian, value)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func dngEntries(width, height uint32) []testEntry {
+	return []testEntry{
+		{tag: tagNewSubFileType, values: []uint32{0}},
+		{tag: tagImageWidth, values: []uint32{width}},
+		{tag: tagImageLength, values: []uint32{height}},
+		{tag: tagBitsPerSample, dataType: typeShort, values: []uint32{16}},
+		{tag: tagCompression, dataType: typeShort, values: []uint32{1}},
+		{tag: tagPhotometric, dataType: typeShort, values: []uint32{photometricCFA}},
+		{tag: tagStripOffsets, blob: 0, blobOffset: true},
+		{tag: tagStripByteCounts, blob: 0},
+		{tag: tagCFARepeatPattern, dataType: typeShort, values: []uint32{2, 2}},
+		{tag: tagCFAPattern, dataType: 1, values: []uint32{0, 1, 1, 2}},
+		{tag: tagDNGVersion, dataType: 1, values: []uint32{1, 4, 0, 0}},
+		{tag: tagWhiteLevel, values: []uint32{60000}},
+	}
+}
+
+func rggbSamples(width, height int, red, green, blue uint16) []byte {
+	buf := new(bytes.Buffer)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sample := green
+			if 0 == y%2 && 0 == x%2 {
+				sample = red
+			} else if 1 == y%2 && 1 == x%2 {
+				sample = blue
+			}
+			_ = binary.Write(buf, binary.LittleEndian, sample)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func testJPEG(width, height int) []byte {
+	buf := new(bytes.Buffer)
+	_ = jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+
+	return buf.Bytes()
+}
+
+func TestRawTestSuite(t *testing.T) {
+	suite.Run(t, new(rawTestSuite))
+}
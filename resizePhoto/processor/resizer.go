@@ -1,47 +1,207 @@
 package processor
 
 import (
-	"bytes"
 	"fmt"
-	"image"
-	"image/jpeg"
-	_ "image/png"
+	"image/color"
+	"strings"
 
 	"github.com/nfnt/resize"
 )
 
+type FitMode string
+
+const (
+	FitModeFit   FitMode = "fit"
+	FitModeFill  FitMode = "fill"
+	FitModePad   FitMode = "pad"
+	FitModeBlur  FitMode = "blur"
+	FitModeSmart FitMode = "smart"
+)
+
+func ParseFitMode(name string) (FitMode, error) {
+	switch mode := FitMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case FitModeFit, FitModeFill, FitModePad, FitModeBlur, FitModeSmart:
+		return mode, nil
+	}
+
+	return "", ResizerConfigError{Err: fmt.Errorf("unsupported fit mode %s", name)}
+}
+
+type Filter string
+
+const (
+	FilterNearest  Filter = "nearest"
+	FilterBilinear Filter = "bilinear"
+	FilterBicubic  Filter = "bicubic"
+	FilterMitchell Filter = "mitchell"
+	FilterLanczos2 Filter = "lanczos2"
+	FilterLanczos3 Filter = "lanczos3"
+)
+
+func (f Filter) interpolation() resize.InterpolationFunction {
+	switch f {
+	case FilterNearest:
+		return resize.NearestNeighbor
+	case FilterBilinear:
+		return resize.Bilinear
+	case FilterBicubic:
+		return resize.Bicubic
+	case FilterMitchell:
+		return resize.MitchellNetravali
+	case FilterLanczos2:
+		return resize.Lanczos2
+	}
+
+	return resize.Lanczos3
+}
+
+func ParseFilter(name string) (Filter, error) {
+	switch filter := Filter(strings.ToLower(strings.TrimSpace(name))); filter {
+	case FilterNearest, FilterBilinear, FilterBicubic, FilterMitchell, FilterLanczos2, FilterLanczos3:
+		return filter, nil
+	}
+
+	return "", ResizerConfigError{Err: fmt.Errorf("unsupported resampling filter %s", name)}
+}
+
+type ResizerOption func(*Resizer)
+
 type Resizer struct {
-	width  uint
-	height uint
+	resize         ResizeStage
+	metadataPolicy MetadataPolicy
+	qualityGate    QualityGate
+	enhancement    Enhancement
+	sharpening     Sharpening
+	overlay        Overlay
+	encoder        Encoder
+	limits         Limits
+	stages         []string
+	pipeline       Pipeline
 }
 
 func (r *Resizer) Run(imageInput Image) (Image, error) {
-	img, _, decodeErr := image.Decode(bytes.NewReader(imageInput.Image))
-	if nil != decodeErr {
-		return Image{}, DecodeImageError{Err: fmt.Errorf("error decoding image %s/%s: %s", imageInput.Bucket, imageInput.Key, decodeErr.Error())}
+	return r.pipeline.Run(imageInput)
+}
+
+func (r *Resizer) RunDecoded(decoded DecodedImage) (Image, error) {
+	return r.pipeline.RunDecoded(decoded)
+}
+
+func (r *Resizer) stage(name string) (Stage, bool) {
+	switch name {
+	case StageMetadata:
+		return Stage{Name: name, Transform: NewMetadataStage(r.metadataPolicy)}, true
+	case StageColour:
+		return Stage{Name: name, Transform: NewColourStage()}, true
+	case StageOrient:
+		return Stage{Name: name, Transform: NewOrientStage()}, true
+	case StageQuality:
+		return Stage{Name: name, Transform: NewQualityStage(r.qualityGate)}, true
+	case StageEnhance:
+		return Stage{Name: name, Transform: NewEnhanceStage(r.enhancement)}, true
+	case StageResize:
+		return Stage{Name: name, Transform: r.resize}, true
+	case StageSharpen:
+		return Stage{Name: name, Transform: NewSharpenStage(r.sharpening)}, true
+	case StageOverlay:
+		return Stage{Name: name, Transform: NewOverlayStage(r.overlay)}, true
 	}
 
-	resizedImage := resize.Resize(r.width, r.height, img, resize.Lanczos3)
+	return Stage{}, false
+}
 
-	buffer := new(bytes.Buffer)
-	encodeErr := jpeg.Encode(buffer, resizedImage, nil)
+func WithMetadataPolicy(policy MetadataPolicy) ResizerOption {
+	return func(r *Resizer) {
+		r.metadataPolicy = policy
+	}
+}
 
-	if nil != encodeErr {
-		return Image{}, EncodeImageError{Err: fmt.Errorf("error encoding image: %s/%s: %s", imageInput.Bucket, imageInput.Key, decodeErr.Error())}
+func WithFitMode(mode FitMode) ResizerOption {
+	return func(r *Resizer) {
+		r.resize.fitMode = mode
 	}
+}
 
-	newImage := Image{
-		Image:  buffer.Bytes(),
-		Bucket: imageInput.Bucket,
-		Key:    imageInput.Key,
+func WithPadColour(colour color.Color) ResizerOption {
+	return func(r *Resizer) {
+		r.resize.padColour = colour
 	}
+}
 
-	return newImage, nil
+func WithFilter(filter Filter) ResizerOption {
+	return func(r *Resizer) {
+		r.resize.filter = filter
+	}
+}
+
+func WithSharpening(sharpening Sharpening) ResizerOption {
+	return func(r *Resizer) {
+		r.sharpening = sharpening
+	}
+}
+
+func WithOverlay(overlay Overlay) ResizerOption {
+	return func(r *Resizer) {
+		r.overlay = overlay
+	}
 }
 
-func NewResizer(width, height uint) Resizer {
-	return Resizer{
-		width:  width,
-		height: height,
+func WithEncoder(encoder Encoder) ResizerOption {
+	return func(r *Resizer) {
+		r.encoder = encoder
 	}
 }
+
+func WithQualityGate(gate QualityGate) ResizerOption {
+	return func(r *Resizer) {
+		r.qualityGate = gate
+	}
+}
+
+func WithEnhancement(enhancement Enhancement) ResizerOption {
+	return func(r *Resizer) {
+		r.enhancement = enhancement
+	}
+}
+
+func WithLimits(limits Limits) ResizerOption {
+	return func(r *Resizer) {
+		r.limits = limits
+	}
+}
+
+// WithStages selects and orders the pipeline stages. Names not accepted by
+// ParseStage are skipped.
+func WithStages(stages ...string) ResizerOption {
+	return func(r *Resizer) {
+		r.stages = stages
+	}
+}
+
+func NewResizer(width, height uint, options ...ResizerOption) Resizer {
+	resizer := Resizer{
+		resize:         NewResizeStage(width, height, FitModeFit, color.Black, FilterLanczos3),
+		metadataPolicy: StripAllMetadata(),
+		qualityGate:    DefaultQualityGate(),
+		enhancement:    DefaultEnhancement(),
+		sharpening:     DefaultSharpening(),
+		overlay:        DefaultOverlay(),
+		encoder:        NewJPEGEncoder(DefaultQuality, false),
+		limits:         DefaultLimits(),
+		stages:         DefaultStages,
+	}
+
+	for _, option := range options {
+		option(&resizer)
+	}
+
+	var stages []Stage
+	for _, name := range resizer.stages {
+		if stage, ok := resizer.stage(name); ok {
+			stages = append(stages, stage)
+		}
+	}
+	resizer.pipeline = NewPipeline(resizer.encoder, resizer.limits, stages...)
+
+	return resizer
+}
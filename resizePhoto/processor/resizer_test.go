@@ -2,13 +2,20 @@ package processor
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"os"
 	"testing"
 
+	"github.com/gen2brain/webp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
 type resizerTestSuite struct {
@@ -125,6 +132,234 @@ func (s *resizerTestSuite) TestRun() {
 		assert.Equal(t, 50, resizedImage.Bounds().Max.X)
 		assert.Equal(t, 50, resizedImage.Bounds().Max.Y)
 	})
+
+	s.T().Run("handles heic encoded images", func(t *testing.T) {
+		data, _ := os.ReadFile("testdata/single-image.heic")
+
+		resizer := NewResizer(0, 256)
+
+		output, err := resizer.Run(Image{
+			Image:  data,
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		resizedImage, format, _ := image.Decode(bytes.NewReader(output.Image))
+
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 256, resizedImage.Bounds().Max.X)
+		assert.Equal(t, 256, resizedImage.Bounds().Max.Y)
+	})
+
+	s.T().Run("handles webp, tiff, bmp and gif encoded images", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		inputs := [][]byte{
+			encodeWith(func(buf *bytes.Buffer) error { return webp.Encode(buf, img) }),
+			encodeWith(func(buf *bytes.Buffer) error { return tiff.Encode(buf, img, nil) }),
+			encodeWith(func(buf *bytes.Buffer) error { return bmp.Encode(buf, img) }),
+			encodeWith(func(buf *bytes.Buffer) error { return gif.Encode(buf, img, nil) }),
+		}
+
+		resizer := NewResizer(50, 50)
+
+		for _, input := range inputs {
+			output, err := resizer.Run(Image{
+				Image:  input,
+				Bucket: "bucket",
+				Key:    "key",
+			})
+
+			assert.Nil(t, err)
+
+			resizedImage, _, _ := image.Decode(bytes.NewReader(output.Image))
+
+			assert.Equal(t, 50, resizedImage.Bounds().Max.X)
+			assert.Equal(t, 50, resizedImage.Bounds().Max.Y)
+		}
+	})
+
+	s.T().Run("returns DecodeImageError for unsupported formats", func(t *testing.T) {
+		resizer := NewResizer(50, 50)
+
+		_, err := resizer.Run(Image{
+			Image:  []byte("Thumbs.db"),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.True(t, errors.Is(err, DecodeImageError{}))
+		assert.Equal(t, "error in decode stage: error decoding image bucket/key: unsupported image format", err.Error())
+	})
+}
+
+func (s *resizerTestSuite) TestRunOrientation() {
+	s.T().Run("rotates image upright using exif orientation before resizing", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+
+		resizer := NewResizer(0, 50)
+
+		output, err := resizer.Run(Image{
+			Image:  jpegWithExif(img, orientationExif(binary.LittleEndian, 6)),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		resizedImage, _, _ := image.Decode(bytes.NewReader(output.Image))
+
+		assert.Equal(t, 25, resizedImage.Bounds().Max.X)
+		assert.Equal(t, 50, resizedImage.Bounds().Max.Y)
+	})
+
+	s.T().Run("rotates raw previews using the raw file orientation", func(t *testing.T) {
+		data := buildTIFF(nil, [][]byte{testJPEG(200, 100)}, []testIFD{
+			{entries: []testEntry{
+				{tag: tagMake, text: "SONY"},
+				{tag: tagOrientation, dataType: typeShort, values: []uint32{8}},
+				{tag: tagJPEGOffset, blob: 0, blobOffset: true},
+				{tag: tagJPEGLength, blob: 0},
+			}},
+		})
+
+		resizer := NewResizer(0, 50)
+
+		output, err := resizer.Run(Image{
+			Image:  data,
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		resizedImage, _, _ := image.Decode(bytes.NewReader(output.Image))
+
+		assert.Equal(t, 25, resizedImage.Bounds().Max.X)
+		assert.Equal(t, 50, resizedImage.Bounds().Max.Y)
+	})
+
+	s.T().Run("leaves image unrotated when orientation is normal", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+
+		resizer := NewResizer(0, 50)
+
+		output, err := resizer.Run(Image{
+			Image:  jpegWithExif(img, orientationExif(binary.BigEndian, 1)),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		resizedImage, _, _ := image.Decode(bytes.NewReader(output.Image))
+
+		assert.Equal(t, 100, resizedImage.Bounds().Max.X)
+		assert.Equal(t, 50, resizedImage.Bounds().Max.Y)
+	})
+}
+
+func (s *resizerTestSuite) TestRunMetadata() {
+	s.T().Run("strips all exif metadata by default", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+		resizer := NewResizer(50, 50)
+
+		output, err := resizer.Run(Image{
+			Image:  jpegWithExif(img, privateExif()),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+		assert.Nil(t, exifFromJPEG(output.Image))
+	})
+
+	s.T().Run("writes allow-listed exif metadata without gps data", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		policy, _ := NewMetadataPolicy([]ExifTag{TagDateTimeOriginal, TagModel}, nil)
+
+		resizer := NewResizer(50, 50, WithMetadataPolicy(policy))
+
+		output, err := resizer.Run(Image{
+			Image:  jpegWithExif(img, privateExif()),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		metadata, err := parseExif(exifFromJPEG(output.Image))
+		date, _ := metadata.ascii(uint16(TagDateTimeOriginal))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "2021:06:01 10:00:00", date)
+		assert.False(t, hasGPSIFD(metadata))
+
+		_, _, decodeErr := image.Decode(bytes.NewReader(output.Image))
+		assert.Nil(t, decodeErr)
+	})
+}
+
+func (s *resizerTestSuite) TestRunEncoder() {
+	s.T().Run("encodes output with the configured encoder", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		policy, _ := NewMetadataPolicy([]ExifTag{TagDateTimeOriginal}, nil)
+
+		resizer := NewResizer(50, 50, WithEncoder(NewPNGEncoder()), WithMetadataPolicy(policy))
+
+		output, err := resizer.Run(Image{
+			Image:  jpegWithExif(img, privateExif()),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, FormatPNG, DetectFormat(output.Image))
+
+		resizedImage, err := png.Decode(bytes.NewReader(output.Image))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 50, resizedImage.Bounds().Dx())
+	})
+}
+
+func (s *resizerTestSuite) TestRunFitMode() {
+	s.T().Run("writes a single jpeg of the target size with a blurred background", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		_ = jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 300, 400)), nil)
+
+		resizer := NewResizer(800, 480, WithFitMode(FitModeBlur))
+
+		output, err := resizer.Run(Image{
+			Image:  buf.Bytes(),
+			Bucket: "bucket",
+			Key:    "key",
+		})
+
+		assert.Nil(t, err)
+
+		resizedImage, err := jpeg.Decode(bytes.NewReader(output.Image))
+
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 800, 480), resizedImage.Bounds())
+	})
+}
+
+func (s *resizerTestSuite) TestParseFitMode() {
+	s.T().Run("parses fit modes case-insensitively", func(t *testing.T) {
+		mode, err := ParseFitMode(" FIT ")
+
+		assert.Nil(t, err)
+		assert.Equal(t, FitModeFit, mode)
+	})
+
+	s.T().Run("returns ResizerConfigError for unknown fit modes", func(t *testing.T) {
+		_, err := ParseFitMode("stretch")
+
+		assert.True(t, errors.Is(err, ResizerConfigError{}))
+	})
 }
 
 func TestResizerTestSuite(t *testing.T) {
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+const (
+	maxSharpenRadius = 10
+	maxSharpenAmount = 5
+)
+
+// Sharpening configures an unsharp mask. Radius is the gaussian sigma in
+// pixels, Amount how much of the detail is added back, and differences
+// smaller than Threshold are left alone so flat areas do not get noisy.
+type Sharpening struct {
+	Radius    float64
+	Amount    float64
+	Threshold int
+}
+
+func (s Sharpening) Validate() error {
+	if !(0 < s.Radius && maxSharpenRadius >= s.Radius) {
+		return ResizerConfigError{Err: fmt.Errorf("sharpen radius %g must be above 0 and at most %d", s.Radius, maxSharpenRadius)}
+	}
+
+	if !(0 <= s.Amount && maxSharpenAmount >= s.Amount) {
+		return ResizerConfigError{Err: fmt.Errorf("sharpen amount %g must be between 0 and %d", s.Amount, maxSharpenAmount)}
+	}
+
+	if 0 > s.Threshold || 255 < s.Threshold {
+		return ResizerConfigError{Err: fmt.Errorf("sharpen threshold %d must be between 0 and 255", s.Threshold)}
+	}
+
+	return nil
+}
+
+func DefaultSharpening() Sharpening {
+	return Sharpening{
+		Radius:    1,
+		Amount:    0.6,
+		Threshold: 3,
+	}
+}
+
+type SharpenStage struct {
+	sharpening Sharpening
+}
+
+func (s SharpenStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	decoded.Image = s.sharpen(decoded.Image)
+
+	return decoded, nil
+}
+
+func (s SharpenStage) sharpen(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	sharpened := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(sharpened, sharpened.Bounds(), img, bounds.Min, draw.Src)
+
+	blurred := gaussianBlur(sharpened, s.sharpening.Radius)
+	for i := range sharpened.Pix {
+		if 3 == i%4 {
+			continue
+		}
+
+		detail := float64(sharpened.Pix[i]) - blurred[i]
+		if math.Abs(detail) >= float64(s.sharpening.Threshold) {
+			sharpened.Pix[i] = clampChannel(float64(sharpened.Pix[i]) + s.sharpening.Amount*detail)
+		}
+	}
+
+	return sharpened
+}
+
+// gaussianBlur returns the blurred colour channels of img laid out like
+// img.Pix. Edges are extended rather than wrapped.
+func gaussianBlur(img *image.NRGBA, sigma float64) []float64 {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var total float64
+	for i := range kernel {
+		offset := float64(i - radius)
+		kernel[i] = math.Exp(-offset * offset / (2 * sigma * sigma))
+		total += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	horizontal := make([]float64, len(img.Pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for channel := 0; channel < 3; channel++ {
+				var sum float64
+				for k, weight := range kernel {
+					sample := minInt(maxInt(x+k-radius, 0), width-1)
+					sum += weight * float64(img.Pix[y*img.Stride+sample*4+channel])
+				}
+				horizontal[y*img.Stride+x*4+channel] = sum
+			}
+		}
+	}
+
+	blurred := make([]float64, len(img.Pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for channel := 0; channel < 3; channel++ {
+				var sum float64
+				for k, weight := range kernel {
+					sample := minInt(maxInt(y+k-radius, 0), height-1)
+					sum += weight * horizontal[sample*img.Stride+x*4+channel]
+				}
+				blurred[y*img.Stride+x*4+channel] = sum
+			}
+		}
+	}
+
+	return blurred
+}
+
+func NewSharpenStage(sharpening Sharpening) SharpenStage {
+	return SharpenStage{
+		sharpening: sharpening,
+	}
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type sharpenTestSuite struct {
+	suite.Suite
+}
+
+func edge(width, height int, dark, light uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := dark
+			if x >= width/2 {
+				value = light
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: value, G: value, B: value, A: 255})
+		}
+	}
+
+	return img
+}
+
+func (s *sharpenTestSuite) TestApply() {
+	s.T().Run("adds contrast either side of an edge", func(t *testing.T) {
+		decoded, err := NewSharpenStage(DefaultSharpening()).Apply(DecodedImage{Image: edge(16, 4, 100, 150)})
+		sharpened := decoded.Image.(*image.NRGBA)
+
+		assert.Nil(t, err)
+		assert.Less(t, sharpened.NRGBAAt(7, 0).R, uint8(100))
+		assert.Greater(t, sharpened.NRGBAAt(8, 0).R, uint8(150))
+		assert.Equal(t, uint8(100), sharpened.NRGBAAt(0, 0).R)
+		assert.Equal(t, uint8(255), sharpened.NRGBAAt(7, 0).A)
+	})
+
+	s.T().Run("leaves differences under the threshold alone", func(t *testing.T) {
+		img := edge(16, 4, 100, 104)
+
+		decoded, _ := NewSharpenStage(Sharpening{Radius: 1, Amount: 1, Threshold: 4}).Apply(DecodedImage{Image: img})
+
+		assert.Equal(t, img.Pix, decoded.Image.(*image.NRGBA).Pix)
+	})
+
+	s.T().Run("matches golden sharpened downscale", func(t *testing.T) {
+		resizer := NewResizer(150, 150)
+
+		sharpened := NewSharpenStage(DefaultSharpening()).sharpen(resizer.resize.fit(groupShot(300, 300, 150, 150)))
+
+		assertGolden(t, "sharpen/groupshot.png", sharpened)
+	})
+}
+
+func (s *sharpenTestSuite) TestValidate() {
+	s.T().Run("accepts the default sharpening", func(t *testing.T) {
+		assert.Nil(t, DefaultSharpening().Validate())
+	})
+
+	s.T().Run("returns ResizerConfigError for out of range settings", func(t *testing.T) {
+		for _, sharpening := range []Sharpening{
+			{Radius: 0, Amount: 1},
+			{Radius: 1, Amount: -1},
+			{Radius: 1, Amount: 1, Threshold: 256},
+		} {
+			assert.True(t, errors.Is(sharpening.Validate(), ResizerConfigError{}), sharpening)
+		}
+	})
+}
+
+func TestSharpenTestSuite(t *testing.T) {
+	suite.Run(t, new(sharpenTestSuite))
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	smartCropAnalysisSize = 256
+	smartCropCandidates   = 32
+	smartCropHistogram    = 32
+
+	edgeWeight    = 0.5
+	entropyWeight = 0.1
+	skinWeight    = 1.0
+)
+
+type cropScores struct {
+	width  int
+	height int
+	luma   []uint8
+	edges  []float64
+	skin   []bool
+}
+
+func smartFill(img image.Image, width, height int, interpolation resize.InterpolationFunction) *image.NRGBA {
+	covered := cover(img, width, height, interpolation)
+
+	return crop(covered, smartCropWindow(covered, width, height))
+}
+
+// smartCropWindow slides a width x height window along the cropped axis and
+// keeps the one with the most edges, detail and skin tones. Equal scores
+// prefer the window nearest the centre, so flat images are centre-cropped.
+func smartCropWindow(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return bounds
+	}
+
+	factor := math.Min(1, float64(smartCropAnalysisSize)/float64(maxInt(bounds.Dx(), bounds.Dy())))
+	scores := newCropScores(img, factor)
+
+	horizontal := bounds.Dx() > width
+	travel := bounds.Dy() - height
+	if horizontal {
+		travel = bounds.Dx() - width
+	}
+
+	var positions []int
+	for position := 0; position < travel; position += maxInt(1, travel/smartCropCandidates) {
+		positions = append(positions, position)
+	}
+	positions = append(positions, travel/2, travel)
+
+	best, bestScore, bestDistance := 0, -1.0, travel
+	for _, position := range positions {
+		window := image.Rect(0, position, width, position+height)
+		if horizontal {
+			window = image.Rect(position, 0, position+width, height)
+		}
+
+		score := scores.score(scaleRect(window, factor, scores.width, scores.height))
+		distance := absInt(2*position - travel)
+		if score > bestScore+1e-9 || (math.Abs(score-bestScore) <= 1e-9 && distance < bestDistance) {
+			best, bestScore, bestDistance = position, score, distance
+		}
+	}
+
+	offset := image.Pt(0, best)
+	if horizontal {
+		offset = image.Pt(best, 0)
+	}
+	offset = offset.Add(bounds.Min)
+
+	return image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))}
+}
+
+func newCropScores(img image.Image, factor float64) cropScores {
+	bounds := img.Bounds()
+	width := maxInt(1, int(math.Round(float64(bounds.Dx())*factor)))
+	height := maxInt(1, int(math.Round(float64(bounds.Dy())*factor)))
+
+	analysis := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(analysis, analysis.Bounds(), resize.Resize(uint(width), uint(height), img, resize.Bilinear), bounds.Min, draw.Src)
+
+	scores := cropScores{
+		width:  width,
+		height: height,
+		luma:   make([]uint8, width*height),
+		edges:  make([]float64, width*height),
+		skin:   make([]bool, width*height),
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixel := analysis.NRGBAAt(x, y)
+			luma, cb, cr := color.RGBToYCbCr(pixel.R, pixel.G, pixel.B)
+			scores.luma[y*width+x] = luma
+			scores.skin[y*width+x] = 60 < luma && 77 <= cb && 127 >= cb && 133 <= cr && 173 >= cr
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx := int(scores.luma[y*width+minInt(x+1, width-1)]) - int(scores.luma[y*width+maxInt(x-1, 0)])
+			dy := int(scores.luma[minInt(y+1, height-1)*width+x]) - int(scores.luma[maxInt(y-1, 0)*width+x])
+			scores.edges[y*width+x] = math.Min(1, math.Hypot(float64(dx), float64(dy))/255)
+		}
+	}
+
+	return scores
+}
+
+func (s cropScores) score(window image.Rectangle) float64 {
+	var edges, skin float64
+	var histogram [smartCropHistogram]int
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		for x := window.Min.X; x < window.Max.X; x++ {
+			index := y*s.width + x
+			edges += s.edges[index]
+			if s.skin[index] {
+				skin++
+			}
+			histogram[int(s.luma[index])*smartCropHistogram/256]++
+		}
+	}
+
+	area := float64(window.Dx() * window.Dy())
+	entropy := 0.0
+	for _, count := range histogram {
+		if 0 < count {
+			p := float64(count) / area
+			entropy -= p * math.Log2(p)
+		}
+	}
+
+	return edgeWeight*edges/area + entropyWeight*entropy/math.Log2(smartCropHistogram) + skinWeight*skin/area
+}
+
+func scaleRect(rect image.Rectangle, factor float64, width, height int) image.Rectangle {
+	scaledRect := image.Rect(
+		int(math.Round(float64(rect.Min.X)*factor)),
+		int(math.Round(float64(rect.Min.Y)*factor)),
+		int(math.Round(float64(rect.Max.X)*factor)),
+		int(math.Round(float64(rect.Max.Y)*factor)),
+	).Intersect(image.Rect(0, 0, width, height))
+
+	if scaledRect.Empty() {
+		return image.Rect(0, 0, 1, 1)
+	}
+
+	return scaledRect
+}
+
+func absInt(value int) int {
+	if 0 > value {
+		return -value
+	}
+
+	return value
+}
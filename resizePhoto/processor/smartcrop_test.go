@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden images in testdata")
+
+type smartCropTestSuite struct {
+	suite.Suite
+}
+
+// groupShot draws a flat sky and lawn with a face at (centreX, centreY).
+func groupShot(width, height, centreX, centreY int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: 150, G: 180, B: 210, A: 255})
+			if y > height*3/4 {
+				img.Set(x, y, color.NRGBA{R: 80, G: 130, B: 70, A: 255})
+			}
+
+			dx, dy := float64(x-centreX)/40, float64(y-centreY)/50
+			if 1 >= dx*dx+dy*dy {
+				shade := uint8(random.Intn(24))
+				img.Set(x, y, color.NRGBA{R: 200 + shade/2, G: 150 + shade, B: 120 + shade, A: 255})
+			}
+		}
+	}
+
+	for _, feature := range []image.Rectangle{
+		image.Rect(centreX-20, centreY-15, centreX-8, centreY-8),
+		image.Rect(centreX+8, centreY-15, centreX+20, centreY-8),
+		image.Rect(centreX-15, centreY+18, centreX+15, centreY+24),
+	} {
+		for y := feature.Min.Y; y < feature.Max.Y; y++ {
+			for x := feature.Min.X; x < feature.Max.X; x++ {
+				img.Set(x, y, color.NRGBA{R: 40, G: 25, B: 20, A: 255})
+			}
+		}
+	}
+
+	return img
+}
+
+func assertGolden(t *testing.T, name string, img image.Image) {
+	path := filepath.Join("testdata", filepath.FromSlash(name))
+
+	if *updateGolden {
+		buf := new(bytes.Buffer)
+		assert.Nil(t, png.Encode(buf, img))
+		assert.Nil(t, os.WriteFile(path, buf.Bytes(), 0644))
+	}
+
+	file, err := os.Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer file.Close()
+
+	golden, err := png.Decode(file)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, golden.Bounds(), img.Bounds())
+	assert.LessOrEqual(t, meanDifference(golden, img), 1.0)
+}
+
+func (s *smartCropTestSuite) TestSmartCropWindow() {
+	s.T().Run("keeps a face near the top of a portrait photo", func(t *testing.T) {
+		img := groupShot(300, 600, 150, 110)
+
+		window := smartCropWindow(img, 300, 200)
+
+		assert.Equal(t, 300, window.Dx())
+		assert.Equal(t, 200, window.Dy())
+		assert.LessOrEqual(t, window.Min.Y, 110-50)
+		assert.GreaterOrEqual(t, window.Max.Y, 110+50)
+	})
+
+	s.T().Run("keeps a face near the edge of a landscape photo", func(t *testing.T) {
+		img := groupShot(800, 300, 700, 120)
+
+		window := smartCropWindow(img, 300, 300)
+
+		assert.Equal(t, 300, window.Dx())
+		assert.LessOrEqual(t, window.Min.X, 700-40)
+		assert.GreaterOrEqual(t, window.Max.X, 700+40)
+	})
+
+	s.T().Run("centre-crops images with no detail", func(t *testing.T) {
+		img := solid(300, 600, color.White)
+
+		window := smartCropWindow(img, 300, 200)
+
+		assert.Equal(t, image.Rect(0, 200, 300, 400), window)
+	})
+}
+
+func (s *smartCropTestSuite) TestSmartFill() {
+	s.T().Run("matches golden portrait crop", func(t *testing.T) {
+		resizer := NewResizer(400, 240, WithFitMode(FitModeSmart))
+
+		output := resizer.resize.fit(groupShot(300, 600, 150, 110))
+
+		assert.Equal(t, image.Rect(0, 0, 400, 240), output.Bounds())
+		assertGolden(t, "smartcrop/portrait.png", output)
+	})
+
+	s.T().Run("matches golden landscape crop", func(t *testing.T) {
+		resizer := NewResizer(240, 240, WithFitMode(FitModeSmart))
+
+		output := resizer.resize.fit(groupShot(800, 300, 700, 120))
+
+		assert.Equal(t, image.Rect(0, 0, 240, 240), output.Bounds())
+		assertGolden(t, "smartcrop/landscape.png", output)
+	})
+}
+
+func TestSmartCropTestSuite(t *testing.T) {
+	suite.Run(t, new(smartCropTestSuite))
+}
@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+const (
+	StageDecode   = "decode"
+	StageMetadata = "metadata"
+	StageColour   = "colour"
+	StageOrient   = "orient"
+	StageQuality  = "quality"
+	StageEnhance  = "enhance"
+	StageResize   = "resize"
+	StageSharpen  = "sharpen"
+	StageOverlay  = "overlay"
+	StageEncode   = "encode"
+)
+
+var DefaultStages = []string{StageMetadata, StageColour, StageOrient, StageResize}
+
+// OptionalStages only run when they are named in the stage list.
+var OptionalStages = []string{StageQuality, StageEnhance, StageSharpen, StageOverlay}
+
+func ParseStage(name string) (string, error) {
+	stage := strings.ToLower(strings.TrimSpace(name))
+	for _, known := range append(append([]string{}, DefaultStages...), OptionalStages...) {
+		if known == stage {
+			return stage, nil
+		}
+	}
+
+	return "", ResizerConfigError{Err: fmt.Errorf("unsupported pipeline stage %s", name)}
+}
+
+type MetadataStage struct {
+	policy MetadataPolicy
+}
+
+func (s MetadataStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	decoded.OutputExif = s.policy.apply(parseMetadata(decoded.Exif))
+
+	return decoded, nil
+}
+
+func NewMetadataStage(policy MetadataPolicy) MetadataStage {
+	return MetadataStage{
+		policy: policy,
+	}
+}
+
+// ColourStage converts matrix/TRC profiled pixels to sRGB and tags the
+// output as sRGB. Images with profiles it cannot read pass through as they
+// are, still tagged with their own profile.
+type ColourStage struct{}
+
+func (s ColourStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	decoded.OutputICC = srgbProfile
+	if nil == decoded.ICC {
+		return decoded, nil
+	}
+
+	// Profiles that cannot be read are only kept when they describe RGB data,
+	// as the encoders write RGB whatever the source was.
+	profile, err := parseColourProfile(decoded.ICC)
+	if nil != err {
+		if isRGBProfile(decoded.ICC) {
+			decoded.OutputICC = decoded.ICC
+		}
+		return decoded, nil
+	}
+	if profile.isSRGB() {
+		return decoded, nil
+	}
+
+	decoded.Image = profile.convert(decoded.Image)
+	decoded.ICC = srgbProfile
+
+	return decoded, nil
+}
+
+func NewColourStage() ColourStage {
+	return ColourStage{}
+}
+
+type OrientStage struct{}
+
+func (s OrientStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	if FormatHEIF != decoded.Format {
+		decoded.Image = orient(decoded.Image, parseMetadata(decoded.Exif).orientation())
+	}
+
+	return decoded, nil
+}
+
+func NewOrientStage() OrientStage {
+	return OrientStage{}
+}
+
+type ResizeStage struct {
+	width     uint
+	height    uint
+	fitMode   FitMode
+	padColour color.Color
+	filter    Filter
+}
+
+func (s ResizeStage) Apply(decoded DecodedImage) (DecodedImage, error) {
+	decoded.Image = s.fit(decoded.Image)
+
+	return decoded, nil
+}
+
+func NewResizeStage(width, height uint, fitMode FitMode, padColour color.Color, filter Filter) ResizeStage {
+	return ResizeStage{
+		width:     width,
+		height:    height,
+		fitMode:   fitMode,
+		padColour: padColour,
+		filter:    filter,
+	}
+}
@@ -1,6 +1,8 @@
 #! /bin/bash
 
-aws s3 sync s3://king-family-photos-live-display /home/pi/Pictures --delete
+RENDITION=${RENDITION:-frame-480}
+
+aws s3 sync s3://king-family-photos-live-display/${RENDITION} /home/pi/Pictures --delete
 feh \
   --recursive \
   --randomize \